@@ -32,6 +32,22 @@ func (lh *LoginHandler) Handle(ctx context.Context, req *msg.Request) (*msg.Resp
 		}, nil
 	}
 
+	// API users are authenticated by tokens, a password sent over the API would start a session nobody can end
+	if req.IsAPIRequest() {
+		return &msg.Response{
+			Message: "your API token doesn't give access to the bot, ask an admin to issue a new one",
+			Type:    msg.Error,
+		}, nil
+	}
+
+	// passwords should never be typed in inline queries or group chats as they are visible to other people
+	if req.IsInlineQuery() || req.IsGroupChat() {
+		return &msg.Response{
+			Message: "please login in a private chat with the bot first",
+			Type:    msg.Error,
+		}, nil
+	}
+
 	return lh.handleNotVerifiedUser(ctx, req, user)
 }
 
@@ -81,7 +97,7 @@ func (lh *LoginHandler) checkPassword(candidatePassword string, user *CachedUser
 func (lh *LoginHandler) CanHandle(_ context.Context, req *msg.Request) (bool, error) {
 	user := GetUserFromReq(req)
 
-	if user != nil && user.State == UserVerified && (user.LoginTill == int64(0) || user.LoginTill > time.Now().Unix()) {
+	if user.IsLoggedIn() {
 		return false, nil
 	}
 
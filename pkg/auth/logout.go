@@ -30,6 +30,14 @@ func (h *LogoutHandler) CanHandle(_ context.Context, req *msg.Request) (bool, er
 func (h *LogoutHandler) Handle(ctx context.Context, req *msg.Request) (*msg.Response, error) {
 	log := logrus.WithContext(ctx)
 
+	// API tokens are revoked with /deltoken, logging out the token owner would only lock the API user out
+	if req.IsAPIRequest() {
+		return &msg.Response{
+			Message: "logout is not available over the API, ask an admin to revoke the API token",
+			Type:    msg.Error,
+		}, nil
+	}
+
 	user := GetUserFromReq(req)
 
 	if user == nil {
@@ -53,8 +61,18 @@ func (h *LogoutHandler) Handle(ctx context.Context, req *msg.Request) (*msg.Resp
 	}, nil
 }
 
-func (h *LogoutHandler) GetHelp(context.Context, *msg.Request) help.Result {
+func (h *LogoutHandler) GetHelp(_ context.Context, req *msg.Request) help.Result {
+	if req.IsAPIRequest() {
+		return help.Result{}
+	}
+
 	text := fmt.Sprintf("%s: to logout from the system", h.command)
 
 	return help.Result{Text: text, PredefinedOption: h.command}
 }
+
+func (h *LogoutHandler) GetCommands() []help.Command {
+	return []help.Command{
+		{Name: h.command, Description: "logout from the system"},
+	}
+}
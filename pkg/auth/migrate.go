@@ -12,7 +12,8 @@ func MigrateUsers(ctx context.Context, cfg *Config, us *UserStorage) error {
 	log.Debug("Will migrate configured users to db")
 
 	for _, u := range cfg.Users {
-		cachedUser, err := us.ReadUserFromStorage(ctx, u.PlatformName, u.Login)
+		// configured user names are aliases after the first login
+		cachedUser, err := us.FindUser(ctx, u.PlatformName, u.Login)
 		if err != nil {
 			return err
 		}
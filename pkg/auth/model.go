@@ -34,6 +34,7 @@ func (us UserState) String() string {
 type CachedUser struct {
 	UID          string    `json:"uid"`
 	Login        string    `json:"login"`
+	Alias        string    `json:"alias"`
 	State        UserState `json:"state"`
 	PlatformName string    `json:"platform"`
 	Role         string    `json:"role"`
@@ -41,6 +42,14 @@ type CachedUser struct {
 	LoginTill    int64     `json:"login_till"`
 }
 
+func (cu *CachedUser) IsLoggedIn() bool {
+	if cu == nil || cu.State != UserVerified {
+		return false
+	}
+
+	return cu.LoginTill == int64(0) || cu.LoginTill > time.Now().Unix()
+}
+
 func (cu *CachedUser) String() string {
 	var loginTillP *time.Time
 
@@ -52,6 +61,7 @@ func (cu *CachedUser) String() string {
 	res := struct {
 		UID          string     `json:"uid"`
 		Login        string     `json:"login"`
+		Alias        string     `json:"alias,omitempty"`
 		State        string     `json:"state"`
 		PlatformName string     `json:"platform"`
 		Role         string     `json:"role"`
@@ -59,6 +69,7 @@ func (cu *CachedUser) String() string {
 	}{
 		UID:          cu.UID,
 		Login:        cu.Login,
+		Alias:        cu.Alias,
 		State:        cu.State.String(),
 		PlatformName: cu.PlatformName,
 		Role:         cu.Role,
@@ -101,3 +112,10 @@ func (u ConfiguredUser) Validate() error {
 
 	return nil
 }
+
+// APIToken binds a token, which is stored as a hash, to a user
+type APIToken struct {
+	Login     string `json:"login"`
+	Platform  string `json:"platform"`
+	CreatedAt int64  `json:"created_at"`
+}
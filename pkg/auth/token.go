@@ -0,0 +1,292 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"breathbathChatGPT/pkg/help"
+	"breathbathChatGPT/pkg/msg"
+	"breathbathChatGPT/pkg/storage"
+	"breathbathChatGPT/pkg/utils"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// APIPlatform is the platform of users which access the bot with API tokens
+	APIPlatform = "http"
+
+	apiTokensPrefix = "api_tokens"
+	apiTokenPrefix  = "bgpt_"
+	apiTokenBytes   = 32
+)
+
+func generateAPIToken() (string, error) {
+	raw := make([]byte, apiTokenBytes)
+	_, err := rand.Read(raw)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to generate api token")
+	}
+
+	return apiTokenPrefix + hex.EncodeToString(raw), nil
+}
+
+// only hashes of tokens are stored, so a leaked database doesn't give access to the API
+func hashAPIToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(hash[:])
+}
+
+func (us *UserStorage) generateAPITokenKey(tokenHash string) string {
+	return storage.GenerateCacheKey(usersVersion, APIPlatform, apiTokensPrefix, tokenHash)
+}
+
+func (us *UserStorage) WriteAPIToken(ctx context.Context, token string, apiToken *APIToken) error {
+	ctxValue := context.WithValue(ctx, storage.IsNotLoggableContentCtxKey, true)
+
+	return us.db.Save(ctxValue, us.generateAPITokenKey(hashAPIToken(token)), apiToken, 0)
+}
+
+// FindUserByAPIToken gives the user the token was issued to or nil if the token is unknown
+func (us *UserStorage) FindUserByAPIToken(ctx context.Context, token string) (*CachedUser, error) {
+	if token == "" {
+		return nil, nil
+	}
+
+	apiToken := new(APIToken)
+	ctxValue := context.WithValue(ctx, storage.IsNotLoggableContentCtxKey, true)
+	found, err := us.db.Load(ctxValue, us.generateAPITokenKey(hashAPIToken(token)), apiToken)
+	if err != nil || !found {
+		return nil, err
+	}
+
+	return us.ReadUserFromStorage(ctx, apiToken.Platform, apiToken.Login)
+}
+
+// DeleteAPITokens revokes all tokens of the user and gives the number of revoked tokens
+func (us *UserStorage) DeleteAPITokens(ctx context.Context, platform, login string) (int, error) {
+	keys, err := us.db.FindKeys(ctx, us.generateAPITokenKey("*"))
+	if err != nil {
+		return 0, err
+	}
+
+	ctxValue := context.WithValue(ctx, storage.IsNotLoggableContentCtxKey, true)
+
+	deletedCount := 0
+	for _, key := range keys {
+		apiToken := new(APIToken)
+		found, err := us.db.Load(ctxValue, key, apiToken)
+		if err != nil {
+			return deletedCount, err
+		}
+
+		if !found || apiToken.Platform != platform || apiToken.Login != login {
+			continue
+		}
+
+		err = us.db.Delete(ctx, key)
+		if err != nil {
+			return deletedCount, err
+		}
+		deletedCount++
+	}
+
+	return deletedCount, nil
+}
+
+type AddAPITokenCommand struct {
+	command       string
+	us            *UserStorage
+	adminDetector func(req *msg.Request) bool
+}
+
+func NewAddAPITokenCommand(us *UserStorage, adminDetector func(req *msg.Request) bool) *AddAPITokenCommand {
+	return &AddAPITokenCommand{
+		command:       "/addtoken",
+		us:            us,
+		adminDetector: adminDetector,
+	}
+}
+
+func (at *AddAPITokenCommand) CanHandle(_ context.Context, req *msg.Request) (bool, error) {
+	if !utils.MatchesCommand(req.Message, at.command) {
+		return false, nil
+	}
+
+	return at.adminDetector(req), nil
+}
+
+// Handle issues a new token to the API user, the user is created on the first token,
+// previous tokens of the user are revoked
+func (at *AddAPITokenCommand) Handle(ctx context.Context, req *msg.Request) (*msg.Response, error) {
+	log := logrus.WithContext(ctx)
+
+	// the token is shown in the response, so other members of a chat would see it
+	if req.IsGroupChat() || req.IsInlineQuery() {
+		return &msg.Response{
+			Message: "API tokens are issued only in a private chat with the bot",
+			Type:    msg.Error,
+		}, nil
+	}
+
+	login := utils.ExtractCommandValue(req.Message, at.command)
+	if login == "" || strings.Contains(login, " ") {
+		return &msg.Response{
+			Message: "Invalid value provided, you need to provide the login of the API user",
+			Type:    msg.Error,
+		}, nil
+	}
+
+	u, err := at.us.ReadUserFromStorage(ctx, APIPlatform, login)
+	if err != nil {
+		return nil, err
+	}
+
+	if u == nil {
+		u = &CachedUser{
+			UID:          uuid.NewString(),
+			Login:        login,
+			PlatformName: APIPlatform,
+			Role:         UserRole,
+		}
+	}
+
+	// the token replaces the password, so API users are logged in as long as they have a valid token
+	u.State = UserVerified
+	u.LoginTill = 0
+
+	err = at.us.WriteUserToStorage(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+
+	revokedCount, err := at.us.DeleteAPITokens(ctx, APIPlatform, login)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := generateAPIToken()
+	if err != nil {
+		return nil, err
+	}
+
+	err = at.us.WriteAPIToken(ctx, token, &APIToken{
+		Login:     login,
+		Platform:  APIPlatform,
+		CreatedAt: time.Now().Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Infof("issued api token for user %q, revoked %d previous tokens", login, revokedCount)
+
+	op := &msg.Options{}
+	op.WithIsSensitive()
+
+	return &msg.Response{
+		Message: fmt.Sprintf(
+			"API token for %q: %s\nIt's shown only once, previous tokens of the user are revoked",
+			login,
+			token,
+		),
+		Type:    msg.Success,
+		Options: op,
+	}, nil
+}
+
+func (at *AddAPITokenCommand) GetHelp(_ context.Context, req *msg.Request) help.Result {
+	if !at.adminDetector(req) {
+		return help.Result{}
+	}
+
+	text := fmt.Sprintf(
+		"%s #login#: issues an API token for the HTTP API user, the user is created if missing, previous tokens are revoked",
+		at.command,
+	)
+
+	return help.Result{Text: text}
+}
+
+func (at *AddAPITokenCommand) GetCommands() []help.Command {
+	return []help.Command{
+		{Name: at.command, Description: "issue an API token: #login#", IsAdminOnly: true},
+	}
+}
+
+type DeleteAPITokenCommand struct {
+	command       string
+	us            *UserStorage
+	adminDetector func(req *msg.Request) bool
+}
+
+func NewDeleteAPITokenCommand(us *UserStorage, adminDetector func(req *msg.Request) bool) *DeleteAPITokenCommand {
+	return &DeleteAPITokenCommand{
+		command:       "/deltoken",
+		us:            us,
+		adminDetector: adminDetector,
+	}
+}
+
+func (dt *DeleteAPITokenCommand) CanHandle(_ context.Context, req *msg.Request) (bool, error) {
+	if !utils.MatchesCommand(req.Message, dt.command) {
+		return false, nil
+	}
+
+	return dt.adminDetector(req), nil
+}
+
+func (dt *DeleteAPITokenCommand) Handle(ctx context.Context, req *msg.Request) (*msg.Response, error) {
+	log := logrus.WithContext(ctx)
+
+	login := utils.ExtractCommandValue(req.Message, dt.command)
+	if login == "" {
+		return &msg.Response{
+			Message: "no login provided",
+			Type:    msg.Error,
+		}, nil
+	}
+
+	revokedCount, err := dt.us.DeleteAPITokens(ctx, APIPlatform, login)
+	if err != nil {
+		return nil, err
+	}
+
+	if revokedCount == 0 {
+		return &msg.Response{
+			Message: fmt.Sprintf("didn't find API tokens of %q", login),
+			Type:    msg.Error,
+		}, nil
+	}
+
+	log.Infof("revoked %d api tokens of user %q", revokedCount, login)
+
+	return &msg.Response{
+		Message: fmt.Sprintf("successfully revoked API tokens of %q", login),
+		Type:    msg.Success,
+	}, nil
+}
+
+func (dt *DeleteAPITokenCommand) GetHelp(_ context.Context, req *msg.Request) help.Result {
+	if !dt.adminDetector(req) {
+		return help.Result{}
+	}
+
+	text := fmt.Sprintf("%s #login#: revokes the API tokens of the HTTP API user", dt.command)
+
+	return help.Result{Text: text}
+}
+
+func (dt *DeleteAPITokenCommand) GetCommands() []help.Command {
+	return []help.Command{
+		{Name: dt.command, Description: "revoke API tokens: #login#", IsAdminOnly: true},
+	}
+}
@@ -2,6 +2,7 @@ package auth
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"strings"
 
@@ -23,12 +24,9 @@ const (
 )
 
 func GetUserFromReq(req *msg.Request) *CachedUser {
-	userI, ok := req.Meta["curUser"]
-	if !ok {
-		return nil
-	}
+	u, _ := req.Meta["curUser"].(*CachedUser)
 
-	return userI.(*CachedUser)
+	return u
 }
 
 type UserStorage struct {
@@ -106,6 +104,145 @@ func (us *UserStorage) ReadUsersFromStorage(ctx context.Context, platform string
 	return users, nil
 }
 
+// FindUser gives the user stored under the login or the user which has it as an alias
+func (us *UserStorage) FindUser(ctx context.Context, platform, loginOrAlias string) (user *CachedUser, err error) {
+	user, err = us.ReadUserFromStorage(ctx, platform, loginOrAlias)
+	if err != nil || user != nil {
+		return user, err
+	}
+
+	users, err := us.ReadUsersFromStorage(ctx, platform)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range users {
+		if users[i].Alias != "" && strings.EqualFold(users[i].Alias, loginOrAlias) {
+			return &users[i], nil
+		}
+	}
+
+	return nil, nil
+}
+
+// bindUserScript moves the user record and the sender keys in one step, so that a concurrent request of the same sender
+// either sees the user under the alias with all its data or under the id, the sender keys already existing under the id are kept
+const bindUserScript = `
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+
+redis.call('SET', KEYS[2], ARGV[1])
+redis.call('DEL', KEYS[1])
+
+for i = 3, #KEYS, 2 do
+	if redis.call('EXISTS', KEYS[i]) == 1 and redis.call('EXISTS', KEYS[i + 1]) == 0 then
+		redis.call('RENAME', KEYS[i], KEYS[i + 1])
+	end
+end
+
+return 1
+`
+
+// bindUserToID moves a user added by the sender alias under the immutable sender id,
+// so the user keeps the account after changing the alias, the conversations, settings and other data
+// stored under the alias as the sender id are moved under the id as well
+func (us *UserStorage) bindUserToID(ctx context.Context, platform, userID, alias string) (*CachedUser, error) {
+	log := logrus.WithContext(ctx)
+
+	if alias == "" {
+		return nil, nil
+	}
+
+	u, err := us.ReadUserFromStorage(ctx, platform, alias)
+	if err != nil || u == nil {
+		return nil, err
+	}
+
+	runner, ok := us.db.(storage.ScriptRunner)
+	if !ok {
+		return nil, errors.New("the storage cannot run scripts which are needed to bind users to ids")
+	}
+
+	aliasKey := us.generateUserCacheKey(platform, alias)
+	idKey := us.generateUserCacheKey(platform, userID)
+
+	senderKeys, err := us.findSenderKeys(ctx, platform, alias, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	u.Login = userID
+	u.Alias = alias
+
+	rawUser, err := json.Marshal(u)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to convert user %s to json", u.String())
+	}
+
+	keys := append([]string{aliasKey, idKey}, senderKeys...)
+
+	res, err := runner.RunScript(ctx, bindUserScript, keys, string(rawUser))
+	if err != nil {
+		return nil, err
+	}
+
+	if isBound, _ := res.(int64); isBound == 0 {
+		// a concurrent request of the same sender has bound the user already
+		return us.ReadUserFromStorage(ctx, platform, userID)
+	}
+
+	log.Infof("bound user %q to id %q, moved %d sender keys", alias, userID, len(senderKeys)/2)
+
+	return u, nil
+}
+
+// findSenderKeys gives pairs of the keys stored under the conversation ids with the alias as the sender id
+// and the keys they should be moved to, conversation ids end with "{platform}/{chat id}/{sender id}", see msg.Request
+func (us *UserStorage) findSenderKeys(ctx context.Context, platform, alias, userID string) ([]string, error) {
+	platform = strings.ToLower(platform)
+	alias = strings.ToLower(alias)
+	userID = strings.ToLower(userID)
+
+	pattern := "*/" + escapeKeyPattern(platform) + "/*/" + escapeKeyPattern(alias)
+
+	foundKeys, err := us.db.FindKeys(ctx, pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	userKey := us.generateUserCacheKey(platform, alias)
+
+	keys := make([]string, 0, len(foundKeys)*2)
+	for _, key := range foundKeys {
+		if strings.EqualFold(key, userKey) {
+			continue
+		}
+
+		prefix := strings.TrimSuffix(key, alias)
+		platformPos := strings.LastIndex(prefix, "/"+platform+"/")
+		if platformPos < 0 {
+			continue
+		}
+
+		chatID := strings.TrimSuffix(prefix[platformPos+len(platform)+2:], "/")
+		if strings.Contains(chatID, "/") {
+			continue
+		}
+
+		keys = append(keys, key, prefix+userID)
+	}
+
+	return keys, nil
+}
+
+// escapeKeyPattern makes the glob characters of a key part match literally
+func escapeKeyPattern(part string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`)
+
+	return replacer.Replace(part)
+}
+
 func (us *UserStorage) DeleteUser(ctx context.Context, u *CachedUser) error {
 	log := logrus.WithContext(ctx)
 
@@ -133,7 +270,8 @@ func NewUserMiddleware(us *UserStorage) *UserMiddleware {
 	return &UserMiddleware{us: us}
 }
 
-func (um UserMiddleware) Handle(ctx context.Context, req *msg.Request) (*msg.Response, error) {
+// Handle attaches the stored user of the sender to the request, unknown senders are bound to users by their ids
+func (um UserMiddleware) Handle(ctx context.Context, req *msg.Request, next msg.Next) (*msg.Response, error) {
 	platform := req.Platform
 	userID := req.Sender.GetID()
 
@@ -150,13 +288,29 @@ func (um UserMiddleware) Handle(ctx context.Context, req *msg.Request) (*msg.Res
 		return nil, err
 	}
 
+	alias := req.Sender.GetAlias()
 	if u == nil {
-		return nil, nil
+		u, err = um.us.bindUserToID(ctx, platform, userID, alias)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if u == nil {
+		return next(ctx, req)
+	}
+
+	if alias != "" && u.Alias != alias {
+		u.Alias = alias
+		err = um.us.WriteUserToStorage(ctx, u)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	req.Meta["curUser"] = u
 
-	return nil, nil
+	return next(ctx, req)
 }
 
 type AddUserCommand struct {
@@ -227,7 +381,7 @@ func (au *AddUserCommand) Handle(ctx context.Context, req *msg.Request) (*msg.Re
 		len(words[3]),
 	)
 
-	cachedUser, err := au.us.ReadUserFromStorage(ctx, u.PlatformName, u.Login)
+	cachedUser, err := au.us.FindUser(ctx, u.PlatformName, u.Login)
 	if err != nil {
 		return nil, err
 	}
@@ -238,6 +392,12 @@ func (au *AddUserCommand) Handle(ctx context.Context, req *msg.Request) (*msg.Re
 		}, nil
 	}
 
+	// the user is already bound to the id, so the alias shouldn't create a second account
+	if cachedUser != nil {
+		u.Login = cachedUser.Login
+		u.Alias = cachedUser.Alias
+	}
+
 	err = au.us.WriteUserToStorage(ctx, u)
 	if err != nil {
 		return nil, err
@@ -245,6 +405,8 @@ func (au *AddUserCommand) Handle(ctx context.Context, req *msg.Request) (*msg.Re
 
 	log.Debug("successfully added the user")
 
+	msg.NotifyUserChange(ctx, msg.UserChange{Platform: u.PlatformName, Login: u.Login, IsAdmin: u.Role == AdminRole})
+
 	op := &msg.Options{}
 	op.WithIsResponseToHiddenMessage()
 
@@ -264,11 +426,18 @@ func (au *AddUserCommand) GetHelp(_ context.Context, req *msg.Request) help.Resu
 
 	text := fmt.Sprintf(`%s #login# #platform# #password#: adds a new user, 
 if success the initial message will be deleted for security reasons
-to add a telegram user use your telegram user name without the at sign as #login# and 'telegram' as #platform#`, au.command)
+to add a telegram user use the telegram user name without the at sign or the numeric telegram user id as #login# and 'telegram' as #platform#,
+the user is bound to the numeric id on the first login`, au.command)
 
 	return help.Result{Text: text}
 }
 
+func (au *AddUserCommand) GetCommands() []help.Command {
+	return []help.Command{
+		{Name: au.command, Description: "add a new user: #login or id# #platform# #password#", IsAdminOnly: true},
+	}
+}
+
 type ListUsersCommand struct {
 	command       string
 	us            *UserStorage
@@ -337,6 +506,12 @@ func (lu *ListUsersCommand) GetHelp(_ context.Context, req *msg.Request) help.Re
 	return help.Result{Text: text}
 }
 
+func (lu *ListUsersCommand) GetCommands() []help.Command {
+	return []help.Command{
+		{Name: lu.command, Description: "list current users", IsAdminOnly: true},
+	}
+}
+
 type DeleteUserCommand struct {
 	command       string
 	us            *UserStorage
@@ -386,7 +561,7 @@ func (du *DeleteUserCommand) Handle(ctx context.Context, req *msg.Request) (*msg
 	}
 
 	for i, u := range users {
-		if u.UID != inputID && u.Login != inputID {
+		if u.UID != inputID && u.Login != inputID && (u.Alias == "" || !strings.EqualFold(u.Alias, inputID)) {
 			continue
 		}
 
@@ -397,6 +572,8 @@ func (du *DeleteUserCommand) Handle(ctx context.Context, req *msg.Request) (*msg
 			return nil, err
 		}
 
+		msg.NotifyUserChange(ctx, msg.UserChange{Platform: users[i].PlatformName, Login: users[i].Login})
+
 		return &msg.Response{
 			Message: fmt.Sprintf("successfully deleted user %q", inputID),
 			Type:    msg.Success,
@@ -416,7 +593,13 @@ func (du *DeleteUserCommand) GetHelp(_ context.Context, req *msg.Request) help.R
 		return help.Result{}
 	}
 
-	text := fmt.Sprintf(`%s #user id or login#: deletes the requested user`, du.command)
+	text := fmt.Sprintf(`%s #user id, login or alias#: deletes the requested user`, du.command)
 
 	return help.Result{Text: text}
 }
+
+func (du *DeleteUserCommand) GetCommands() []help.Command {
+	return []help.Command{
+		{Name: du.command, Description: "delete a user by id, login or alias", IsAdminOnly: true},
+	}
+}
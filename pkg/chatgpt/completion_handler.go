@@ -2,6 +2,8 @@ package chatgpt
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"strings"
 	"time"
 
@@ -17,6 +19,8 @@ const (
 	CompletionsURL      = URL + "/v1/chat/completions"
 	ModelsURL           = URL + "/v1/models"
 	ConversationTimeout = time.Minute * 10
+
+	ignoredEditMessage = "Only the latest message can be edited to get a new answer, please send your question as a new message."
 )
 
 type ChatCompletionHandler struct {
@@ -24,6 +28,7 @@ type ChatCompletionHandler struct {
 	settingsLoader *Loader
 	db             storage.Client
 	isScopedMode   func() bool
+	moderator      *Moderator
 }
 
 func NewChatCompletionHandler(
@@ -31,6 +36,7 @@ func NewChatCompletionHandler(
 	db storage.Client,
 	loader *Loader,
 	isScopedMode func() bool,
+	moderator *Moderator,
 ) (h *ChatCompletionHandler, err error) {
 	e := cfg.Validate()
 	if e.HasErrors() {
@@ -42,6 +48,7 @@ func NewChatCompletionHandler(
 		db:             db,
 		settingsLoader: loader,
 		isScopedMode:   isScopedMode,
+		moderator:      moderator,
 	}, nil
 }
 
@@ -113,36 +120,242 @@ func (h *ChatCompletionHandler) isConversationOutdated(conv *Conversation) bool
 }
 
 func (h *ChatCompletionHandler) Handle(ctx context.Context, req *msg.Request) (*msg.Response, error) {
-	log := logging.WithContext(ctx)
-
-	model := h.settingsLoader.LoadModel(ctx, req)
+	if req.IsInlineQuery() {
+		return h.handleInlineQuery(ctx, req)
+	}
 
 	conversation, err := h.buildConversation(ctx, req)
 	if err != nil {
 		return nil, err
 	}
+
+	if req.IsEdited() {
+		return h.handleEditedMessage(ctx, req, conversation)
+	}
+
 	conversation.Messages = append(conversation.Messages, ConversationMessage{
 		Role:      RoleUser,
 		Text:      req.Message,
 		CreatedAt: time.Now().Unix(),
+		MessageID: req.ID,
 	})
 
+	return h.answerConversation(ctx, req, conversation)
+}
+
+// handleEditedMessage regenerates the answer if the latest user message in the conversation was edited,
+// edits of older messages are ignored since the following conversation is based on their original text
+func (h *ChatCompletionHandler) handleEditedMessage(
+	ctx context.Context,
+	req *msg.Request,
+	conversation *Conversation,
+) (*msg.Response, error) {
+	log := logging.WithContext(ctx)
+
+	lastUserMsgIndex := -1
+	for i := len(conversation.Messages) - 1; i >= 0; i-- {
+		if conversation.Messages[i].Role == RoleUser {
+			lastUserMsgIndex = i
+			break
+		}
+	}
+
+	if lastUserMsgIndex < 0 || conversation.Messages[lastUserMsgIndex].MessageID != req.ID {
+		log.Debugf("message %q is not the latest user message in the conversation, will ignore its edit", req.ID)
+
+		if !h.cfg.NotifyIgnoredEdits {
+			return nil, nil
+		}
+
+		return &msg.Response{
+			Message: ignoredEditMessage,
+			Type:    msg.Error,
+		}, nil
+	}
+
+	log.Debugf("the latest user message %q was edited, will regenerate the answer", req.ID)
+
+	// the answers to the original text are dropped together with it
+	conversation.Messages = append(conversation.Messages[:lastUserMsgIndex], ConversationMessage{
+		Role:      RoleUser,
+		Text:      req.Message,
+		CreatedAt: time.Now().Unix(),
+		MessageID: req.ID,
+	})
+
+	resp, err := h.answerConversation(ctx, req, conversation)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.Options == nil {
+		resp.Options = &msg.Options{}
+	}
+	resp.Options.WithEditOriginalMessage()
+
+	return resp, nil
+}
+
+func (h *ChatCompletionHandler) answerConversation(
+	ctx context.Context,
+	req *msg.Request,
+	conversation *Conversation,
+) (*msg.Response, error) {
+	log := logging.WithContext(ctx)
+
+	model := h.settingsLoader.LoadModel(ctx, req)
+
+	msg.ReportProgress(ctx, msg.ActivityTyping)
+
+	chatResp, err := h.requestCompletion(ctx, model.GetName(), conversation, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := h.extractAnswers(chatResp)
+	if len(messages) == 0 {
+		return &msg.Response{
+			Message: "Didn't get any response from ChatGPT completion API",
+			Type:    msg.Error,
+		}, nil
+	}
+
+	for _, message := range messages {
+		conversation.Messages = append(conversation.Messages, ConversationMessage{
+			Role:      RoleAssistant,
+			Text:      message,
+			CreatedAt: chatResp.CreatedAt,
+		})
+	}
+
+	answer := strings.Join(messages, "/n")
+
+	isBlocked, err := h.isAnswerBlocked(ctx, req, answer)
+	if err != nil {
+		return nil, err
+	}
+
+	if isBlocked {
+		return &msg.Response{
+			Message: moderationRefusalMessage,
+			Type:    msg.Error,
+		}, nil
+	}
+
+	err = h.db.Save(ctx, getConversationKey(req), conversation, defaultConversationValidity)
+	if err != nil {
+		log.Error(err)
+	}
+
+	return h.buildAnswerResponse(answer), nil
+}
+
+// handleInlineQuery answers without the conversation history and with a limited number of tokens,
+// answers are cached since users tend to repeat inline queries
+func (h *ChatCompletionHandler) handleInlineQuery(ctx context.Context, req *msg.Request) (*msg.Response, error) {
+	log := logging.WithContext(ctx)
+
+	model := h.settingsLoader.LoadModel(ctx, req)
+
+	conversationContext, err := h.buildConversationContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cacheKey := getInlineAnswerKey(model.GetName(), conversationContext.GetMessage(), req.Message)
+	cachedAnswer := new(InlineAnswer)
+	found, err := h.db.Load(ctx, cacheKey, cachedAnswer)
+	if err != nil {
+		log.Error(err)
+	} else if found {
+		log.Debugf("found cached inline answer under %q", cacheKey)
+		return h.buildAnswerResponse(cachedAnswer.Text), nil
+	}
+
+	conversation := &Conversation{
+		ID:      req.GetConversationID(),
+		Context: conversationContext,
+		Messages: []ConversationMessage{
+			{
+				Role:      RoleUser,
+				Text:      req.Message,
+				CreatedAt: time.Now().Unix(),
+			},
+		},
+	}
+
+	chatResp, err := h.requestCompletion(ctx, model.GetName(), conversation, h.cfg.InlineMaxTokens)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := h.extractAnswers(chatResp)
+	if len(messages) == 0 {
+		return &msg.Response{
+			Message: "Didn't get any response from ChatGPT completion API",
+			Type:    msg.Error,
+		}, nil
+	}
+
+	answer := strings.Join(messages, "/n")
+
+	isBlocked, err := h.isAnswerBlocked(ctx, req, answer)
+	if err != nil {
+		return nil, err
+	}
+
+	if isBlocked {
+		return &msg.Response{
+			Message: moderationRefusalMessage,
+			Type:    msg.Error,
+		}, nil
+	}
+
+	err = h.db.Save(ctx, cacheKey, &InlineAnswer{Text: answer}, h.cfg.InlineCacheValidity)
+	if err != nil {
+		log.Error(err)
+	}
+
+	return h.buildAnswerResponse(answer), nil
+}
+
+func getInlineAnswerKey(model, conversationContext, query string) string {
+	hash := sha256.Sum256([]byte(model + "\n" + conversationContext + "\n" + strings.TrimSpace(query)))
+
+	return storage.GenerateCacheKey(conversationVersion, "chatgpt", "inline_answer", hex.EncodeToString(hash[:]))
+}
+
+// requestCompletion calls ChatGPT completion API, maxTokens limits the answer length if positive
+func (h *ChatCompletionHandler) requestCompletion(
+	ctx context.Context,
+	model string,
+	conversation *Conversation,
+	maxTokens int,
+) (*ChatCompletionResponse, error) {
 	requestData := map[string]interface{}{
-		"model":    model.GetName(),
+		"model":    model,
 		"messages": conversation.ToRaw(),
 	}
 
+	if maxTokens > 0 {
+		requestData["max_tokens"] = maxTokens
+	}
+
 	chatResp := new(ChatCompletionResponse)
 	reqsr := rest.NewRequester(CompletionsURL, chatResp)
 	reqsr.WithBearer(h.cfg.APIKey)
 	reqsr.WithPOST()
 	reqsr.WithInput(requestData)
 
-	err = reqsr.Request(ctx)
+	err := reqsr.Request(ctx)
 	if err != nil {
 		return nil, err
 	}
 
+	return chatResp, nil
+}
+
+func (h *ChatCompletionHandler) extractAnswers(chatResp *ChatCompletionResponse) []string {
 	messages := make([]string, 0, len(chatResp.Choices))
 	for i := range chatResp.Choices {
 		choice := chatResp.Choices[i]
@@ -151,29 +364,33 @@ func (h *ChatCompletionHandler) Handle(ctx context.Context, req *msg.Request) (*
 		}
 
 		messages = append(messages, choice.Message.Content)
-		conversation.Messages = append(conversation.Messages, ConversationMessage{
-			Role:      RoleAssistant,
-			Text:      choice.Message.Content,
-			CreatedAt: chatResp.CreatedAt,
-		})
 	}
 
-	if len(messages) == 0 {
-		return &msg.Response{
-			Message: "Didn't get any response from ChatGPT completion API",
-			Type:    msg.Error,
-		}, nil
+	return messages
+}
+
+func (h *ChatCompletionHandler) buildAnswerResponse(answer string) *msg.Response {
+	opts := &msg.Options{}
+	opts.WithFormat(msg.OutputFormatMarkdown)
+
+	return &msg.Response{
+		Message: answer,
+		Type:    msg.Success,
+		Options: opts,
 	}
+}
 
-	err = h.db.Save(ctx, getConversationKey(req), conversation, defaultConversationValidity)
+func (h *ChatCompletionHandler) isAnswerBlocked(ctx context.Context, req *msg.Request, answer string) (bool, error) {
+	if h.moderator == nil || !h.cfg.ModerationEnabled || h.cfg.ModerationAnswerPolicy == ModerationPolicyOff {
+		return false, nil
+	}
+
+	isBlocked, err := h.moderator.IsBlocked(ctx, req, answer, moderationSourceAnswer)
 	if err != nil {
-		log.Error(err)
+		return false, err
 	}
 
-	return &msg.Response{
-		Message: strings.Join(messages, "/n"),
-		Type:    msg.Success,
-	}, nil
+	return isBlocked && h.cfg.ModerationAnswerPolicy == ModerationPolicyBlock, nil
 }
 
 func (h *ChatCompletionHandler) CanHandle(context.Context, *msg.Request) (bool, error) {
@@ -1,16 +1,33 @@
 package chatgpt
 
 import (
+	"time"
+
 	"github.com/kelseyhightower/envconfig"
 	"github.com/pkg/errors"
 
 	"breathbathChatGPT/pkg/errs"
 )
 
+const (
+	ModerationPolicyOff   = "off"
+	ModerationPolicyLog   = "log"
+	ModerationPolicyBlock = "block"
+)
+
 type Config struct {
 	APIKey       string `envconfig:"CHATGPT_API_KEY"`
 	DefaultModel string `envconfig:"CHATGPT_DEFAULT_MODEL"`
 	ScopedMode   bool   `envconfig:"CHATGPT_SCOPED_MODE"`
+
+	InlineMaxTokens     int           `envconfig:"CHATGPT_INLINE_MAX_TOKENS" default:"300"`
+	InlineCacheValidity time.Duration `envconfig:"CHATGPT_INLINE_CACHE_VALIDITY" default:"10m"`
+
+	NotifyIgnoredEdits bool `envconfig:"CHATGPT_NOTIFY_IGNORED_EDITS" default:"true"`
+
+	ModerationEnabled           bool     `envconfig:"CHATGPT_MODERATION_ENABLED"`
+	ModerationBlockedCategories []string `envconfig:"CHATGPT_MODERATION_BLOCKED_CATEGORIES"`
+	ModerationAnswerPolicy      string   `envconfig:"CHATGPT_MODERATION_ANSWER_POLICY" default:"off"`
 }
 
 func (c *Config) Validate() *errs.Multi {
@@ -23,6 +40,22 @@ func (c *Config) Validate() *errs.Multi {
 		e.Errf("CHATGPT_DEFAULT_MODEL cannot be empty")
 	}
 
+	if c.InlineMaxTokens <= 0 {
+		e.Errf("CHATGPT_INLINE_MAX_TOKENS should be positive, got %d", c.InlineMaxTokens)
+	}
+
+	switch c.ModerationAnswerPolicy {
+	case ModerationPolicyOff, ModerationPolicyLog, ModerationPolicyBlock:
+	default:
+		e.Errf(
+			"CHATGPT_MODERATION_ANSWER_POLICY should be one of %q, %q, %q, got %q",
+			ModerationPolicyOff,
+			ModerationPolicyLog,
+			ModerationPolicyBlock,
+			c.ModerationAnswerPolicy,
+		)
+	}
+
 	return e
 }
 
@@ -136,6 +136,12 @@ func (sc *SetConversationContextHandler) GetHelp(context.Context, *msg.Request)
 	return help.Result{Text: text}
 }
 
+func (sc *SetConversationContextHandler) GetCommands() []help.Command {
+	return []help.Command{
+		{Name: sc.command, Description: "set context for the current conversation", IsAdminOnly: sc.isScopedMode()},
+	}
+}
+
 type ResetConversationHandler struct {
 	command       string
 	db            storage.Client
@@ -204,3 +210,9 @@ func (sc *ResetConversationHandler) GetHelp(context.Context, *msg.Request) help.
 
 	return help.Result{Text: text, PredefinedOption: sc.command}
 }
+
+func (sc *ResetConversationHandler) GetCommands() []help.Command {
+	return []help.Command{
+		{Name: sc.command, Description: "reset your conversation", IsAdminOnly: sc.modeDetector()},
+	}
+}
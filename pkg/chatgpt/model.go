@@ -1,6 +1,9 @@
 package chatgpt
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"sort"
+)
 
 type ChatCompletionResponse struct {
 	ID         string                   `json:"id"`
@@ -85,6 +88,8 @@ type ConversationMessage struct {
 	Role      Role
 	Text      string
 	CreatedAt int64
+	// MessageID is the platform id of the user message, it allows to find the message when it's edited
+	MessageID string
 }
 
 type Context struct {
@@ -132,3 +137,50 @@ func (c Conversation) ToRaw() []map[string]interface{} {
 
 	return convResp
 }
+
+type InlineAnswer struct {
+	Text string
+}
+
+type ModerationResponse struct {
+	ID      string             `json:"id"`
+	Model   string             `json:"model"`
+	Results []ModerationResult `json:"results"`
+}
+
+type ModerationResult struct {
+	Flagged        bool               `json:"flagged"`
+	Categories     map[string]bool    `json:"categories"`
+	CategoryScores map[string]float64 `json:"category_scores"`
+}
+
+func (mr *ModerationResult) GetFlaggedCategories() []string {
+	if mr == nil {
+		return nil
+	}
+
+	categories := make([]string, 0, len(mr.Categories))
+	for category, isFlagged := range mr.Categories {
+		if isFlagged {
+			categories = append(categories, category)
+		}
+	}
+	sort.Strings(categories)
+
+	return categories
+}
+
+type ModerationSettings struct {
+	BlockedCategories []string
+}
+
+type ModerationAuditEntry struct {
+	Source         string
+	Platform       string
+	SenderID       string
+	ConversationID string
+	Text           string
+	Categories     []string
+	IsBlocked      bool
+	CreatedAt      int64
+}
@@ -125,9 +125,15 @@ func (smc *SetModelHandler) Handle(ctx context.Context, req *msg.Request) (*msg.
 
 	log.Debugf("saved current model setting %q", modelName)
 
+	opts := &msg.Options{}
+	if req.IsCallback() {
+		opts.WithCallbackAnswer(fmt.Sprintf("Switched to %s", modelName), false)
+	}
+
 	return &msg.Response{
 		Message: fmt.Sprintf("successfully set the current model for all requests to %q", modelName),
 		Type:    msg.Success,
+		Options: opts,
 	}, nil
 }
 
@@ -137,6 +143,12 @@ func (smc *SetModelHandler) GetHelp(context.Context, *msg.Request) help.Result {
 	return help.Result{Text: text}
 }
 
+func (smc *SetModelHandler) GetCommands() []help.Command {
+	return []help.Command{
+		{Name: smc.commands[1], Description: "change the active ChatGPT model", IsAdminOnly: smc.modeDetector()},
+	}
+}
+
 func (smc *SetModelHandler) isModelSupported(ctx context.Context, modelName string) (bool, error) {
 	supportedModelIDs, err := smc.getSupportedModelIDs(ctx)
 	if err != nil {
@@ -204,13 +216,15 @@ func (gmc *GetModelsCommand) Handle(ctx context.Context, req *msg.Request) (*msg
 	currentModel := gmc.loader.LoadModel(ctx, req)
 
 	opts := &msg.Options{}
-	opts.WithIsTempPredefinedResponse()
 	opts.WithFormat(msg.OutputFormatHTML)
 
 	sort.Strings(modelIDs)
 	for i, modelID := range modelIDs {
 		if strings.HasPrefix(modelID, "gpt-") {
-			opts.WithPredefinedResponse(fmt.Sprintf("/model %s", modelID))
+			opts.WithInlineButtonsRow(msg.InlineButton{
+				Text: modelID,
+				Data: fmt.Sprintf("/model %s", modelID),
+			})
 		}
 
 		if modelID == currentModel.GetName() {
@@ -232,3 +246,9 @@ func (gmc *GetModelsCommand) GetHelp(context.Context, *msg.Request) help.Result
 
 	return help.Result{Text: text, PredefinedOption: gmc.command}
 }
+
+func (gmc *GetModelsCommand) GetCommands() []help.Command {
+	return []help.Command{
+		{Name: gmc.command, Description: "get the list of supported ChatGPT models", IsAdminOnly: gmc.modeDetector()},
+	}
+}
@@ -0,0 +1,282 @@
+package chatgpt
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"breathbathChatGPT/pkg/help"
+	"breathbathChatGPT/pkg/msg"
+	"breathbathChatGPT/pkg/rest"
+	"breathbathChatGPT/pkg/storage"
+	"breathbathChatGPT/pkg/utils"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	ModerationsURL = URL + "/v1/moderations"
+
+	moderationVersion        = "v1"
+	moderationAuditValidity  = time.Hour * 24 * 30
+	moderationSourcePrompt   = "prompt"
+	moderationSourceAnswer   = "answer"
+	moderationAllCategories  = "all"
+	moderationRefusalMessage = "Sorry, I cannot help with this request as it violates the usage policy of this bot. " +
+		"Please rephrase your message and try again."
+)
+
+type Moderator struct {
+	cfg *Config
+	db  storage.Client
+}
+
+func NewModerator(cfg *Config, db storage.Client) *Moderator {
+	return &Moderator{
+		cfg: cfg,
+		db:  db,
+	}
+}
+
+func getModerationSettingsKey() string {
+	return storage.GenerateCacheKey(moderationVersion, "chatgpt", "moderation_settings")
+}
+
+func getModerationAuditKey(req *msg.Request) string {
+	return storage.GenerateCacheKey(
+		moderationVersion,
+		"chatgpt",
+		"moderation_audit",
+		req.GetConversationID(),
+		fmt.Sprint(time.Now().UnixNano()),
+	)
+}
+
+// LoadBlockedCategories gives the categories set by admin, falls back to the configured ones,
+// an empty list means that any flagged category is blocked
+func (m *Moderator) LoadBlockedCategories(ctx context.Context) []string {
+	log := logrus.WithContext(ctx)
+
+	settings := new(ModerationSettings)
+	found, err := m.db.Load(ctx, getModerationSettingsKey(), settings)
+	if err != nil {
+		log.Error(err)
+		return m.cfg.ModerationBlockedCategories
+	}
+
+	if !found {
+		return m.cfg.ModerationBlockedCategories
+	}
+
+	return settings.BlockedCategories
+}
+
+func (m *Moderator) SaveBlockedCategories(ctx context.Context, categories []string) error {
+	return m.db.Save(ctx, getModerationSettingsKey(), &ModerationSettings{BlockedCategories: categories}, 0)
+}
+
+func (m *Moderator) moderate(ctx context.Context, text string) (*ModerationResult, error) {
+	moderationResp := new(ModerationResponse)
+	reqsr := rest.NewRequester(ModerationsURL, moderationResp)
+	reqsr.WithBearer(m.cfg.APIKey)
+	reqsr.WithPOST()
+	reqsr.WithInput(map[string]interface{}{
+		"input": text,
+	})
+
+	err := reqsr.Request(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(moderationResp.Results) == 0 {
+		return &ModerationResult{}, nil
+	}
+
+	return &moderationResp.Results[0], nil
+}
+
+// IsBlocked checks the text against the moderation API, writes an audit entry for any flagged text
+// and returns true if one of the flagged categories is blocked
+func (m *Moderator) IsBlocked(ctx context.Context, req *msg.Request, text, source string) (bool, error) {
+	log := logrus.WithContext(ctx)
+
+	res, err := m.moderate(ctx, text)
+	if err != nil {
+		return false, err
+	}
+
+	if !res.Flagged {
+		return false, nil
+	}
+
+	flaggedCategories := res.GetFlaggedCategories()
+	isBlocked := m.matchesBlockedCategories(ctx, flaggedCategories)
+
+	log.Warnf(
+		"moderation flagged %s of %q in categories %v, blocked: %v",
+		source,
+		req.Sender.GetID(),
+		flaggedCategories,
+		isBlocked,
+	)
+
+	m.audit(ctx, req, &ModerationAuditEntry{
+		Source:         source,
+		Platform:       req.Platform,
+		SenderID:       req.Sender.GetID(),
+		ConversationID: req.GetConversationID(),
+		Text:           text,
+		Categories:     flaggedCategories,
+		IsBlocked:      isBlocked,
+		CreatedAt:      time.Now().Unix(),
+	})
+
+	return isBlocked, nil
+}
+
+func (m *Moderator) matchesBlockedCategories(ctx context.Context, flaggedCategories []string) bool {
+	blockedCategories := m.LoadBlockedCategories(ctx)
+	if len(blockedCategories) == 0 {
+		return true
+	}
+
+	for _, flaggedCategory := range flaggedCategories {
+		for _, blockedCategory := range blockedCategories {
+			if strings.EqualFold(flaggedCategory, blockedCategory) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (m *Moderator) audit(ctx context.Context, req *msg.Request, entry *ModerationAuditEntry) {
+	log := logrus.WithContext(ctx)
+
+	ctxValue := context.WithValue(ctx, storage.IsNotLoggableContentCtxKey, true)
+	err := m.db.Save(ctxValue, getModerationAuditKey(req), entry, moderationAuditValidity)
+	if err != nil {
+		log.Errorf("failed to write moderation audit entry: %v", err)
+	}
+}
+
+type ModerationMiddleware struct {
+	moderator    *Moderator
+	isAuthorized func(req *msg.Request) bool
+}
+
+func NewModerationMiddleware(moderator *Moderator, isAuthorized func(req *msg.Request) bool) *ModerationMiddleware {
+	return &ModerationMiddleware{
+		moderator:    moderator,
+		isAuthorized: isAuthorized,
+	}
+}
+
+func (mm *ModerationMiddleware) Handle(ctx context.Context, req *msg.Request, next msg.Next) (*msg.Response, error) {
+	// commands and login attempts never reach the completion API, so they are not moderated
+	if req.Message == "" || strings.HasPrefix(req.Message, msg.CommandPrefix) || !mm.isAuthorized(req) {
+		return next(ctx, req)
+	}
+
+	isBlocked, err := mm.moderator.IsBlocked(ctx, req, req.Message, moderationSourcePrompt)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isBlocked {
+		return next(ctx, req)
+	}
+
+	return &msg.Response{
+		Message: moderationRefusalMessage,
+		Type:    msg.Error,
+	}, nil
+}
+
+type ModerationCommand struct {
+	command       string
+	moderator     *Moderator
+	adminDetector func(req *msg.Request) bool
+}
+
+func NewModerationCommand(moderator *Moderator, adminDetector func(req *msg.Request) bool) *ModerationCommand {
+	return &ModerationCommand{
+		command:       "/moderation",
+		moderator:     moderator,
+		adminDetector: adminDetector,
+	}
+}
+
+func (mc *ModerationCommand) CanHandle(_ context.Context, req *msg.Request) (bool, error) {
+	if !utils.MatchesCommand(req.Message, mc.command) {
+		return false, nil
+	}
+
+	return mc.adminDetector(req), nil
+}
+
+func (mc *ModerationCommand) Handle(ctx context.Context, req *msg.Request) (*msg.Response, error) {
+	log := logrus.WithContext(ctx)
+
+	categoriesInput := utils.ExtractCommandValue(req.Message, mc.command)
+	if categoriesInput == "" {
+		return &msg.Response{
+			Message: fmt.Sprintf("Blocked moderation categories: %s", mc.formatCategories(mc.moderator.LoadBlockedCategories(ctx))),
+			Type:    msg.Success,
+		}, nil
+	}
+
+	categories := []string{}
+	if categoriesInput != moderationAllCategories {
+		for _, category := range strings.Split(categoriesInput, ",") {
+			category = strings.TrimSpace(category)
+			if category != "" {
+				categories = append(categories, category)
+			}
+		}
+	}
+
+	err := mc.moderator.SaveBlockedCategories(ctx, categories)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debugf("saved blocked moderation categories %v", categories)
+
+	return &msg.Response{
+		Message: fmt.Sprintf("Successfully set blocked moderation categories: %s", mc.formatCategories(categories)),
+		Type:    msg.Success,
+	}, nil
+}
+
+func (mc *ModerationCommand) formatCategories(categories []string) string {
+	if len(categories) == 0 {
+		return "all flagged categories"
+	}
+
+	return strings.Join(categories, ", ")
+}
+
+func (mc *ModerationCommand) GetHelp(_ context.Context, req *msg.Request) help.Result {
+	if !mc.adminDetector(req) {
+		return help.Result{}
+	}
+
+	text := fmt.Sprintf(
+		"%s #categories#: to block prompts and answers flagged in the comma separated moderation categories, "+
+			"e.g. hate,violence, use '%s' to block any flagged category, call without value to see the current setting",
+		mc.command,
+		moderationAllCategories,
+	)
+
+	return help.Result{Text: text}
+}
+
+func (mc *ModerationCommand) GetCommands() []help.Command {
+	return []help.Command{
+		{Name: mc.command, Description: "show or set blocked moderation categories", IsAdminOnly: true},
+	}
+}
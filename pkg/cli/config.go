@@ -0,0 +1,47 @@
+package cli
+
+import (
+	"github.com/kelseyhightower/envconfig"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"breathbathChatGPT/pkg/errs"
+)
+
+type Config struct {
+	User           string `envconfig:"CLI_USER"`
+	ConversationID string `envconfig:"CLI_CONVERSATION_ID" default:"cli"`
+	HistoryFile    string `envconfig:"CLI_HISTORY_FILE" default:".bgpt_history"`
+	LogLevel       string `envconfig:"CLI_LOG_LEVEL" default:"warning"`
+	NoColor        bool   `envconfig:"NO_COLOR"`
+}
+
+func (c *Config) Validate() *errs.Multi {
+	e := errs.NewMulti()
+
+	if c.User == "" {
+		e.Errf("CLI_USER cannot be empty, it should be a login of a user with platform %q in AUTH_USERS", Platform)
+	}
+
+	if c.ConversationID == "" {
+		e.Errf("CLI_CONVERSATION_ID cannot be empty")
+	}
+
+	_, err := logrus.ParseLevel(c.LogLevel)
+	if err != nil {
+		e.Errf("CLI_LOG_LEVEL is invalid: %v", err)
+	}
+
+	return e
+}
+
+func LoadConfig() (cfg *Config, err error) {
+	cfg = new(Config)
+
+	err = envconfig.Process("cli", cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load cli config")
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,100 @@
+package cli
+
+import (
+	"strings"
+
+	"breathbathChatGPT/pkg/markdown"
+)
+
+const (
+	ansiReset     = "\033[0m"
+	ansiBold      = "\033[1m"
+	ansiDim       = "\033[2m"
+	ansiItalic    = "\033[3m"
+	ansiUnderline = "\033[4m"
+	ansiStrike    = "\033[9m"
+	ansiRed       = "\033[31m"
+	ansiGreen     = "\033[32m"
+	ansiYellow    = "\033[33m"
+	ansiCyan      = "\033[36m"
+)
+
+const (
+	horizontalRule = "──────────"
+	codeIndent     = "    "
+)
+
+// markdownRenderer renders Markdown produced by the model with ANSI escape codes, without colors
+// only the markup characters are removed
+type markdownRenderer struct {
+	isColored bool
+}
+
+func (mr *markdownRenderer) style(text string, codes ...string) string {
+	if !mr.isColored || text == "" {
+		return text
+	}
+
+	return strings.Join(codes, "") + text + ansiReset
+}
+
+func (mr *markdownRenderer) render(text string) string {
+	return markdown.Render(text, mr)
+}
+
+// Text is written as is, terminals have no markup to escape
+func (mr *markdownRenderer) Text(text string) string {
+	return text
+}
+
+func (mr *markdownRenderer) Bold(text string) string {
+	return mr.style(text, ansiBold)
+}
+
+func (mr *markdownRenderer) Italic(text string) string {
+	return mr.style(text, ansiItalic)
+}
+
+func (mr *markdownRenderer) Strikethrough(text string) string {
+	return mr.style(text, ansiStrike)
+}
+
+func (mr *markdownRenderer) Code(code string) string {
+	return mr.style(code, ansiCyan)
+}
+
+func (mr *markdownRenderer) Link(text, url string) string {
+	return mr.style(text, ansiUnderline) + " (" + mr.style(url, ansiDim) + ")"
+}
+
+func (mr *markdownRenderer) CodeBlock(code, lang string) string {
+	lines := strings.Split(code, "\n")
+	res := make([]string, 0, len(lines)+1)
+
+	if lang != "" {
+		res = append(res, mr.style(lang, ansiDim))
+	}
+
+	for _, line := range lines {
+		res = append(res, codeIndent+mr.style(line, ansiCyan))
+	}
+
+	return strings.Join(res, "\n")
+}
+
+func (mr *markdownRenderer) Heading(text string, _ int) string {
+	return mr.style(text, ansiBold, ansiUnderline)
+}
+
+func (mr *markdownRenderer) Blockquote(text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = mr.style("│ ", ansiDim) + mr.style(line, ansiItalic)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func (mr *markdownRenderer) ThematicBreak() string {
+	return mr.style(horizontalRule, ansiDim)
+}
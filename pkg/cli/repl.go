@@ -0,0 +1,427 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"breathbathChatGPT/pkg/auth"
+	"breathbathChatGPT/pkg/help"
+	"breathbathChatGPT/pkg/msg"
+
+	"github.com/peterh/liner"
+	"github.com/pkg/errors"
+	logging "github.com/sirupsen/logrus"
+)
+
+const (
+	Platform = "cli"
+
+	prompt             = "you> "
+	continuationPrompt = "...> "
+	multiLineDelimiter = `"""`
+	lineContinuation   = `\`
+)
+
+var exitCommands = []string{"/exit", "/quit"}
+
+// REPL runs the message router in the terminal for the configured local user
+type REPL struct {
+	cfg        *Config
+	msgHandler *msg.Router
+	us         *auth.UserStorage
+	line       *liner.State
+	out        io.Writer
+	renderer   *markdownRenderer
+	msgCounter int64
+}
+
+func NewREPL(cfg *Config, r *msg.Router, us *auth.UserStorage) (*REPL, error) {
+	e := cfg.Validate()
+	if e.HasErrors() {
+		return nil, e
+	}
+
+	return &REPL{
+		cfg:        cfg,
+		msgHandler: r,
+		us:         us,
+		out:        os.Stdout,
+		renderer:   &markdownRenderer{isColored: !cfg.NoColor && isTerminal(os.Stdout)},
+	}, nil
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+func (r *REPL) getHistoryPath() string {
+	if filepath.IsAbs(r.cfg.HistoryFile) {
+		return r.cfg.HistoryFile
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return r.cfg.HistoryFile
+	}
+
+	return filepath.Join(homeDir, r.cfg.HistoryFile)
+}
+
+func (r *REPL) loadHistory() {
+	f, err := os.Open(r.getHistoryPath())
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	_, err = r.line.ReadHistory(f)
+	if err != nil {
+		logging.Warnf("failed to read cli history: %v", err)
+	}
+}
+
+func (r *REPL) saveHistory() {
+	f, err := os.Create(r.getHistoryPath())
+	if err != nil {
+		logging.Warnf("failed to write cli history: %v", err)
+		return
+	}
+	defer f.Close()
+
+	_, err = r.line.WriteHistory(f)
+	if err != nil {
+		logging.Warnf("failed to write cli history: %v", err)
+	}
+}
+
+// getCommands gives the commands of the router handlers for the tab completion
+func (r *REPL) getCommands() []string {
+	commands := append([]string{}, exitCommands...)
+	for _, h := range r.msgHandler.Handlers {
+		provider, ok := h.(help.CommandsProvider)
+		if !ok {
+			continue
+		}
+
+		for _, c := range provider.GetCommands() {
+			commands = append(commands, c.Name)
+		}
+	}
+
+	return commands
+}
+
+func (r *REPL) complete(input string) []string {
+	if !strings.HasPrefix(input, msg.CommandPrefix) || strings.Contains(input, " ") {
+		return nil
+	}
+
+	res := []string{}
+	for _, c := range r.getCommands() {
+		if strings.HasPrefix(c, input) {
+			res = append(res, c)
+		}
+	}
+
+	return res
+}
+
+// Run reads the user input till an exit command or EOF
+func (r *REPL) Run() error {
+	r.line = liner.NewLiner()
+	defer r.line.Close()
+
+	r.line.SetCtrlCAborts(true)
+	r.line.SetCompleter(r.complete)
+
+	r.loadHistory()
+	defer r.saveHistory()
+
+	err := r.login()
+	if err != nil {
+		return err
+	}
+
+	r.printf("Type your message, %s to start and end a multi-line message, %s to exit\n",
+		multiLineDelimiter, strings.Join(exitCommands, " or "))
+
+	for {
+		input, err := r.readInput()
+		if errors.Is(err, io.EOF) {
+			r.printf("\n")
+			return nil
+		}
+		if errors.Is(err, liner.ErrPromptAborted) {
+			continue
+		}
+		if err != nil {
+			return errors.Wrap(err, "failed to read input")
+		}
+
+		if input == "" {
+			continue
+		}
+
+		for _, exitCommand := range exitCommands {
+			if input == exitCommand {
+				return nil
+			}
+		}
+
+		r.send(input)
+	}
+}
+
+// login asks for the password of the local user if the session is not active, the password is checked by the router
+func (r *REPL) login() error {
+	ctx := context.Background()
+
+	user, err := r.us.ReadUserFromStorage(ctx, Platform, r.cfg.User)
+	if err != nil {
+		return err
+	}
+
+	if user == nil {
+		return errors.Errorf("user %q with platform %q is not found, please add it to AUTH_USERS", r.cfg.User, Platform)
+	}
+
+	for !user.IsLoggedIn() {
+		password, err := r.line.PasswordPrompt(fmt.Sprintf("password for %s: ", r.cfg.User))
+		if err != nil {
+			return errors.Wrap(err, "failed to read password")
+		}
+
+		r.send(password)
+
+		user, err = r.us.ReadUserFromStorage(ctx, Platform, r.cfg.User)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readInput reads one message, lines ending with a backslash and lines between triple quotes are joined
+func (r *REPL) readInput() (string, error) {
+	line, err := r.line.Prompt(prompt)
+	if err != nil {
+		return "", err
+	}
+
+	lines := []string{}
+	isMultiLine := strings.TrimSpace(line) == multiLineDelimiter
+	if !isMultiLine {
+		lines = append(lines, strings.TrimSuffix(line, lineContinuation))
+	}
+
+	for isMultiLine || strings.HasSuffix(line, lineContinuation) {
+		line, err = r.line.Prompt(continuationPrompt)
+		if err != nil {
+			return "", err
+		}
+
+		if isMultiLine && strings.TrimSpace(line) == multiLineDelimiter {
+			break
+		}
+
+		if isMultiLine {
+			lines = append(lines, line)
+		} else {
+			lines = append(lines, strings.TrimSuffix(line, lineContinuation))
+		}
+	}
+
+	input := strings.TrimSpace(strings.Join(lines, "\n"))
+	if input != "" {
+		r.line.AppendHistory(input)
+	}
+
+	return input, nil
+}
+
+func (r *REPL) buildRequest(text string) *msg.Request {
+	return &msg.Request{
+		Platform: Platform,
+		ID:       fmt.Sprint(atomic.AddInt64(&r.msgCounter, 1)),
+		Sender: &msg.Sender{
+			ID: r.cfg.User,
+		},
+		Message: text,
+		Meta: map[string]interface{}{
+			"conversation_id": r.cfg.ConversationID,
+			"timestamp":       time.Now().Unix(),
+		},
+	}
+}
+
+// send routes the message, Ctrl+C cancels the request in progress instead of stopping the program
+func (r *REPL) send(text string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+
+	go func() {
+		select {
+		case <-interrupts:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	reporter := &progressReporter{out: r.out, renderer: r.renderer}
+	resp, err := r.msgHandler.Route(msg.WithProgressReporter(ctx, reporter.Report), r.buildRequest(text))
+	reporter.Clear()
+
+	if ctx.Err() != nil {
+		r.printf("%s\n", r.renderer.style("canceled", ansiYellow))
+		return
+	}
+
+	if err != nil {
+		logging.Error(err)
+		r.printf("%s\n", r.renderer.style("Unexpected error: "+err.Error(), ansiRed))
+		return
+	}
+
+	r.printResponse(resp)
+}
+
+func (r *REPL) printResponse(resp *msg.Response) {
+	if resp == nil {
+		return
+	}
+
+	if resp.Message != "" {
+		text := resp.Message
+		if resp.Options.GetFormat() != msg.OutputFormatUndefined {
+			text = r.renderer.render(text)
+		}
+
+		if resp.Type == msg.Error {
+			text = r.renderer.style(text, ansiRed)
+		}
+
+		r.printf("%s\n", text)
+	}
+
+	r.printButtons(resp.Options)
+
+	for i := range resp.Attachments {
+		r.printAttachment(&resp.Attachments[i])
+	}
+}
+
+// printButtons lists the buttons of the response, their data can be typed as a message
+func (r *REPL) printButtons(opts *msg.Options) {
+	options := []string{}
+	for _, row := range opts.GetInlineButtons() {
+		for _, b := range row {
+			switch {
+			case b.URL != "":
+				options = append(options, b.Text+" ("+b.URL+")")
+			case b.Data != "":
+				options = append(options, b.Data)
+			}
+		}
+	}
+
+	for _, predefinedResp := range opts.GetPredefinedResponses() {
+		if predefinedResp != "" {
+			options = append(options, string(predefinedResp))
+		}
+	}
+
+	for _, option := range options {
+		r.printf("  %s %s\n", r.renderer.style(">", ansiGreen), option)
+	}
+}
+
+// printAttachment stores the attachment content in a temp file, so it can be opened from the terminal
+func (r *REPL) printAttachment(a *msg.Attachment) {
+	location := a.URL
+	if location == "" && len(a.Data) > 0 {
+		f, err := os.CreateTemp("", "bgpt-*-"+filepath.Base(a.FileName))
+		if err != nil {
+			logging.Errorf("failed to store attachment %q: %v", a.FileName, err)
+			return
+		}
+		defer f.Close()
+
+		_, err = f.Write(a.Data)
+		if err != nil {
+			logging.Errorf("failed to store attachment %q: %v", a.FileName, err)
+			return
+		}
+		location = f.Name()
+	}
+
+	r.printf("%s %s %s\n", r.renderer.style("attachment:", ansiDim), a.FileName, location)
+	if a.Caption != "" {
+		r.printf("%s\n", a.Caption)
+	}
+}
+
+func (r *REPL) printf(format string, args ...interface{}) {
+	_, err := fmt.Fprintf(r.out, format, args...)
+	if err != nil {
+		logging.Errorf("failed to write to terminal: %v", err)
+	}
+}
+
+// progressReporter shows the activity of the handler till the response is printed
+type progressReporter struct {
+	out      io.Writer
+	renderer *markdownRenderer
+	isShown  atomic.Bool
+}
+
+func (pr *progressReporter) Report(_ context.Context, activity msg.Activity) {
+	if !pr.isShown.CompareAndSwap(false, true) {
+		return
+	}
+
+	_, _ = fmt.Fprintf(pr.out, "%s", pr.renderer.style(activityToText(activity)+"...", ansiDim))
+}
+
+func (pr *progressReporter) Clear() {
+	if !pr.isShown.Load() {
+		return
+	}
+
+	if pr.renderer.isColored {
+		_, _ = fmt.Fprint(pr.out, "\r\033[K")
+	} else {
+		_, _ = fmt.Fprintln(pr.out)
+	}
+}
+
+func activityToText(activity msg.Activity) string {
+	switch activity {
+	case msg.ActivityTyping:
+		return "typing"
+	case msg.ActivityUploadingPhoto:
+		return "uploading photo"
+	case msg.ActivityUploadingDocument:
+		return "uploading document"
+	case msg.ActivityUploadingAudio:
+		return "uploading audio"
+	default:
+		return "working"
+	}
+}
@@ -1,10 +1,16 @@
 package cmd
 
 import (
+	"strings"
+
+	"github.com/pkg/errors"
+
 	"breathbathChatGPT/pkg/auth"
 	"breathbathChatGPT/pkg/chatgpt"
 	"breathbathChatGPT/pkg/help"
 	"breathbathChatGPT/pkg/msg"
+	"breathbathChatGPT/pkg/queue"
+	"breathbathChatGPT/pkg/ratelimit"
 	"breathbathChatGPT/pkg/storage"
 	"breathbathChatGPT/pkg/telegram"
 )
@@ -32,9 +38,8 @@ func BuildMessageRouter(db storage.Client) (*msg.Router, error) {
 		return chartGptCfg.ScopedMode
 	}
 
-	isAdminDetector := func(req *msg.Request) bool {
-		usr := auth.GetUserFromReq(req)
-		return usr != nil && usr.Role == auth.AdminRole
+	isLoggedInDetector := func(req *msg.Request) bool {
+		return auth.GetUserFromReq(req).IsLoggedIn()
 	}
 
 	setConversationCtxHandler := chatgpt.NewSetConversationContextCommand(db, isScopedModeFunc, isAdminDetector)
@@ -51,7 +56,10 @@ func BuildMessageRouter(db storage.Client) (*msg.Router, error) {
 
 	getModelsHandler := chatgpt.NewGetModelsCommand(chartGptCfg, db, loader, isScopedModeFunc, isAdminDetector)
 
-	chatCompletionHandler, err := chatgpt.NewChatCompletionHandler(chartGptCfg, db, loader, isScopedModeFunc)
+	moderator := chatgpt.NewModerator(chartGptCfg, db)
+	moderationHandler := chatgpt.NewModerationCommand(moderator, isAdminDetector)
+
+	chatCompletionHandler, err := chatgpt.NewChatCompletionHandler(chartGptCfg, db, loader, isScopedModeFunc, moderator)
 	if err != nil {
 		return nil, err
 	}
@@ -59,6 +67,8 @@ func BuildMessageRouter(db storage.Client) (*msg.Router, error) {
 	addUserHandler := auth.NewAddUserCommand(us, isAdminDetector)
 	listUsersHandler := auth.NewListUsersCommand(us, isAdminDetector)
 	deleteUsersHandler := auth.NewDeleteUserCommand(us, isAdminDetector)
+	addAPITokenHandler := auth.NewAddAPITokenCommand(us, isAdminDetector)
+	deleteAPITokenHandler := auth.NewDeleteAPITokenCommand(us, isAdminDetector)
 
 	helpProviders := []help.Provider{
 		setModelHandler,
@@ -68,6 +78,9 @@ func BuildMessageRouter(db storage.Client) (*msg.Router, error) {
 		addUserHandler,
 		listUsersHandler,
 		deleteUsersHandler,
+		addAPITokenHandler,
+		deleteAPITokenHandler,
+		moderationHandler,
 		logoutHandler,
 	}
 	helpHandler := help.NewHandler(isScopedModeFunc, isAdminDetector, helpProviders)
@@ -85,11 +98,112 @@ func BuildMessageRouter(db storage.Client) (*msg.Router, error) {
 			addUserHandler,
 			listUsersHandler,
 			deleteUsersHandler,
+			addAPITokenHandler,
+			deleteAPITokenHandler,
+			moderationHandler,
 			chatCompletionHandler,
 		},
 	}
 
-	r.UseMiddleware(userMiddleware)
+	routerCfg, err := msg.LoadRouterConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	routerValidationErr := routerCfg.Validate()
+	if routerValidationErr.HasErrors() {
+		return nil, routerValidationErr
+	}
+
+	middlewares := []msg.NamedMiddleware{
+		{Name: "log", Middleware: msg.LoggingMiddleware{}},
+		{Name: "recover", Middleware: msg.RecoveryMiddleware{}},
+	}
+
+	middlewares = append(middlewares, msg.NamedMiddleware{Name: "user", Middleware: userMiddleware, Required: true})
+
+	rateLimitCfg, err := ratelimit.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if rateLimitCfg.IsEnabled() {
+		scriptRunner, ok := db.(storage.ScriptRunner)
+		if !ok {
+			return nil, errors.New("rate limits need a storage which supports scripts")
+		}
+
+		rateLimitMiddleware, err := ratelimit.NewMiddleware(rateLimitCfg, ratelimit.NewLimiter(scriptRunner), rateLimitIdentity)
+		if err != nil {
+			return nil, err
+		}
+
+		middlewares = append(middlewares, msg.NamedMiddleware{
+			Name:       "ratelimit",
+			Middleware: rateLimitMiddleware,
+			After:      []string{"user"},
+		})
+	}
+
+	queueCfg, err := queue.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if queueCfg.Enabled {
+		scriptRunner, ok := db.(storage.ScriptRunner)
+		if !ok {
+			return nil, errors.New("conversation queue needs a storage which supports scripts")
+		}
+
+		conversationQueue, err := queue.NewQueue(queueCfg, scriptRunner)
+		if err != nil {
+			return nil, err
+		}
+
+		middlewares = append(middlewares, msg.NamedMiddleware{Name: "queue", Middleware: queue.NewMiddleware(conversationQueue)})
+	}
+
+	// the time of waiting in the queue doesn't count against the request timeout, but it counts against the handle timeout
+	// of the frontend, which by default leaves room for waiting behind one slow message
+	if routerCfg.RequestTimeout > 0 {
+		middlewares = append(middlewares, msg.NamedMiddleware{
+			Name:       "timeout",
+			Middleware: msg.TimeoutMiddleware{Timeout: routerCfg.RequestTimeout},
+			After:      []string{"queue"},
+		})
+	}
+
+	if chartGptCfg.ModerationEnabled {
+		middlewares = append(middlewares, msg.NamedMiddleware{
+			Name:       "moderation",
+			Middleware: chatgpt.NewModerationMiddleware(moderator, isLoggedInDetector),
+			After:      []string{"user"},
+		})
+	}
+
+	r.Middlewares, err = msg.OrderMiddlewares(middlewares, routerCfg.Middlewares)
+	if err != nil {
+		return nil, err
+	}
 
 	return r, nil
 }
+
+// rateLimitIdentity limits logged in users by their role across all platforms, others as guests per platform account
+func rateLimitIdentity(req *msg.Request) ratelimit.Identity {
+	usr := auth.GetUserFromReq(req)
+	if usr.IsLoggedIn() {
+		return ratelimit.Identity{Role: usr.Role, ID: usr.UID}
+	}
+
+	return ratelimit.Identity{
+		Role: ratelimit.GuestRole,
+		ID:   strings.ToLower(req.Platform + "/" + req.Sender.GetID()),
+	}
+}
+
+func isAdminDetector(req *msg.Request) bool {
+	usr := auth.GetUserFromReq(req)
+	return usr != nil && usr.Role == auth.AdminRole
+}
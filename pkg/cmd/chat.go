@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"breathbathChatGPT/pkg/auth"
+	"breathbathChatGPT/pkg/cli"
+	"breathbathChatGPT/pkg/storage"
+)
+
+var chatCmd = &cobra.Command{
+	Use:   "chat",
+	Short: "Starts an interactive chat in the terminal",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := cli.LoadConfig()
+		if err != nil {
+			return err
+		}
+
+		// debug logs would be mixed with the conversation
+		logLevel, err := logrus.ParseLevel(cfg.LogLevel)
+		if err == nil {
+			logrus.SetLevel(logLevel)
+		}
+
+		db, err := storage.BuildRedisClient()
+		if err != nil {
+			return err
+		}
+
+		msgRouter, err := BuildMessageRouter(db)
+		if err != nil {
+			return err
+		}
+
+		repl, err := cli.NewREPL(cfg, msgRouter, auth.NewUserStorage(db))
+		if err != nil {
+			return err
+		}
+
+		return repl.Run()
+	},
+}
+
+func initChatCmd() {
+	rootCmd.AddCommand(chatCmd)
+}
@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	logging "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"breathbathChatGPT/pkg/discord"
+	"breathbathChatGPT/pkg/storage"
+)
+
+var discordCmd = &cobra.Command{
+	Use:   "discord",
+	Short: "Starts a Discord bot connected to the gateway websocket",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		db, err := storage.BuildRedisClient()
+		if err != nil {
+			return err
+		}
+
+		msgRouter, err := BuildMessageRouter(db)
+		if err != nil {
+			return err
+		}
+
+		bot, err := discord.BuildBot(msgRouter)
+		if err != nil {
+			return err
+		}
+
+		logging.Info("starting discord bot")
+
+		return runUntilStopped(bot)
+	},
+}
+
+func initDiscordCmd() {
+	rootCmd.AddCommand(discordCmd)
+}
@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	logging "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"breathbathChatGPT/pkg/email"
+	"breathbathChatGPT/pkg/storage"
+)
+
+var emailCmd = &cobra.Command{
+	Use:   "email",
+	Short: "Starts an email bot polling an IMAP mailbox and replying over SMTP",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		db, err := storage.BuildRedisClient()
+		if err != nil {
+			return err
+		}
+
+		msgRouter, err := BuildMessageRouter(db)
+		if err != nil {
+			return err
+		}
+
+		bot, err := email.BuildBot(msgRouter)
+		if err != nil {
+			return err
+		}
+
+		logging.Info("starting email bot")
+
+		return runUntilStopped(bot)
+	},
+}
+
+func initEmailCmd() {
+	rootCmd.AddCommand(emailCmd)
+}
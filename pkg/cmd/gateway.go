@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	logging "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"breathbathChatGPT/pkg/gateway"
+	"breathbathChatGPT/pkg/storage"
+)
+
+var gatewayCmd = &cobra.Command{
+	Use:   "gateway",
+	Short: "Starts an OpenAI compatible gateway which forwards requests with the shared API key",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		db, err := storage.BuildRedisClient()
+		if err != nil {
+			return err
+		}
+
+		server, err := gateway.BuildServer(db)
+		if err != nil {
+			return err
+		}
+
+		logging.Info("starting gateway server")
+
+		return runUntilStopped(server)
+	},
+}
+
+func initGatewayCmd() {
+	rootCmd.AddCommand(gatewayCmd)
+}
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	logging "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"breathbathChatGPT/pkg/auth"
+	"breathbathChatGPT/pkg/httpapi"
+	"breathbathChatGPT/pkg/storage"
+)
+
+var httpCmd = &cobra.Command{
+	Use:   "http",
+	Short: "Starts a JSON HTTP API server",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		db, err := storage.BuildRedisClient()
+		if err != nil {
+			return err
+		}
+
+		msgRouter, err := BuildMessageRouter(db)
+		if err != nil {
+			return err
+		}
+
+		server, err := httpapi.BuildServer(msgRouter, auth.NewUserStorage(db))
+		if err != nil {
+			return err
+		}
+
+		logging.Info("starting http api server")
+
+		return runUntilStopped(server)
+	},
+}
+
+func initHTTPCmd() {
+	rootCmd.AddCommand(httpCmd)
+}
+
+type stoppableServer interface {
+	Start() error
+	Stop()
+}
+
+// runUntilStopped runs the server till a stop signal and stops it gracefully, or till it fails
+func runUntilStopped(server stoppableServer) error {
+	serverErrs := make(chan error, 1)
+	go func() {
+		serverErrs <- server.Start()
+	}()
+
+	terminateSignals := make(chan os.Signal, 1)
+	signal.Notify(terminateSignals, syscall.SIGINT, syscall.SIGTERM)
+
+	select {
+	case s := <-terminateSignals:
+		logging.Infof("Got one of stop signals, shutting down server gracefully, SIGNAL NAME : %v", s)
+		server.Stop()
+	case err := <-serverErrs:
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	logging "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"breathbathChatGPT/pkg/matrix"
+	"breathbathChatGPT/pkg/storage"
+)
+
+var matrixCmd = &cobra.Command{
+	Use:   "matrix",
+	Short: "Starts a Matrix bot syncing with a homeserver",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		db, err := storage.BuildRedisClient()
+		if err != nil {
+			return err
+		}
+
+		msgRouter, err := BuildMessageRouter(db)
+		if err != nil {
+			return err
+		}
+
+		bot, err := matrix.BuildBot(msgRouter, db)
+		if err != nil {
+			return err
+		}
+
+		logging.Info("starting matrix bot")
+
+		return runUntilStopped(bot)
+	},
+}
+
+func initMatrixCmd() {
+	rootCmd.AddCommand(matrixCmd)
+}
@@ -12,6 +12,15 @@ var rootCmd = &cobra.Command{
 func Execute() error {
 	initVersionCmd()
 	initTelegramCmd()
+	initHTTPCmd()
+	initGatewayCmd()
+	initChatCmd()
+	initSlackCmd()
+	initDiscordCmd()
+	initMatrixCmd()
+	initEmailCmd()
+	initWebhookCmd()
+	initServeCmd()
 	initBcryptCmd()
 
 	return rootCmd.Execute()
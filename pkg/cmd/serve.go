@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	logging "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"breathbathChatGPT/pkg/auth"
+	"breathbathChatGPT/pkg/discord"
+	"breathbathChatGPT/pkg/email"
+	"breathbathChatGPT/pkg/gateway"
+	"breathbathChatGPT/pkg/httpapi"
+	"breathbathChatGPT/pkg/matrix"
+	"breathbathChatGPT/pkg/msg"
+	"breathbathChatGPT/pkg/serve"
+	"breathbathChatGPT/pkg/slack"
+	"breathbathChatGPT/pkg/storage"
+	"breathbathChatGPT/pkg/webhook"
+)
+
+type frontendBuilder func(db storage.Client, r *msg.Router) (serve.Frontend, error)
+
+var frontendBuilders = map[string]frontendBuilder{
+	"telegram": func(db storage.Client, r *msg.Router) (serve.Frontend, error) {
+		return buildTelegram(r, db)
+	},
+	"http": func(db storage.Client, r *msg.Router) (serve.Frontend, error) {
+		return httpapi.BuildServer(r, auth.NewUserStorage(db))
+	},
+	"gateway": func(db storage.Client, _ *msg.Router) (serve.Frontend, error) {
+		return gateway.BuildServer(db)
+	},
+	"slack": func(_ storage.Client, r *msg.Router) (serve.Frontend, error) {
+		return slack.BuildServer(r)
+	},
+	"discord": func(_ storage.Client, r *msg.Router) (serve.Frontend, error) {
+		return discord.BuildBot(r)
+	},
+	"matrix": func(db storage.Client, r *msg.Router) (serve.Frontend, error) {
+		return matrix.BuildBot(r, db)
+	},
+	"email": func(_ storage.Client, r *msg.Router) (serve.Frontend, error) {
+		return email.BuildBot(r)
+	},
+	"webhook": func(_ storage.Client, r *msg.Router) (serve.Frontend, error) {
+		return webhook.BuildServer(r)
+	},
+}
+
+var serveFrontends []string
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Starts several frontends in one process sharing the message router and storage",
+	Long: "Starts the frontends given with --frontends or SERVE_FRONTENDS, one of: " +
+		strings.Join(frontendNames(), ", "),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		supervisor, err := serve.BuildSupervisor(serveFrontends)
+		if err != nil {
+			return err
+		}
+
+		names := supervisor.FrontendNames()
+		for _, name := range names {
+			if _, ok := frontendBuilders[name]; !ok {
+				return errors.Errorf("unknown frontend %q, supported are: %s", name, strings.Join(frontendNames(), ", "))
+			}
+		}
+
+		db, err := storage.BuildRedisClient()
+		if err != nil {
+			return err
+		}
+		supervisor.AddCheck("redis", db.Ping)
+
+		msgRouter, err := BuildMessageRouter(db)
+		if err != nil {
+			return err
+		}
+
+		for _, name := range names {
+			frontend, err := frontendBuilders[name](db, msgRouter)
+			if err != nil {
+				return errors.Wrapf(err, "failed to build frontend %q", name)
+			}
+
+			supervisor.AddFrontend(name, frontend)
+		}
+
+		logging.Infof("starting frontends %s", strings.Join(names, ", "))
+
+		return runUntilStopped(supervisor)
+	},
+}
+
+func initServeCmd() {
+	serveCmd.Flags().StringSliceVarP(
+		&serveFrontends,
+		"frontends",
+		"f",
+		nil,
+		"comma separated list of frontends to start, overrides SERVE_FRONTENDS",
+	)
+	rootCmd.AddCommand(serveCmd)
+}
+
+func frontendNames() []string {
+	names := make([]string, 0, len(frontendBuilders))
+	for name := range frontendBuilders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	logging "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"breathbathChatGPT/pkg/slack"
+	"breathbathChatGPT/pkg/storage"
+)
+
+var slackCmd = &cobra.Command{
+	Use:   "slack",
+	Short: "Starts a Slack bot receiving Events API callbacks and slash commands",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		db, err := storage.BuildRedisClient()
+		if err != nil {
+			return err
+		}
+
+		msgRouter, err := BuildMessageRouter(db)
+		if err != nil {
+			return err
+		}
+
+		server, err := slack.BuildServer(msgRouter)
+		if err != nil {
+			return err
+		}
+
+		logging.Info("starting slack server")
+
+		return runUntilStopped(server)
+	},
+}
+
+func initSlackCmd() {
+	rootCmd.AddCommand(slackCmd)
+}
@@ -1,10 +1,6 @@
 package cmd
 
 import (
-	"os"
-	"os/signal"
-	"syscall"
-
 	logging "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 
@@ -27,17 +23,13 @@ var telegramCmd = &cobra.Command{
 			return err
 		}
 
-		bot, err := buildTelegram(msgRouter)
+		bot, err := buildTelegram(msgRouter, db)
 		if err != nil {
 			return err
 		}
-		go bot.Start()
-
-		logging.Info("started telegram bot")
+		logging.Info("starting telegram bot")
 
-		waitForSignal(bot)
-
-		return nil
+		return runUntilStopped(bot)
 	},
 }
 
@@ -45,18 +37,8 @@ func initTelegramCmd() {
 	rootCmd.AddCommand(telegramCmd)
 }
 
-func waitForSignal(server *telegram.Bot) {
-	terminateSignals := make(chan os.Signal, 1)
-
-	signal.Notify(terminateSignals, syscall.SIGINT, syscall.SIGTERM)
-
-	s := <-terminateSignals
-	logging.Infof("Got one of stop signals, shutting down server gracefully, SIGNAL NAME : %v", s)
-	server.Stop()
-}
-
-func buildTelegram(r *msg.Router) (*telegram.Bot, error) {
-	telegramBot, err := telegram.BuildBot(r)
+func buildTelegram(r *msg.Router, db storage.Client) (*telegram.Bot, error) {
+	telegramBot, err := telegram.BuildBot(r, db, isAdminDetector)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	logging "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"breathbathChatGPT/pkg/storage"
+	"breathbathChatGPT/pkg/webhook"
+)
+
+var webhookCmd = &cobra.Command{
+	Use:   "webhook",
+	Short: "Starts a server answering outgoing webhooks of the configured sources",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		db, err := storage.BuildRedisClient()
+		if err != nil {
+			return err
+		}
+
+		msgRouter, err := BuildMessageRouter(db)
+		if err != nil {
+			return err
+		}
+
+		server, err := webhook.BuildServer(msgRouter)
+		if err != nil {
+			return err
+		}
+
+		logging.Info("starting webhook server")
+
+		return runUntilStopped(server)
+	},
+}
+
+func initWebhookCmd() {
+	rootCmd.AddCommand(webhookCmd)
+}
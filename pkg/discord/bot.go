@@ -0,0 +1,590 @@
+package discord
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"breathbathChatGPT/pkg/markdown"
+	"breathbathChatGPT/pkg/msg"
+
+	"github.com/pkg/errors"
+	logging "github.com/sirupsen/logrus"
+)
+
+const (
+	Platform = "discord"
+
+	maxButtonsInRow      = 5
+	maxButtonRows        = 5
+	maxButtonLabelLength = 80
+	maxCustomIDLength    = 100
+	minReconnectWait     = time.Second
+)
+
+// Bot receives events over the gateway websocket and answers with the HTTP API, messages in direct chats
+// and mentions of the bot in guild channels are answered as replies, slash commands are answered
+// with deferred interaction responses
+type Bot struct {
+	cfg        *Config
+	msgHandler *msg.Router
+	rest       *restClient
+	session    gatewaySession
+	inFlight   sync.WaitGroup
+
+	stopCtx context.Context
+	stop    context.CancelFunc
+
+	mu                    sync.Mutex
+	conn                  *gatewayConn
+	isStopped             bool
+	botUserID             string
+	areCommandsRegistered bool
+}
+
+func NewBot(cfg *Config, r *msg.Router) (*Bot, error) {
+	e := cfg.Validate()
+	if e.HasErrors() {
+		return nil, e
+	}
+
+	stopCtx, stop := context.WithCancel(context.Background())
+
+	return &Bot{
+		cfg:        cfg,
+		msgHandler: r,
+		rest:       &restClient{cfg: cfg, httpClient: &http.Client{Timeout: time.Second * 30}},
+		stopCtx:    stopCtx,
+		stop:       stop,
+	}, nil
+}
+
+// Start keeps the gateway connection till the bot is stopped, lost connections are resumed
+// with an increasing delay, it fails only if Discord refuses the bot, e.g. because of a wrong token
+func (b *Bot) Start() error {
+	gatewayURL := b.cfg.GatewayURL
+	if gatewayURL == "" {
+		var err error
+		gatewayURL, err = b.rest.getGatewayURL(b.stopCtx)
+		if err != nil {
+			if b.stopCtx.Err() != nil {
+				return nil
+			}
+			return errors.Wrap(err, "failed to get discord gateway url")
+		}
+	}
+
+	logging.Infof("will connect to discord gateway %q", gatewayURL)
+
+	wait := minReconnectWait
+	for {
+		connectedAt := time.Now()
+		err := b.serve(gatewayURL)
+		if b.stopCtx.Err() != nil {
+			return nil
+		}
+
+		if isCloseCodeIn(err, fatalCloseCodes) {
+			return errors.Wrap(err, "discord gateway refused the bot")
+		}
+
+		// a connection which lived long enough doesn't count as a failed attempt
+		if time.Since(connectedAt) > b.cfg.MaxReconnectWait {
+			wait = minReconnectWait
+		}
+
+		logging.Warnf("lost discord gateway connection, will reconnect in %v: %v", wait, err)
+
+		select {
+		case <-b.stopCtx.Done():
+			return nil
+		case <-time.After(wait):
+		}
+
+		wait *= 2
+		if wait > b.cfg.MaxReconnectWait {
+			wait = b.cfg.MaxReconnectWait
+		}
+	}
+}
+
+// Stop closes the gateway connection and waits for the events in progress till the shutdown timeout
+func (b *Bot) Stop() {
+	logging.Info("will stop discord bot")
+
+	b.mu.Lock()
+	b.isStopped = true
+	conn := b.conn
+	b.mu.Unlock()
+
+	b.stop()
+	if conn != nil {
+		conn.close()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		b.inFlight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		logging.Info("stopped discord bot")
+	case <-time.After(b.cfg.ShutdownTimeout):
+		logging.Warnf("stopped waiting for in-flight discord events after %v", b.cfg.ShutdownTimeout)
+	}
+}
+
+// setConn remembers the current connection to close it on stop, it gives false if the bot is stopped already
+func (b *Bot) setConn(gc *gatewayConn) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.isStopped && gc != nil {
+		return false
+	}
+	b.conn = gc
+
+	return true
+}
+
+func (b *Bot) getBotUserID() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.botUserID
+}
+
+func (b *Bot) runAsync(f func()) {
+	b.inFlight.Add(1)
+	go func() {
+		defer b.inFlight.Done()
+		f()
+	}()
+}
+
+func (b *Bot) dispatch(p *Payload) {
+	switch p.Type {
+	case eventReady:
+		ready := new(Ready)
+		err := json.Unmarshal(p.Data, ready)
+		if err != nil {
+			logging.Errorf("failed to decode discord ready event: %v", err)
+			return
+		}
+		b.handleReady(ready)
+	case eventResumed:
+		logging.Info("resumed discord session")
+	case eventMessageCreate:
+		m := new(Message)
+		err := json.Unmarshal(p.Data, m)
+		if err != nil {
+			logging.Errorf("failed to decode discord message: %v", err)
+			return
+		}
+
+		if !b.isMessageToHandle(m) {
+			return
+		}
+		b.runAsync(func() {
+			b.handleMessage(m)
+		})
+	case eventInteractionCreate:
+		interaction := new(Interaction)
+		err := json.Unmarshal(p.Data, interaction)
+		if err != nil {
+			logging.Errorf("failed to decode discord interaction: %v", err)
+			return
+		}
+		b.runAsync(func() {
+			b.handleInteraction(interaction)
+		})
+	default:
+		logging.Debugf("ignored discord event %q", p.Type)
+	}
+}
+
+func (b *Bot) handleReady(ready *Ready) {
+	b.session.start(ready.SessionID, ready.ResumeGatewayURL)
+
+	b.mu.Lock()
+	b.botUserID = ready.User.ID
+	shouldRegister := b.cfg.RegisterCommands && !b.areCommandsRegistered
+	b.areCommandsRegistered = true
+	b.mu.Unlock()
+
+	logging.Infof("connected to discord as %q", ready.User.Username)
+
+	if shouldRegister {
+		b.runAsync(func() {
+			b.registerCommands(ready.Application.ID)
+		})
+	}
+}
+
+// isMessageToHandle accepts direct messages and mentions of the bot in guild channels, messages of bots are ignored
+func (b *Bot) isMessageToHandle(m *Message) bool {
+	if m.Author == nil || m.Author.Bot {
+		return false
+	}
+
+	if m.GuildID == "" {
+		return true
+	}
+
+	botUserID := b.getBotUserID()
+	for _, mention := range m.Mentions {
+		if mention.ID == botUserID {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (b *Bot) messageToRequest(m *Message) *msg.Request {
+	botUserID := b.getBotUserID()
+	text := strings.NewReplacer("<@"+botUserID+">", "", "<@!"+botUserID+">", "").Replace(m.Content)
+
+	return &msg.Request{
+		Platform: Platform,
+		ID:       m.ID,
+		Sender: &msg.Sender{
+			ID:    m.Author.ID,
+			Alias: m.Author.Username,
+		},
+		Message: strings.TrimSpace(text),
+		Meta: map[string]interface{}{
+			"conversation_id": m.ChannelID,
+			"timestamp":       snowflakeTime(m.ID).Unix(),
+			"is_group_chat":   m.GuildID != "",
+		},
+	}
+}
+
+func (b *Bot) route(ctx context.Context, req *msg.Request) *msg.Response {
+	resp, err := b.msgHandler.Route(ctx, req)
+	if err != nil {
+		logging.WithContext(ctx).Errorf("failed to handle discord request: %v", err)
+		return &msg.Response{Message: "Unexpected error", Type: msg.Error}
+	}
+
+	return resp
+}
+
+// buildNotifier answers the message with notices before the response is ready
+func (b *Bot) buildNotifier(m *Message) msg.Notifier {
+	return func(ctx context.Context, text string) {
+		err := b.rest.createMessage(ctx, m.ChannelID, &MessagePayload{
+			Content:          text,
+			AllowedMentions:  &AllowedMentions{Parse: []string{}},
+			MessageReference: &MessageReference{MessageID: m.ID},
+		}, nil)
+		if err != nil {
+			logging.WithContext(ctx).Errorf("failed to send discord notice: %v", err)
+		}
+	}
+}
+
+func (b *Bot) handleMessage(m *Message) {
+	ctx, cancel := context.WithTimeout(context.Background(), b.cfg.HandleTimeout)
+	defer cancel()
+
+	log := logging.WithContext(ctx)
+
+	req := b.messageToRequest(m)
+	log.Debugf("got discord message: %q", req.Message)
+
+	indicator := newTypingIndicator(b.rest, m.ChannelID)
+	routeCtx := msg.WithNotifier(msg.WithProgressReporter(ctx, indicator.Report), b.buildNotifier(m))
+	resp := b.route(routeCtx, req)
+	indicator.Stop(ctx)
+
+	reference := &MessageReference{MessageID: m.ID}
+	if resp != nil && resp.Options.IsResponseToHiddenMessage() {
+		reference = nil
+		b.deleteHiddenMessage(ctx, m)
+	}
+
+	payloads, files := b.buildMessages(resp)
+	if len(payloads) == 0 {
+		log.Info("response message is empty, will send nothing to the sender")
+		return
+	}
+
+	payloads[0].MessageReference = reference
+	for i, payload := range payloads {
+		var partFiles []msg.Attachment
+		if i == len(payloads)-1 {
+			partFiles = files
+		}
+
+		err := b.rest.createMessage(ctx, m.ChannelID, payload, partFiles)
+		if err != nil {
+			log.Errorf("failed to send discord message to channel %q: %v", m.ChannelID, err)
+			return
+		}
+	}
+}
+
+// deleteHiddenMessage removes a message with sensitive data, e.g. a password, bots cannot delete messages in direct chats
+func (b *Bot) deleteHiddenMessage(ctx context.Context, m *Message) {
+	log := logging.WithContext(ctx)
+
+	if m.GuildID == "" {
+		log.Warnf("discord message %q contains sensitive data, but bots cannot delete messages in direct chats", m.ID)
+		return
+	}
+
+	err := b.rest.deleteMessage(ctx, m.ChannelID, m.ID)
+	if err != nil {
+		log.Errorf("failed to delete discord message %q with sensitive data: %v", m.ID, err)
+	}
+}
+
+func (b *Bot) handleInteraction(interaction *Interaction) {
+	ctx, cancel := context.WithTimeout(context.Background(), b.cfg.HandleTimeout)
+	defer cancel()
+
+	log := logging.WithContext(ctx)
+
+	if interaction.getUser() == nil || interaction.Data == nil {
+		log.Debugf("ignored discord interaction %q without user or data", interaction.ID)
+		return
+	}
+
+	var req *msg.Request
+	isEphemeral := false
+	callback := &InteractionCallback{Type: callbackDeferredUpdate}
+
+	switch interaction.Type {
+	case interactionApplicationCommand:
+		req = b.commandToRequest(interaction)
+		isEphemeral = interaction.Data.Name != askCommand
+		callback.Type = callbackDeferredMessage
+		if isEphemeral {
+			callback.Data = &InteractionCallbackData{Flags: messageFlagEphemeral}
+		}
+	case interactionMessageComponent:
+		req = b.componentToRequest(interaction)
+		isEphemeral = interaction.Message != nil && interaction.Message.Flags&messageFlagEphemeral != 0
+	default:
+		log.Debugf("ignored discord interaction %q of type %d", interaction.ID, interaction.Type)
+		return
+	}
+
+	// ephemeral answers are seen only by the caller, even in a guild channel
+	req.Meta["is_group_chat"] = interaction.GuildID != "" && !isEphemeral
+
+	// Discord waits only 3 seconds for the first response, so the answer is deferred
+	err := b.rest.respondToInteraction(ctx, interaction, callback)
+	if err != nil {
+		log.Errorf("failed to acknowledge discord interaction %q: %v", interaction.ID, err)
+		return
+	}
+
+	log.Debugf("got discord interaction: %q", req.Message)
+
+	resp := b.route(ctx, req)
+
+	payloads, files := b.buildMessages(resp)
+	replacesOriginal := interaction.Type == interactionApplicationCommand || (resp != nil && resp.Options.IsEditOriginalMessage())
+
+	if len(payloads) == 0 {
+		if interaction.Type == interactionApplicationCommand {
+			err = b.rest.deleteOriginalResponse(ctx, interaction)
+			if err != nil {
+				log.Errorf("failed to delete discord interaction response: %v", err)
+			}
+		}
+		return
+	}
+
+	for i, payload := range payloads {
+		var partFiles []msg.Attachment
+		if i == len(payloads)-1 {
+			partFiles = files
+		}
+
+		if i == 0 && replacesOriginal {
+			err = b.rest.editOriginalResponse(ctx, interaction, payload, partFiles)
+		} else {
+			if isEphemeral {
+				payload.Flags = messageFlagEphemeral
+			}
+			err = b.rest.createFollowupMessage(ctx, interaction, payload, partFiles)
+		}
+
+		if err != nil {
+			log.Errorf("failed to respond to discord interaction %q: %v", interaction.ID, err)
+			return
+		}
+	}
+}
+
+func (b *Bot) interactionToRequest(interaction *Interaction, message string) *msg.Request {
+	user := interaction.getUser()
+
+	return &msg.Request{
+		Platform: Platform,
+		ID:       interaction.ID,
+		Sender: &msg.Sender{
+			ID:    user.ID,
+			Alias: user.Username,
+		},
+		Message: message,
+		Meta: map[string]interface{}{
+			"conversation_id": interaction.ChannelID,
+			"timestamp":       snowflakeTime(interaction.ID).Unix(),
+		},
+	}
+}
+
+// commandToRequest converts a slash command to a message, the ask and login commands give their text as is,
+// other commands are routed together with their argument, e.g. "/model gpt-4"
+func (b *Bot) commandToRequest(interaction *Interaction) *msg.Request {
+	args := make([]string, 0, len(interaction.Data.Options))
+	for _, option := range interaction.Data.Options {
+		args = append(args, strings.TrimSpace(fmt.Sprint(option.Value)))
+	}
+	text := strings.Join(args, " ")
+
+	message := text
+	if interaction.Data.Name != askCommand && interaction.Data.Name != loginCommand {
+		message = strings.TrimSpace(msg.CommandPrefix + interaction.Data.Name + " " + text)
+	}
+
+	return b.interactionToRequest(interaction, message)
+}
+
+// componentToRequest converts a pressed button to a callback request with the button data as message
+func (b *Bot) componentToRequest(interaction *Interaction) *msg.Request {
+	req := b.interactionToRequest(interaction, interaction.Data.CustomID)
+	req.Meta["callback_data"] = interaction.Data.CustomID
+	req.Meta["callback_id"] = interaction.ID
+	if interaction.Message != nil {
+		req.Meta["callback_message_id"] = interaction.Message.ID
+	}
+
+	return req
+}
+
+// buildMessages converts the response to messages fitting into the Discord limit, buttons are attached
+// to the last message, attachments with data are uploaded, the ones with a url are given as links
+func (b *Bot) buildMessages(resp *msg.Response) ([]*MessagePayload, []msg.Attachment) {
+	if resp == nil {
+		return nil, nil
+	}
+
+	lines := []string{}
+	if resp.Message != "" {
+		text := toDiscordMarkdown(resp.Message, resp.Options.GetFormat())
+		if resp.Type == msg.Error {
+			text = "❗" + text + "❗"
+		}
+		lines = append(lines, text)
+	}
+
+	files := []msg.Attachment{}
+	for _, a := range resp.Attachments {
+		switch {
+		case len(a.Data) > 0:
+			files = append(files, a)
+		case a.URL != "":
+			lines = append(lines, fmt.Sprintf("[%s](%s)", markdownEscaper.Replace(a.FileName), a.URL))
+		default:
+			logging.Warnf("attachment %q has neither data nor url, it cannot be sent to discord", a.FileName)
+		}
+	}
+
+	components := buildComponents(resp)
+
+	parts := markdown.SplitText(strings.Join(lines, "\n"), maxMessageLength)
+	if len(parts) == 0 && (len(files) > 0 || len(components) > 0) {
+		parts = []string{""}
+	}
+
+	payloads := make([]*MessagePayload, 0, len(parts))
+	for _, part := range parts {
+		payloads = append(payloads, &MessagePayload{
+			Content: part,
+			// answers of ChatGPT should never ping users or roles
+			AllowedMentions: &AllowedMentions{Parse: []string{}},
+			Components:      []Component{},
+		})
+	}
+
+	if len(payloads) > 0 {
+		payloads[len(payloads)-1].Components = components
+	}
+
+	return payloads, files
+}
+
+// buildComponents converts inline buttons and predefined responses to button rows within the Discord limits
+func buildComponents(resp *msg.Response) []Component {
+	buttonRows := [][]Component{}
+	for _, row := range resp.Options.GetInlineButtons() {
+		buttons := []Component{}
+		for _, ib := range row {
+			if button, ok := buildButton(ib.Text, ib.Data, ib.URL); ok {
+				buttons = append(buttons, button)
+			}
+		}
+		buttonRows = append(buttonRows, buttons)
+	}
+
+	predefined := []Component{}
+	for _, predefinedResp := range resp.Options.GetPredefinedResponses() {
+		if button, ok := buildButton(string(predefinedResp), string(predefinedResp), ""); ok {
+			predefined = append(predefined, button)
+		}
+	}
+	buttonRows = append(buttonRows, predefined)
+
+	rows := []Component{}
+	for _, buttons := range buttonRows {
+		for len(buttons) > 0 {
+			size := maxButtonsInRow
+			if len(buttons) < size {
+				size = len(buttons)
+			}
+
+			if len(rows) == maxButtonRows {
+				logging.Warnf("discord messages can have only %d rows of buttons, the rest is dropped", maxButtonRows)
+				return rows
+			}
+
+			rows = append(rows, Component{Type: componentActionRow, Components: buttons[:size]})
+			buttons = buttons[size:]
+		}
+	}
+
+	return rows
+}
+
+func buildButton(label, data, url string) (Component, bool) {
+	if label == "" {
+		return Component{}, false
+	}
+
+	if r := []rune(label); len(r) > maxButtonLabelLength {
+		label = string(r[:maxButtonLabelLength-1]) + "…"
+	}
+
+	if url != "" {
+		return Component{Type: componentButton, Style: buttonStyleLink, Label: label, URL: url}, true
+	}
+
+	if data == "" || len(data) > maxCustomIDLength {
+		logging.Warnf("button %q has data which doesn't fit into %d bytes, it cannot be sent to discord", label, maxCustomIDLength)
+		return Component{}, false
+	}
+
+	return Component{Type: componentButton, Style: buttonStylePrimary, Label: label, CustomID: data}, true
+}
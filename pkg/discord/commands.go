@@ -0,0 +1,100 @@
+package discord
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"time"
+
+	"breathbathChatGPT/pkg/help"
+	"breathbathChatGPT/pkg/msg"
+
+	logging "github.com/sirupsen/logrus"
+)
+
+const (
+	askCommand   = "ask"
+	loginCommand = "login"
+
+	maxCommandDescriptionLength = 100
+	registerCommandsTimeout     = time.Minute
+)
+
+var commandNameRegex = regexp.MustCompile(`^[-_a-z0-9]{1,32}$`)
+
+// collectCommands gives the slash commands of the router handlers, Discord shows global commands to everyone,
+// so admin commands are not registered, admins send them as messages to the bot
+func (b *Bot) collectCommands() []ApplicationCommand {
+	commands := []ApplicationCommand{
+		{
+			Name:        askCommand,
+			Description: "ask ChatGPT, the answer is visible to everyone in the channel",
+			Type:        commandTypeChatInput,
+			Options: []ApplicationCommandOption{
+				{Type: optionTypeString, Name: "text", Description: "your question", Required: true},
+			},
+			DMPermission: true,
+		},
+		{
+			Name:        loginCommand,
+			Description: "log in with your password, nobody else sees it",
+			Type:        commandTypeChatInput,
+			Options: []ApplicationCommandOption{
+				{Type: optionTypeString, Name: "password", Description: "your password", Required: true},
+			},
+			DMPermission: true,
+		},
+	}
+
+	for _, h := range b.msgHandler.Handlers {
+		provider, ok := h.(help.CommandsProvider)
+		if !ok {
+			continue
+		}
+
+		for _, c := range provider.GetCommands() {
+			if c.IsAdminOnly {
+				continue
+			}
+
+			name := strings.ToLower(strings.TrimPrefix(c.Name, msg.CommandPrefix))
+			if !commandNameRegex.MatchString(name) {
+				logging.Warnf("command %q is not a valid discord command name, it won't be registered", c.Name)
+				continue
+			}
+
+			description := c.Description
+			if r := []rune(description); len(r) > maxCommandDescriptionLength {
+				description = string(r[:maxCommandDescriptionLength-1]) + "…"
+			}
+
+			commands = append(commands, ApplicationCommand{
+				Name:        name,
+				Description: description,
+				Type:        commandTypeChatInput,
+				Options: []ApplicationCommandOption{
+					{Type: optionTypeString, Name: "value", Description: "command argument"},
+				},
+				DMPermission: true,
+			})
+		}
+	}
+
+	return commands
+}
+
+// registerCommands overwrites the global slash commands of the bot, Discord may need some minutes to show the changes
+func (b *Bot) registerCommands(applicationID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), registerCommandsTimeout)
+	defer cancel()
+
+	commands := b.collectCommands()
+
+	err := b.rest.overwriteCommands(ctx, applicationID, commands)
+	if err != nil {
+		logging.Errorf("failed to register discord slash commands: %v", err)
+		return
+	}
+
+	logging.Infof("registered %d discord slash commands", len(commands))
+}
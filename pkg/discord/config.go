@@ -0,0 +1,66 @@
+package discord
+
+import (
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+	"github.com/pkg/errors"
+
+	"breathbathChatGPT/pkg/errs"
+)
+
+const (
+	intentGuilds         = 1 << 0
+	intentGuildMessages  = 1 << 9
+	intentDirectMessages = 1 << 12
+)
+
+type Config struct {
+	BotToken string `envconfig:"DISCORD_BOT_TOKEN"`
+	// APIURL and GatewayURL can point to a local stub, an empty gateway url is requested from the API
+	APIURL           string        `envconfig:"DISCORD_API_URL" default:"https://discord.com/api/v10"`
+	GatewayURL       string        `envconfig:"DISCORD_GATEWAY_URL"`
+	Intents          int           `envconfig:"DISCORD_INTENTS" default:"4609"`
+	RegisterCommands bool          `envconfig:"DISCORD_REGISTER_COMMANDS" default:"true"`
+	ShutdownTimeout  time.Duration `envconfig:"DISCORD_SHUTDOWN_TIMEOUT" default:"30s"`
+	HandleTimeout    time.Duration `envconfig:"DISCORD_HANDLE_TIMEOUT" default:"10m"`
+	MaxReconnectWait time.Duration `envconfig:"DISCORD_MAX_RECONNECT_WAIT" default:"1m"`
+}
+
+func (c *Config) Validate() *errs.Multi {
+	e := errs.NewMulti()
+
+	if c.BotToken == "" {
+		e.Errf("DISCORD_BOT_TOKEN cannot be empty")
+	}
+
+	if c.APIURL == "" {
+		e.Errf("DISCORD_API_URL cannot be empty")
+	}
+
+	const requiredIntents = intentGuilds | intentGuildMessages | intentDirectMessages
+	if c.Intents&requiredIntents != requiredIntents {
+		e.Errf("DISCORD_INTENTS should include GUILDS, GUILD_MESSAGES and DIRECT_MESSAGES intents (%d), got %d", requiredIntents, c.Intents)
+	}
+
+	if c.HandleTimeout <= 0 {
+		e.Errf("DISCORD_HANDLE_TIMEOUT should be positive, got %v", c.HandleTimeout)
+	}
+
+	if c.MaxReconnectWait <= 0 {
+		e.Errf("DISCORD_MAX_RECONNECT_WAIT should be positive, got %v", c.MaxReconnectWait)
+	}
+
+	return e
+}
+
+func LoadConfig() (cfg *Config, err error) {
+	cfg = new(Config)
+
+	err = envconfig.Process("discord", cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load discord config")
+	}
+
+	return cfg, nil
+}
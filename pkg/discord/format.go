@@ -0,0 +1,79 @@
+package discord
+
+import (
+	"strings"
+
+	"breathbathChatGPT/pkg/markdown"
+	"breathbathChatGPT/pkg/msg"
+)
+
+// maxMessageLength is the Discord limit for the content of one message
+const maxMessageLength = 2000
+
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "*", `\*`, "_", `\_`, "~", `\~`, "`", "\\`", "|", `\|`, ">", `\>`, "#", `\#`,
+)
+
+// toDiscordMarkdown converts the response text to the Markdown flavour of Discord,
+// see https://support.discord.com/hc/en-us/articles/210298617
+func toDiscordMarkdown(text string, format msg.OutputFormat) string {
+	switch format {
+	case msg.OutputFormatMarkdown, msg.OutputFormatMarkdown1, msg.OutputFormatMarkdown2:
+		// Discord renders the generic Markdown of the handlers as is
+		return text
+	case msg.OutputFormatHTML:
+		return htmlToMarkdown(text)
+	case msg.OutputFormatUndefined:
+		return markdownEscaper.Replace(text)
+	default:
+		return markdownEscaper.Replace(text)
+	}
+}
+
+// htmlToMarkdown converts the subset of HTML used by the handlers, unknown tags are dropped
+func htmlToMarkdown(text string) string {
+	res := markdown.ConvertHTML(text, htmlConverter{})
+
+	// code tags inside of pre blocks would break the fence
+	return strings.NewReplacer("```\n`", "```\n", "`\n```", "\n```").Replace(res)
+}
+
+// htmlConverter gives the Markdown of Discord for the tags, text inside of code is not escaped
+type htmlConverter struct{}
+
+func (htmlConverter) Text(text string, isCode bool) string {
+	if isCode {
+		return text
+	}
+
+	return markdownEscaper.Replace(text)
+}
+
+func (htmlConverter) Tag(tag string, isClosing bool, href string) string {
+	switch tag {
+	case "b", "strong":
+		return "**"
+	case "i", "em":
+		return "*"
+	case "u", "ins":
+		return "__"
+	case "s", "strike", "del":
+		return "~~"
+	case "code":
+		return "`"
+	case "pre":
+		if isClosing {
+			return "\n```"
+		}
+		return "```\n"
+	case "br":
+		return "\n"
+	case "a":
+		if isClosing {
+			return "](" + href + ")"
+		}
+		return "["
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,302 @@
+package discord
+
+import (
+	"context"
+	"encoding/json"
+	"math/rand"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+	logging "github.com/sirupsen/logrus"
+)
+
+const (
+	gatewayVersion   = "10"
+	gatewayEncoding  = "json"
+	closeWriteWait   = time.Second * 5
+	handshakeTimeout = time.Second * 30
+)
+
+var (
+	errReconnect = errors.New("discord asked to reconnect")
+
+	// fatalCloseCodes cannot be fixed by reconnecting, e.g. a wrong token or not allowed intents,
+	// see https://discord.com/developers/docs/topics/opcodes-and-status-codes#gateway-gateway-close-event-codes
+	fatalCloseCodes = []int{4004, 4010, 4011, 4012, 4013, 4014}
+
+	// sessionCloseCodes invalidate the session, the next connection identifies again
+	sessionCloseCodes = []int{4007, 4009}
+)
+
+// gatewayConn is one websocket connection to the gateway, gorilla connections support only one concurrent writer
+type gatewayConn struct {
+	ws      *websocket.Conn
+	writeMu sync.Mutex
+	isAcked atomic.Bool
+}
+
+func (gc *gatewayConn) send(op int, data interface{}) error {
+	gc.writeMu.Lock()
+	defer gc.writeMu.Unlock()
+
+	err := gc.ws.WriteJSON(&outgoingPayload{Op: op, Data: data})
+	if err != nil {
+		return errors.Wrapf(err, "failed to send discord gateway payload with op %d", op)
+	}
+
+	return nil
+}
+
+func (gc *gatewayConn) read() (*Payload, error) {
+	p := new(Payload)
+	err := gc.ws.ReadJSON(p)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return p, nil
+}
+
+// close sends a close frame so that Discord removes the bot from the online list at once
+func (gc *gatewayConn) close() {
+	err := gc.ws.WriteControl(
+		websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+		time.Now().Add(closeWriteWait),
+	)
+	if err != nil {
+		logging.Debugf("failed to send close frame to discord gateway: %v", err)
+	}
+
+	gc.ws.Close()
+}
+
+// gatewaySession keeps the state needed to resume the session after a reconnect
+type gatewaySession struct {
+	mu        sync.Mutex
+	id        string
+	resumeURL string
+	sequence  *int64
+}
+
+func (gs *gatewaySession) setSequence(seq *int64) {
+	if seq == nil {
+		return
+	}
+
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+
+	s := *seq
+	gs.sequence = &s
+}
+
+func (gs *gatewaySession) getSequence() *int64 {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+
+	return gs.sequence
+}
+
+func (gs *gatewaySession) start(id, resumeURL string) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+
+	gs.id = id
+	gs.resumeURL = resumeURL
+}
+
+func (gs *gatewaySession) reset() {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+
+	gs.id = ""
+	gs.resumeURL = ""
+	gs.sequence = nil
+}
+
+// getResume gives the resume payload and the url to connect to, if the session can be resumed
+func (gs *gatewaySession) getResume(token string) (*Resume, string, bool) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+
+	if gs.id == "" || gs.sequence == nil {
+		return nil, "", false
+	}
+
+	return &Resume{Token: token, SessionID: gs.id, Sequence: *gs.sequence}, gs.resumeURL, true
+}
+
+func buildGatewayURL(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid discord gateway url %q", rawURL)
+	}
+
+	q := u.Query()
+	q.Set("v", gatewayVersion)
+	q.Set("encoding", gatewayEncoding)
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
+
+func isCloseCodeIn(err error, codes []int) bool {
+	closeErr := new(websocket.CloseError)
+	if !errors.As(err, &closeErr) {
+		return false
+	}
+
+	for _, code := range codes {
+		if closeErr.Code == code {
+			return true
+		}
+	}
+
+	return false
+}
+
+// heartbeat sends heartbeats in the interval given by the gateway, a connection which didn't acknowledge
+// the previous heartbeat is considered dead and closed to reconnect
+func (b *Bot) heartbeat(ctx context.Context, gc *gatewayConn, interval time.Duration) {
+	// the first heartbeat is sent after a random part of the interval to spread reconnecting clients
+	timer := time.NewTimer(time.Duration(rand.Float64() * float64(interval)))
+	defer timer.Stop()
+
+	gc.isAcked.Store(true)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		if !gc.isAcked.Load() {
+			logging.Warn("discord gateway didn't acknowledge the last heartbeat, will reconnect")
+			gc.ws.Close()
+			return
+		}
+
+		gc.isAcked.Store(false)
+		err := gc.send(opHeartbeat, b.session.getSequence())
+		if err != nil {
+			logging.Errorf("failed to send discord heartbeat: %v", err)
+			gc.ws.Close()
+			return
+		}
+
+		timer.Reset(interval)
+	}
+}
+
+// serve connects to the gateway, identifies or resumes the session and dispatches events till the connection is lost
+func (b *Bot) serve(gatewayURL string) error {
+	resume, resumeURL, isResumable := b.session.getResume(b.cfg.BotToken)
+	if isResumable && resumeURL != "" {
+		gatewayURL = resumeURL
+	}
+
+	connURL, err := buildGatewayURL(gatewayURL)
+	if err != nil {
+		return err
+	}
+
+	dialer := &websocket.Dialer{HandshakeTimeout: handshakeTimeout}
+	// the body of a successful handshake belongs to the websocket connection
+	ws, _, err := dialer.DialContext(b.stopCtx, connURL, nil)
+	if err != nil {
+		return errors.Wrapf(err, "failed to connect to discord gateway %q", gatewayURL)
+	}
+
+	gc := &gatewayConn{ws: ws}
+	if !b.setConn(gc) {
+		gc.close()
+		return nil
+	}
+	defer func() {
+		b.setConn(nil)
+		ws.Close()
+	}()
+
+	p, err := gc.read()
+	if err != nil {
+		return err
+	}
+
+	if p.Op != opHello {
+		return errors.Errorf("expected hello from discord gateway, got op %d", p.Op)
+	}
+
+	hello := new(Hello)
+	err = json.Unmarshal(p.Data, hello)
+	if err != nil {
+		return errors.Wrap(err, "failed to decode discord hello")
+	}
+
+	heartbeatCtx, cancel := context.WithCancel(b.stopCtx)
+	defer cancel()
+	go b.heartbeat(heartbeatCtx, gc, time.Duration(hello.HeartbeatInterval)*time.Millisecond)
+
+	if isResumable {
+		logging.Infof("resuming discord session %q", resume.SessionID)
+		err = gc.send(opResume, resume)
+	} else {
+		err = gc.send(opIdentify, &Identify{
+			Token:   b.cfg.BotToken,
+			Intents: b.cfg.Intents,
+			Properties: IdentifyProperties{
+				OS:      "linux",
+				Browser: "breathbathChatGPT",
+				Device:  "breathbathChatGPT",
+			},
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	for {
+		p, err := gc.read()
+		if err != nil {
+			if isCloseCodeIn(err, sessionCloseCodes) {
+				b.session.reset()
+			}
+			return err
+		}
+
+		err = b.handlePayload(gc, p)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (b *Bot) handlePayload(gc *gatewayConn, p *Payload) error {
+	switch p.Op {
+	case opDispatch:
+		b.session.setSequence(p.Sequence)
+		b.dispatch(p)
+	case opHeartbeat:
+		return gc.send(opHeartbeat, b.session.getSequence())
+	case opHeartbeatACK:
+		gc.isAcked.Store(true)
+	case opReconnect:
+		return errReconnect
+	case opInvalidSession:
+		isResumable := false
+		_ = json.Unmarshal(p.Data, &isResumable)
+		if !isResumable {
+			b.session.reset()
+		}
+		return errors.Errorf("discord invalidated the session, resumable: %v", isResumable)
+	default:
+		logging.Debugf("ignored discord gateway payload with op %d", p.Op)
+	}
+
+	return nil
+}
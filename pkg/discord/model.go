@@ -0,0 +1,215 @@
+package discord
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// discordEpoch is the first millisecond of 2015, the time part of snowflake ids counts from it
+const discordEpoch = 1420070400000
+
+const (
+	opDispatch       = 0
+	opHeartbeat      = 1
+	opIdentify       = 2
+	opResume         = 6
+	opReconnect      = 7
+	opInvalidSession = 9
+	opHello          = 10
+	opHeartbeatACK   = 11
+
+	eventReady             = "READY"
+	eventMessageCreate     = "MESSAGE_CREATE"
+	eventInteractionCreate = "INTERACTION_CREATE"
+	eventResumed           = "RESUMED"
+
+	interactionApplicationCommand = 2
+	interactionMessageComponent   = 3
+
+	callbackDeferredMessage = 5
+	callbackDeferredUpdate  = 6
+
+	componentActionRow = 1
+	componentButton    = 2
+	buttonStylePrimary = 1
+	buttonStyleLink    = 5
+
+	commandTypeChatInput = 1
+	optionTypeString     = 3
+
+	messageFlagEphemeral = 1 << 6
+)
+
+// Payload is a message of the gateway protocol, see https://discord.com/developers/docs/topics/gateway-events
+type Payload struct {
+	Op       int             `json:"op"`
+	Data     json.RawMessage `json:"d,omitempty"`
+	Sequence *int64          `json:"s,omitempty"`
+	Type     string          `json:"t,omitempty"`
+}
+
+type outgoingPayload struct {
+	Op   int         `json:"op"`
+	Data interface{} `json:"d"`
+}
+
+type Hello struct {
+	HeartbeatInterval int64 `json:"heartbeat_interval"`
+}
+
+type IdentifyProperties struct {
+	OS      string `json:"os"`
+	Browser string `json:"browser"`
+	Device  string `json:"device"`
+}
+
+type Identify struct {
+	Token      string             `json:"token"`
+	Intents    int                `json:"intents"`
+	Properties IdentifyProperties `json:"properties"`
+}
+
+type Resume struct {
+	Token     string `json:"token"`
+	SessionID string `json:"session_id"`
+	Sequence  int64  `json:"seq"`
+}
+
+type Ready struct {
+	SessionID        string      `json:"session_id"`
+	ResumeGatewayURL string      `json:"resume_gateway_url"`
+	User             User        `json:"user"`
+	Application      Application `json:"application"`
+}
+
+type Application struct {
+	ID string `json:"id"`
+}
+
+type User struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	Bot      bool   `json:"bot"`
+}
+
+type Member struct {
+	User *User `json:"user"`
+}
+
+type Message struct {
+	ID        string `json:"id"`
+	ChannelID string `json:"channel_id"`
+	GuildID   string `json:"guild_id"`
+	Author    *User  `json:"author"`
+	Content   string `json:"content"`
+	Mentions  []User `json:"mentions"`
+	Flags     int    `json:"flags"`
+}
+
+type Interaction struct {
+	ID            string           `json:"id"`
+	ApplicationID string           `json:"application_id"`
+	Type          int              `json:"type"`
+	Data          *InteractionData `json:"data"`
+	GuildID       string           `json:"guild_id"`
+	ChannelID     string           `json:"channel_id"`
+	Member        *Member          `json:"member"`
+	User          *User            `json:"user"`
+	Token         string           `json:"token"`
+	Message       *Message         `json:"message"`
+}
+
+// snowflakeTime gives the creation time of a message or an interaction from its id, the time of arrival if the id is invalid
+func snowflakeTime(id string) time.Time {
+	snowflake, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return time.Now()
+	}
+
+	return time.UnixMilli(int64(snowflake>>22) + discordEpoch)
+}
+
+// getUser gives the member user in guilds and the user in direct messages
+func (i *Interaction) getUser() *User {
+	if i.Member != nil && i.Member.User != nil {
+		return i.Member.User
+	}
+
+	return i.User
+}
+
+type InteractionData struct {
+	Name     string              `json:"name"`
+	Options  []InteractionOption `json:"options"`
+	CustomID string              `json:"custom_id"`
+}
+
+type InteractionOption struct {
+	Name  string      `json:"name"`
+	Value interface{} `json:"value"`
+}
+
+type InteractionCallback struct {
+	Type int                      `json:"type"`
+	Data *InteractionCallbackData `json:"data,omitempty"`
+}
+
+type InteractionCallbackData struct {
+	Flags int `json:"flags,omitempty"`
+}
+
+type MessageReference struct {
+	MessageID string `json:"message_id"`
+}
+
+type AllowedMentions struct {
+	Parse []string `json:"parse"`
+}
+
+type Component struct {
+	Type       int         `json:"type"`
+	Components []Component `json:"components,omitempty"`
+	Style      int         `json:"style,omitempty"`
+	Label      string      `json:"label,omitempty"`
+	CustomID   string      `json:"custom_id,omitempty"`
+	URL        string      `json:"url,omitempty"`
+}
+
+type AttachmentInfo struct {
+	ID       int    `json:"id"`
+	Filename string `json:"filename"`
+}
+
+type MessagePayload struct {
+	Content          string            `json:"content"`
+	MessageReference *MessageReference `json:"message_reference,omitempty"`
+	AllowedMentions  *AllowedMentions  `json:"allowed_mentions,omitempty"`
+	Components       []Component       `json:"components"`
+	Attachments      []AttachmentInfo  `json:"attachments,omitempty"`
+	Flags            int               `json:"flags,omitempty"`
+}
+
+type ApplicationCommand struct {
+	Name        string                     `json:"name"`
+	Description string                     `json:"description"`
+	Type        int                        `json:"type"`
+	Options     []ApplicationCommandOption `json:"options,omitempty"`
+	// DMPermission allows the command in direct messages with the bot
+	DMPermission bool `json:"dm_permission"`
+}
+
+type ApplicationCommandOption struct {
+	Type        int    `json:"type"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Required    bool   `json:"required"`
+}
+
+type GatewayBot struct {
+	URL string `json:"url"`
+}
+
+type RateLimitResponse struct {
+	RetryAfter float64 `json:"retry_after"`
+}
@@ -0,0 +1,27 @@
+package discord
+
+import (
+	"context"
+	"time"
+
+	"breathbathChatGPT/pkg/msg"
+
+	"github.com/pkg/errors"
+)
+
+// typingRefreshInterval is below 10 seconds after which Discord hides the typing indicator
+const typingRefreshInterval = time.Second * 8
+
+// newTypingIndicator shows that the bot is typing in the channel, Discord hides the indicator by itself
+// with the next message of the bot, so there is nothing to do on stop
+func newTypingIndicator(rest *restClient, channelID string) *msg.TypingIndicator {
+	return msg.NewTypingIndicator(typingRefreshInterval, func(ctx context.Context, isTyping bool) error {
+		if !isTyping {
+			return nil
+		}
+
+		err := rest.triggerTyping(ctx, channelID)
+
+		return errors.Wrapf(err, "failed to trigger discord typing indicator in channel %q", channelID)
+	})
+}
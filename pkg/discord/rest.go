@@ -0,0 +1,201 @@
+package discord
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+
+	"breathbathChatGPT/pkg/msg"
+
+	"github.com/pkg/errors"
+	logging "github.com/sirupsen/logrus"
+)
+
+const (
+	userAgent       = "DiscordBot (https://github.com/breathbath/chartgpt, 1.0)"
+	maxRateLimitHit = 3
+)
+
+// restClient calls the Discord HTTP API, see https://discord.com/developers/docs/reference
+type restClient struct {
+	cfg        *Config
+	httpClient *http.Client
+}
+
+func (rc *restClient) buildURL(path string, args ...interface{}) string {
+	return strings.TrimSuffix(rc.cfg.APIURL, "/") + fmt.Sprintf(path, args...)
+}
+
+// do sends the request and decodes the response into target if given, requests hitting
+// the rate limit are repeated after the time given by Discord
+func (rc *restClient) do(ctx context.Context, method, url, contentType string, body []byte, target interface{}) error {
+	for attempt := 1; ; attempt++ {
+		httpReq, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+		if err != nil {
+			return errors.Wrap(err, "failed to create discord request")
+		}
+
+		httpReq.Header.Set("Authorization", "Bot "+rc.cfg.BotToken)
+		httpReq.Header.Set("User-Agent", userAgent)
+		if contentType != "" {
+			httpReq.Header.Set("Content-Type", contentType)
+		}
+
+		resp, err := rc.httpClient.Do(httpReq)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		respBody, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return errors.Wrapf(err, "failed to read discord response of %q", url)
+		}
+
+		if resp.StatusCode == http.StatusTooManyRequests && attempt < maxRateLimitHit {
+			rateLimit := new(RateLimitResponse)
+			_ = json.Unmarshal(respBody, rateLimit)
+			wait := time.Duration(rateLimit.RetryAfter * float64(time.Second))
+
+			logging.WithContext(ctx).Warnf("hit discord rate limit on %q, will retry in %v", url, wait)
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(wait):
+			}
+			continue
+		}
+
+		if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+			return errors.Errorf("discord responded with status %d to %s %q: %s", resp.StatusCode, method, url, respBody)
+		}
+
+		if target == nil || len(respBody) == 0 {
+			return nil
+		}
+
+		err = json.Unmarshal(respBody, target)
+		if err != nil {
+			return errors.Wrapf(err, "failed to decode discord response of %q", url)
+		}
+
+		return nil
+	}
+}
+
+func (rc *restClient) doJSON(ctx context.Context, method, url string, data, target interface{}) error {
+	rawBody, err := json.Marshal(data)
+	if err != nil {
+		return errors.Wrap(err, "failed to create discord request body")
+	}
+
+	return rc.do(ctx, method, url, "application/json", rawBody, target)
+}
+
+// doWithFiles uploads the attachments together with the message as multipart form,
+// see https://discord.com/developers/docs/reference#uploading-files
+func (rc *restClient) doWithFiles(ctx context.Context, method, url string, payload *MessagePayload, files []msg.Attachment) error {
+	if len(files) == 0 {
+		return rc.doJSON(ctx, method, url, payload, nil)
+	}
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+
+	payload.Attachments = make([]AttachmentInfo, 0, len(files))
+	for i, f := range files {
+		payload.Attachments = append(payload.Attachments, AttachmentInfo{ID: i, Filename: f.FileName})
+	}
+
+	rawPayload, err := json.Marshal(payload)
+	if err != nil {
+		return errors.Wrap(err, "failed to create discord request body")
+	}
+
+	err = writer.WriteField("payload_json", string(rawPayload))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	for i, f := range files {
+		part, err := writer.CreateFormFile(fmt.Sprintf("files[%d]", i), f.FileName)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		_, err = part.Write(f.Data)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return rc.do(ctx, method, url, writer.FormDataContentType(), body.Bytes(), nil)
+}
+
+func (rc *restClient) getGatewayURL(ctx context.Context) (string, error) {
+	gatewayBot := new(GatewayBot)
+	err := rc.do(ctx, http.MethodGet, rc.buildURL("/gateway/bot"), "", nil, gatewayBot)
+	if err != nil {
+		return "", err
+	}
+
+	if gatewayBot.URL == "" {
+		return "", errors.New("discord gave an empty gateway url")
+	}
+
+	return gatewayBot.URL, nil
+}
+
+func (rc *restClient) createMessage(ctx context.Context, channelID string, payload *MessagePayload, files []msg.Attachment) error {
+	return rc.doWithFiles(ctx, http.MethodPost, rc.buildURL("/channels/%s/messages", channelID), payload, files)
+}
+
+// deleteMessage removes a message of a user, which needs the Manage Messages permission in the channel
+func (rc *restClient) deleteMessage(ctx context.Context, channelID, messageID string) error {
+	return rc.do(ctx, http.MethodDelete, rc.buildURL("/channels/%s/messages/%s", channelID, messageID), "", nil, nil)
+}
+
+// triggerTyping shows the typing indicator in the channel for 10 seconds or until the next message of the bot
+func (rc *restClient) triggerTyping(ctx context.Context, channelID string) error {
+	return rc.do(ctx, http.MethodPost, rc.buildURL("/channels/%s/typing", channelID), "", nil, nil)
+}
+
+func (rc *restClient) respondToInteraction(ctx context.Context, interaction *Interaction, callback *InteractionCallback) error {
+	return rc.doJSON(ctx, http.MethodPost, rc.buildURL("/interactions/%s/%s/callback", interaction.ID, interaction.Token), callback, nil)
+}
+
+// editOriginalResponse replaces the deferred response of the interaction
+func (rc *restClient) editOriginalResponse(ctx context.Context, interaction *Interaction, payload *MessagePayload, files []msg.Attachment) error {
+	url := rc.buildURL("/webhooks/%s/%s/messages/@original", interaction.ApplicationID, interaction.Token)
+
+	return rc.doWithFiles(ctx, http.MethodPatch, url, payload, files)
+}
+
+func (rc *restClient) deleteOriginalResponse(ctx context.Context, interaction *Interaction) error {
+	url := rc.buildURL("/webhooks/%s/%s/messages/@original", interaction.ApplicationID, interaction.Token)
+
+	return rc.do(ctx, http.MethodDelete, url, "", nil, nil)
+}
+
+func (rc *restClient) createFollowupMessage(ctx context.Context, interaction *Interaction, payload *MessagePayload, files []msg.Attachment) error {
+	url := rc.buildURL("/webhooks/%s/%s", interaction.ApplicationID, interaction.Token)
+
+	return rc.doWithFiles(ctx, http.MethodPost, url, payload, files)
+}
+
+// overwriteCommands replaces all global slash commands of the application
+func (rc *restClient) overwriteCommands(ctx context.Context, applicationID string, commands []ApplicationCommand) error {
+	return rc.doJSON(ctx, http.MethodPut, rc.buildURL("/applications/%s/commands", applicationID), commands, nil)
+}
@@ -0,0 +1,159 @@
+package email
+
+import (
+	"strings"
+)
+
+const (
+	authMethodDKIM  = "dkim"
+	authMethodDMARC = "dmarc"
+	authResultPass  = "pass"
+)
+
+// authResult is one method result of an Authentication-Results header, e.g. "dkim=pass header.d=example.org"
+type authResult struct {
+	Method     string
+	Result     string
+	Properties map[string]string
+}
+
+// parseAuthResults reads the authserv-id and the method results of an Authentication-Results header (RFC 8601),
+// comments are dropped and the method, result and property names are lowercased
+func parseAuthResults(header string) (servID string, results []authResult) {
+	parts := splitOutsideQuotes(stripComments(header), ';')
+	if len(parts) == 0 {
+		return "", nil
+	}
+
+	// the authserv-id can be followed by a version
+	idFields := strings.Fields(parts[0])
+	if len(idFields) == 0 {
+		return "", nil
+	}
+	servID = idFields[0]
+
+	for _, part := range parts[1:] {
+		fields := splitOutsideQuotes(part, ' ', '\t', '\r', '\n')
+		if len(fields) == 0 {
+			continue
+		}
+
+		method, result, ok := strings.Cut(fields[0], "=")
+		if !ok {
+			// "none" means that no method was applied
+			continue
+		}
+
+		// the method can have a version, e.g. "dkim/1"
+		method, _, _ = strings.Cut(method, "/")
+
+		res := authResult{
+			Method:     strings.ToLower(strings.TrimSpace(method)),
+			Result:     strings.ToLower(strings.TrimSpace(result)),
+			Properties: map[string]string{},
+		}
+
+		for _, field := range fields[1:] {
+			name, value, ok := strings.Cut(field, "=")
+			if !ok {
+				continue
+			}
+
+			res.Properties[strings.ToLower(name)] = strings.Trim(value, `"`)
+		}
+
+		results = append(results, res)
+	}
+
+	return servID, results
+}
+
+// stripComments removes the parenthesized comments, which can be nested, but not the parentheses within quoted strings
+func stripComments(input string) string {
+	var sb strings.Builder
+	depth := 0
+	inQuotes := false
+	isEscaped := false
+
+	for _, r := range input {
+		switch {
+		case isEscaped:
+			isEscaped = false
+		case r == '\\':
+			isEscaped = true
+		case r == '"' && depth == 0:
+			inQuotes = !inQuotes
+		case r == '(' && !inQuotes:
+			depth++
+			continue
+		case r == ')' && !inQuotes && depth > 0:
+			depth--
+			continue
+		}
+
+		if depth == 0 {
+			sb.WriteRune(r)
+		}
+	}
+
+	return sb.String()
+}
+
+// splitOutsideQuotes splits the input by any of the separators which are not within a quoted string and drops empty parts
+func splitOutsideQuotes(input string, separators ...rune) []string {
+	var parts []string
+	var sb strings.Builder
+	inQuotes := false
+
+	flush := func() {
+		part := strings.TrimSpace(sb.String())
+		if part != "" {
+			parts = append(parts, part)
+		}
+		sb.Reset()
+	}
+
+	for _, r := range input {
+		if r == '"' {
+			inQuotes = !inQuotes
+		}
+
+		if !inQuotes && containsRune(separators, r) {
+			flush()
+			continue
+		}
+
+		sb.WriteRune(r)
+	}
+	flush()
+
+	return parts
+}
+
+func containsRune(runes []rune, r rune) bool {
+	for _, candidate := range runes {
+		if candidate == r {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isAlignedPass tells if the result proves that the sender owns the domain of the From address,
+// it's either a passed DMARC check of that domain or a passed DKIM signature made by exactly that domain
+func isAlignedPass(res authResult, fromDomain string) bool {
+	if res.Result != authResultPass {
+		return false
+	}
+
+	switch res.Method {
+	case authMethodDMARC:
+		headerFrom, ok := res.Properties["header.from"]
+		return !ok || strings.EqualFold(headerFrom, fromDomain)
+	case authMethodDKIM:
+		return strings.EqualFold(res.Properties["header.d"], fromDomain)
+	default:
+		return false
+	}
+}
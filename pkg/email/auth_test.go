@@ -0,0 +1,143 @@
+package email
+
+import (
+	"net/mail"
+	"reflect"
+	"testing"
+)
+
+func TestParseAuthResults(t *testing.T) {
+	testCases := []struct {
+		name    string
+		header  string
+		servID  string
+		results []authResult
+	}{
+		{
+			name:   "comments",
+			header: "mx.example.net (postfix 3.7); dkim=pass (2048-bit key; (nested)) header.d=example.org (signer)",
+			servID: "mx.example.net",
+			results: []authResult{
+				{Method: "dkim", Result: "pass", Properties: map[string]string{"header.d": "example.org"}},
+			},
+		},
+		{
+			name:   "quoted values",
+			header: `mx.example.net; dkim=pass header.b="a;b (c)" header.d="example.org"`,
+			servID: "mx.example.net",
+			results: []authResult{
+				{Method: "dkim", Result: "pass", Properties: map[string]string{"header.b": "a;b (c)", "header.d": "example.org"}},
+			},
+		},
+		{
+			name:   "version, method version and case",
+			header: "MX.example.net 1; DKIM/1=Pass Header.D=example.org; dmarc=fail header.from=example.org",
+			servID: "MX.example.net",
+			results: []authResult{
+				{Method: "dkim", Result: "pass", Properties: map[string]string{"header.d": "example.org"}},
+				{Method: "dmarc", Result: "fail", Properties: map[string]string{"header.from": "example.org"}},
+			},
+		},
+		{
+			name:   "no result",
+			header: "mx.example.net; none",
+			servID: "mx.example.net",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			servID, results := parseAuthResults(tc.header)
+			if servID != tc.servID {
+				t.Errorf("expected authserv-id %q, got %q", tc.servID, servID)
+			}
+
+			if !reflect.DeepEqual(results, tc.results) {
+				t.Errorf("expected results %+v, got %+v", tc.results, results)
+			}
+		})
+	}
+}
+
+func TestIsTrustedSender(t *testing.T) {
+	testCases := []struct {
+		name        string
+		from        string
+		authResults []string
+		isTrusted   bool
+	}{
+		{
+			name:        "dmarc pass",
+			from:        "joe@example.org",
+			authResults: []string{"mx.example.net; spf=pass smtp.mailfrom=example.org; dmarc=pass header.from=example.org"},
+			isTrusted:   true,
+		},
+		{
+			name:        "aligned dkim pass",
+			from:        "joe@Example.org",
+			authResults: []string{"mx.example.net; dkim=pass header.d=example.ORG header.s=mail"},
+			isTrusted:   true,
+		},
+		{
+			name:        "pass in comment",
+			from:        "joe@example.org",
+			authResults: []string{"mx.example.net; dkim=fail (dmarc=pass header.from=example.org) header.d=example.org"},
+		},
+		{
+			name:        "pass in quoted value",
+			from:        "joe@example.org",
+			authResults: []string{`mx.example.net; dkim=fail header.b="; dmarc=pass header.from=example.org"`},
+		},
+		{
+			name:        "foreign authserv-id",
+			from:        "joe@example.org",
+			authResults: []string{"mx.evil.com; dmarc=pass header.from=example.org"},
+		},
+		{
+			name: "foreign authserv-id before trusted failure",
+			from: "joe@example.org",
+			authResults: []string{
+				"mx.evil.com; dmarc=pass header.from=example.org",
+				"mx.example.net; dmarc=fail header.from=example.org",
+			},
+		},
+		{
+			name:        "dkim pass of other domain",
+			from:        "joe@example.org",
+			authResults: []string{"mx.example.net; dkim=pass header.d=evil.com"},
+		},
+		{
+			name:        "dkim pass of subdomain",
+			from:        "joe@example.org",
+			authResults: []string{"mx.example.net; dkim=pass header.d=mail.example.org"},
+		},
+		{
+			name:        "dmarc pass of other from",
+			from:        "joe@example.org",
+			authResults: []string{"mx.example.net; dmarc=pass header.from=evil.com"},
+		},
+		{
+			name:        "spf pass only",
+			from:        "joe@example.org",
+			authResults: []string{"mx.example.net; spf=pass smtp.mailfrom=example.org"},
+		},
+		{
+			name: "no results",
+			from: "joe@example.org",
+		},
+	}
+
+	b := &Bot{cfg: &Config{TrustedAuthServID: "mx.example.net"}}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			im := &incomingMessage{From: &mail.Address{Address: tc.from}, AuthResults: tc.authResults}
+
+			if isTrusted := b.isTrustedSender(im); isTrusted != tc.isTrusted {
+				t.Errorf("expected trusted %v, got %v", tc.isTrusted, isTrusted)
+			}
+		})
+	}
+}
@@ -0,0 +1,370 @@
+package email
+
+import (
+	"context"
+	"net/mail"
+	"strings"
+	"sync"
+	"time"
+
+	"breathbathChatGPT/pkg/msg"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-imap/commands"
+	"github.com/pkg/errors"
+	logging "github.com/sirupsen/logrus"
+)
+
+const Platform = "email"
+
+// Bot polls the IMAP mailbox for unseen emails and answers them over SMTP in the same thread,
+// emails are handled one by one in the order of arrival and marked as seen afterwards
+type Bot struct {
+	cfg        *Config
+	msgHandler *msg.Router
+	from       *mail.Address
+
+	stopCtx context.Context
+	stop    context.CancelFunc
+	stopped chan struct{}
+	once    sync.Once
+}
+
+func NewBot(cfg *Config, r *msg.Router) (*Bot, error) {
+	e := cfg.Validate()
+	if e.HasErrors() {
+		return nil, e
+	}
+
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	stopCtx, stop := context.WithCancel(context.Background())
+
+	return &Bot{
+		cfg:        cfg,
+		msgHandler: r,
+		from:       from,
+		stopCtx:    stopCtx,
+		stop:       stop,
+		stopped:    make(chan struct{}),
+	}, nil
+}
+
+// Start polls the mailbox till the bot is stopped, failed polls are repeated in the next interval
+func (b *Bot) Start() error {
+	defer b.once.Do(func() {
+		close(b.stopped)
+	})
+
+	logging.Infof("will poll mailbox %q at %q every %v", b.cfg.Mailbox, b.cfg.IMAPAddr, b.cfg.PollInterval)
+
+	ticker := time.NewTicker(b.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		err := b.poll()
+		if err != nil {
+			logging.Errorf("failed to poll mailbox %q: %v", b.cfg.Mailbox, err)
+		}
+
+		select {
+		case <-b.stopCtx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Stop waits till the email in progress is answered but not longer than the shutdown timeout
+func (b *Bot) Stop() {
+	logging.Info("will stop email bot")
+
+	b.stop()
+
+	select {
+	case <-b.stopped:
+		logging.Info("stopped email bot")
+	case <-time.After(b.cfg.ShutdownTimeout):
+		logging.Warnf("stopped waiting for the email in progress after %v", b.cfg.ShutdownTimeout)
+	}
+}
+
+func (b *Bot) poll() error {
+	imapClient, err := b.cfg.dialIMAP()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err := imapClient.Logout()
+		if err != nil {
+			logging.Debugf("failed to log out from imap server: %v", err)
+		}
+	}()
+
+	_, err = imapClient.Select(b.cfg.Mailbox, false)
+	if err != nil {
+		return errors.Wrapf(err, "failed to select mailbox %q", b.cfg.Mailbox)
+	}
+
+	criteria := imap.NewSearchCriteria()
+	criteria.WithoutFlags = []string{imap.SeenFlag, imap.DeletedFlag}
+
+	uids, err := imapClient.UidSearch(criteria)
+	if err != nil {
+		return errors.Wrap(err, "failed to search unseen emails")
+	}
+
+	if len(uids) == 0 {
+		return nil
+	}
+
+	logging.Debugf("found %d unseen emails", len(uids))
+
+	sizes, err := b.fetchSizes(imapClient, uids)
+	if err != nil {
+		return err
+	}
+
+	for _, uid := range uids {
+		if b.stopCtx.Err() != nil {
+			return nil
+		}
+
+		if sizes[uid] > b.cfg.MaxMessageSize {
+			logging.Warnf("skipped email %d of %d bytes which is larger than %d bytes", uid, sizes[uid], b.cfg.MaxMessageSize)
+			err = b.setFlag(imapClient, uid, imap.SeenFlag)
+		} else {
+			err = b.processMessage(imapClient, uid)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (b *Bot) fetchSizes(imapClient *client.Client, uids []uint32) (map[uint32]int64, error) {
+	seqSet := new(imap.SeqSet)
+	seqSet.AddNum(uids...)
+
+	messages := make(chan *imap.Message, len(uids))
+	err := imapClient.UidFetch(seqSet, []imap.FetchItem{imap.FetchUid, imap.FetchRFC822Size}, messages)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to fetch email sizes")
+	}
+
+	sizes := map[uint32]int64{}
+	for m := range messages {
+		sizes[m.Uid] = int64(m.Size)
+	}
+
+	return sizes, nil
+}
+
+func (b *Bot) setFlag(imapClient *client.Client, uid uint32, flag string) error {
+	seqSet := new(imap.SeqSet)
+	seqSet.AddNum(uid)
+
+	err := imapClient.UidStore(seqSet, imap.FormatFlagsOp(imap.AddFlags, true), []interface{}{flag}, nil)
+	if err != nil {
+		return errors.Wrapf(err, "failed to flag email %d as %s", uid, flag)
+	}
+
+	return nil
+}
+
+// processMessage answers the email and marks it as seen, emails with sensitive data, e.g. passwords, are deleted
+func (b *Bot) processMessage(imapClient *client.Client, uid uint32) error {
+	seqSet := new(imap.SeqSet)
+	seqSet.AddNum(uid)
+
+	section := &imap.BodySectionName{Peek: true}
+	messages := make(chan *imap.Message, 1)
+	err := imapClient.UidFetch(seqSet, []imap.FetchItem{imap.FetchUid, section.FetchItem()}, messages)
+	if err != nil {
+		return errors.Wrapf(err, "failed to fetch email %d", uid)
+	}
+
+	m := <-messages
+	if m == nil || m.GetBody(section) == nil {
+		logging.Warnf("email %d disappeared before it was fetched", uid)
+		return nil
+	}
+
+	isHidden := false
+	im, err := parseMessage(uid, m.GetBody(section))
+	if err != nil {
+		logging.Errorf("failed to parse email %d: %v", uid, err)
+	} else {
+		isHidden = b.handleMessage(im)
+	}
+
+	if isHidden {
+		return b.deleteMessage(imapClient, uid)
+	}
+
+	return b.setFlag(imapClient, uid, imap.SeenFlag)
+}
+
+// deleteMessage removes only the given email, a plain EXPUNGE would also remove the emails flagged as deleted
+// by other clients, so the email is moved to EMAIL_SENSITIVE_MAILBOX or expunged by its UID
+func (b *Bot) deleteMessage(imapClient *client.Client, uid uint32) error {
+	seqSet := new(imap.SeqSet)
+	seqSet.AddNum(uid)
+
+	// without the MOVE extension the client falls back to a plain EXPUNGE
+	supportsMove, err := imapClient.Support("MOVE")
+	if err != nil {
+		return errors.Wrap(err, "failed to check imap capabilities")
+	}
+
+	if b.cfg.SensitiveMailbox != "" && supportsMove {
+		err = imapClient.UidMove(seqSet, b.cfg.SensitiveMailbox)
+		if err != nil {
+			return errors.Wrapf(err, "failed to move email with sensitive data to %q", b.cfg.SensitiveMailbox)
+		}
+
+		return nil
+	}
+
+	err = b.setFlag(imapClient, uid, imap.DeletedFlag)
+	if err != nil {
+		return err
+	}
+
+	supportsUIDPlus, err := imapClient.Support("UIDPLUS")
+	if err != nil {
+		return errors.Wrap(err, "failed to check imap capabilities")
+	}
+
+	if !supportsUIDPlus {
+		logging.Warnf("imap server supports neither UIDPLUS nor MOVE, email %d with sensitive data is only flagged as deleted", uid)
+		return nil
+	}
+
+	cmd := &commands.Uid{Cmd: &imap.Command{Name: "EXPUNGE", Arguments: []interface{}{seqSet}}}
+
+	status, err := imapClient.Execute(cmd, nil)
+	if err == nil {
+		err = status.Err()
+	}
+
+	if err != nil {
+		return errors.Wrap(err, "failed to delete email with sensitive data")
+	}
+
+	return nil
+}
+
+// isTrustedSender checks that the receiving server verified the domain of the From address, since the header can be forged,
+// only the Authentication-Results headers of the trusted server are considered
+func (b *Bot) isTrustedSender(im *incomingMessage) bool {
+	_, fromDomain, found := strings.Cut(im.From.Address, "@")
+	if !found || fromDomain == "" {
+		return false
+	}
+
+	for _, header := range im.AuthResults {
+		servID, results := parseAuthResults(header)
+		if !strings.EqualFold(servID, b.cfg.TrustedAuthServID) {
+			continue
+		}
+
+		for _, res := range results {
+			if isAlignedPass(res, fromDomain) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (b *Bot) messageToRequest(im *incomingMessage) *msg.Request {
+	// an empty body happens if the question is given only as subject
+	text := im.Text
+	if text == "" && len(im.References) == 0 {
+		text = strings.TrimSpace(im.Subject)
+	}
+
+	timestamp := im.Date
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+
+	return &msg.Request{
+		Platform: Platform,
+		ID:       im.MessageID,
+		Sender: &msg.Sender{
+			ID:        strings.ToLower(im.From.Address),
+			FirstName: im.From.Name,
+		},
+		Message: text,
+		Meta: map[string]interface{}{
+			"conversation_id": im.getThreadID(),
+			"timestamp":       timestamp.Unix(),
+		},
+	}
+}
+
+// handleMessage routes the email and sends the answer, it tells if the email contained sensitive data
+func (b *Bot) handleMessage(im *incomingMessage) (isHidden bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), b.cfg.HandleTimeout)
+	defer cancel()
+
+	log := logging.WithContext(ctx)
+
+	switch {
+	case im.IsAutomatic:
+		log.Infof("ignored automatic email %q from %q", im.MessageID, im.From.Address)
+		return false
+	case strings.EqualFold(im.From.Address, b.from.Address):
+		log.Infof("ignored own email %q", im.MessageID)
+		return false
+	case !b.isTrustedSender(im):
+		log.Warnf("ignored email %q from %q without passed sender verification", im.MessageID, im.From.Address)
+		return false
+	}
+
+	req := b.messageToRequest(im)
+	log.Debugf("got email from %q: %q", req.Sender.ID, req.Message)
+
+	resp, err := b.msgHandler.Route(ctx, req)
+	if err != nil {
+		log.Errorf("failed to handle email: %v", err)
+		resp = &msg.Response{Message: "Unexpected error", Type: msg.Error}
+	}
+
+	if resp == nil {
+		return false
+	}
+
+	isHidden = resp.Options.IsResponseToHiddenMessage()
+
+	if resp.Message == "" && len(resp.Attachments) == 0 {
+		log.Info("response message is empty, will send nothing to the sender")
+		return isHidden
+	}
+
+	reply, err := buildReply(b.from, im, resp)
+	if err != nil {
+		log.Errorf("failed to compose reply to email %q: %v", im.MessageID, err)
+		return isHidden
+	}
+
+	err = b.cfg.sendMail(b.from.Address, []string{im.From.Address}, reply)
+	if err != nil {
+		log.Errorf("failed to send reply to email %q: %v", im.MessageID, err)
+		return isHidden
+	}
+
+	log.Debugf("sent reply to %q", im.From.Address)
+
+	return isHidden
+}
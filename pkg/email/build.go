@@ -0,0 +1,12 @@
+package email
+
+import "breathbathChatGPT/pkg/msg"
+
+func BuildBot(r *msg.Router) (*Bot, error) {
+	config, err := LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewBot(config, r)
+}
@@ -0,0 +1,108 @@
+package email
+
+import (
+	"net/mail"
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+	"github.com/pkg/errors"
+
+	"breathbathChatGPT/pkg/errs"
+)
+
+const (
+	SecurityTLS      = "tls"
+	SecurityStartTLS = "starttls"
+	SecurityNone     = "none"
+)
+
+type Config struct {
+	IMAPAddr     string `envconfig:"EMAIL_IMAP_ADDR"`
+	IMAPSecurity string `envconfig:"EMAIL_IMAP_SECURITY" default:"tls"`
+	IMAPUser     string `envconfig:"EMAIL_IMAP_USER"`
+	IMAPPassword string `envconfig:"EMAIL_IMAP_PASSWORD"`
+	Mailbox      string `envconfig:"EMAIL_MAILBOX" default:"INBOX"`
+	// SensitiveMailbox receives the emails with passwords instead of deleting them with UID EXPUNGE
+	SensitiveMailbox string `envconfig:"EMAIL_SENSITIVE_MAILBOX"`
+
+	SMTPAddr     string `envconfig:"EMAIL_SMTP_ADDR"`
+	SMTPSecurity string `envconfig:"EMAIL_SMTP_SECURITY" default:"starttls"`
+	// SMTPUser and SMTPPassword fall back to the IMAP credentials, an empty user sends without authentication
+	SMTPUser     string `envconfig:"EMAIL_SMTP_USER"`
+	SMTPPassword string `envconfig:"EMAIL_SMTP_PASSWORD"`
+
+	From string `envconfig:"EMAIL_FROM"`
+	// TrustedAuthServID requires a passed DMARC check or a DKIM signature of the sender domain
+	// in the Authentication-Results header added by this server
+	TrustedAuthServID  string        `envconfig:"EMAIL_TRUSTED_AUTHSERV_ID"`
+	InsecureSkipVerify bool          `envconfig:"EMAIL_INSECURE_SKIP_VERIFY" default:"false"`
+	PollInterval       time.Duration `envconfig:"EMAIL_POLL_INTERVAL" default:"30s"`
+	ShutdownTimeout    time.Duration `envconfig:"EMAIL_SHUTDOWN_TIMEOUT" default:"30s"`
+	HandleTimeout      time.Duration `envconfig:"EMAIL_HANDLE_TIMEOUT" default:"10m"`
+	MaxMessageSize     int64         `envconfig:"EMAIL_MAX_MESSAGE_SIZE" default:"1048576"`
+}
+
+func validateSecurity(e *errs.Multi, name, security string) {
+	switch security {
+	case SecurityTLS, SecurityStartTLS, SecurityNone:
+	default:
+		e.Errf("%s should be one of %q, %q or %q, got %q", name, SecurityTLS, SecurityStartTLS, SecurityNone, security)
+	}
+}
+
+func (c *Config) Validate() *errs.Multi {
+	e := errs.NewMulti()
+
+	if c.IMAPAddr == "" {
+		e.Errf("EMAIL_IMAP_ADDR cannot be empty")
+	}
+
+	if c.IMAPUser == "" {
+		e.Errf("EMAIL_IMAP_USER cannot be empty")
+	}
+
+	if c.SMTPAddr == "" {
+		e.Errf("EMAIL_SMTP_ADDR cannot be empty")
+	}
+
+	validateSecurity(e, "EMAIL_IMAP_SECURITY", c.IMAPSecurity)
+	validateSecurity(e, "EMAIL_SMTP_SECURITY", c.SMTPSecurity)
+
+	if _, err := mail.ParseAddress(c.From); err != nil {
+		e.Errf("EMAIL_FROM should be a valid address, got %q: %v", c.From, err)
+	}
+
+	if c.TrustedAuthServID == "" {
+		e.Errf("EMAIL_TRUSTED_AUTHSERV_ID cannot be empty, without it anybody could write in the name of a user")
+	}
+
+	if c.PollInterval <= 0 {
+		e.Errf("EMAIL_POLL_INTERVAL should be positive, got %v", c.PollInterval)
+	}
+
+	if c.HandleTimeout <= 0 {
+		e.Errf("EMAIL_HANDLE_TIMEOUT should be positive, got %v", c.HandleTimeout)
+	}
+
+	if c.MaxMessageSize <= 0 {
+		e.Errf("EMAIL_MAX_MESSAGE_SIZE should be positive, got %d", c.MaxMessageSize)
+	}
+
+	return e
+}
+
+func LoadConfig() (cfg *Config, err error) {
+	cfg = new(Config)
+
+	err = envconfig.Process("email", cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load email config")
+	}
+
+	if cfg.SMTPUser == "" && cfg.SMTPPassword == "" {
+		cfg.SMTPUser = cfg.IMAPUser
+		cfg.SMTPPassword = cfg.IMAPPassword
+	}
+
+	return cfg, nil
+}
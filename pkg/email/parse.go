@@ -0,0 +1,171 @@
+package email
+
+import (
+	"html"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	// decoders of the charsets used by mail clients besides UTF-8
+	_ "github.com/emersion/go-message/charset"
+	"github.com/emersion/go-message/mail"
+	"github.com/pkg/errors"
+)
+
+var (
+	htmlTagRegex     = regexp.MustCompile(`<[^>]*>`)
+	htmlBreakRegex   = regexp.MustCompile(`(?i)<br\s*/?>|</p>|</div>`)
+	quoteHeaderRegex = regexp.MustCompile(`(?i)^(on\s.+wrote:|-+\s*original message\s*-+)$`)
+)
+
+// incomingMessage is the part of a received email used to answer it
+type incomingMessage struct {
+	UID        uint32
+	MessageID  string
+	InReplyTo  []string
+	References []string
+	Subject    string
+	From       *mail.Address
+	Date       time.Time
+	Text       string
+	// IsAutomatic is set for auto replies, bounces and mailing lists, which should never be answered
+	IsAutomatic bool
+	AuthResults []string
+}
+
+// getThreadID gives the id of the first message of the thread, which is the conversation id of all replies
+func (im *incomingMessage) getThreadID() string {
+	if len(im.References) > 0 {
+		return im.References[0]
+	}
+
+	if len(im.InReplyTo) > 0 {
+		return im.InReplyTo[0]
+	}
+
+	return im.MessageID
+}
+
+func isAutomaticMessage(h *mail.Header) bool {
+	if autoSubmitted := strings.ToLower(strings.TrimSpace(h.Get("Auto-Submitted"))); autoSubmitted != "" && autoSubmitted != "no" {
+		return true
+	}
+
+	switch strings.ToLower(strings.TrimSpace(h.Get("Precedence"))) {
+	case "bulk", "list", "junk":
+		return true
+	}
+
+	return h.Get("List-Id") != "" || h.Get("X-Autoreply") != "" || h.Get("X-Autorespond") != ""
+}
+
+// parseMessage reads the headers and the text of the email, the plain text part is preferred over the HTML one
+func parseMessage(uid uint32, r io.Reader) (*incomingMessage, error) {
+	mr, err := mail.CreateReader(r)
+	if err != nil && mr == nil {
+		return nil, errors.Wrap(err, "failed to read email")
+	}
+	defer mr.Close()
+
+	im := &incomingMessage{
+		UID:         uid,
+		IsAutomatic: isAutomaticMessage(&mr.Header),
+		AuthResults: mr.Header.Values("Authentication-Results"),
+	}
+
+	from, err := mr.Header.AddressList("From")
+	if err != nil || len(from) == 0 {
+		return nil, errors.Errorf("email %d has no valid sender", uid)
+	}
+	im.From = from[0]
+
+	im.MessageID, _ = mr.Header.MessageID()
+	im.InReplyTo, _ = mr.Header.MsgIDList("In-Reply-To")
+	im.References, _ = mr.Header.MsgIDList("References")
+	im.Subject, _ = mr.Header.Subject()
+	im.Date, _ = mr.Header.Date()
+
+	plainText, htmlText := "", ""
+	for {
+		p, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read part of email %d", uid)
+		}
+
+		inlineHeader, ok := p.Header.(*mail.InlineHeader)
+		if !ok {
+			continue
+		}
+
+		contentType, _, _ := inlineHeader.ContentType()
+		if contentType != "text/plain" && contentType != "text/html" {
+			continue
+		}
+
+		body, err := io.ReadAll(p.Body)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read text of email %d", uid)
+		}
+
+		if contentType == "text/plain" && plainText == "" {
+			plainText = string(body)
+		} else if contentType == "text/html" && htmlText == "" {
+			htmlText = string(body)
+		}
+	}
+
+	if plainText == "" && htmlText != "" {
+		plainText = html.UnescapeString(htmlTagRegex.ReplaceAllString(htmlBreakRegex.ReplaceAllString(htmlText, "\n"), ""))
+	}
+
+	im.Text = stripQuotedText(plainText)
+
+	return im, nil
+}
+
+// stripQuotedText removes the quoted previous messages and the signature, so that only the new text is routed
+func stripQuotedText(text string) string {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+
+	res := make([]string, 0, len(lines))
+	for _, line := range lines {
+		trimmedLine := strings.TrimSpace(line)
+		if line == "-- " || quoteHeaderRegex.MatchString(trimmedLine) {
+			break
+		}
+
+		if strings.HasPrefix(trimmedLine, ">") {
+			res = stripWrappedQuoteHeader(res)
+			break
+		}
+
+		res = append(res, line)
+	}
+
+	return strings.TrimSpace(strings.Join(res, "\n"))
+}
+
+// stripWrappedQuoteHeader removes the quote header which clients wrap to two lines, e.g. "On Mon, Joe <joe@example.org>\nwrote:"
+func stripWrappedQuoteHeader(lines []string) []string {
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	if len(lines) == 0 || !strings.HasSuffix(strings.ToLower(strings.TrimSpace(lines[len(lines)-1])), "wrote:") {
+		return lines
+	}
+
+	lastLine := strings.TrimSpace(lines[len(lines)-1])
+	lines = lines[:len(lines)-1]
+
+	if len(lines) > 0 && !strings.HasPrefix(strings.ToLower(lastLine), "on ") &&
+		strings.HasPrefix(strings.ToLower(strings.TrimSpace(lines[len(lines)-1])), "on ") {
+		lines = lines[:len(lines)-1]
+	}
+
+	return lines
+}
@@ -0,0 +1,197 @@
+package email
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	"breathbathChatGPT/pkg/msg"
+
+	"github.com/emersion/go-message/mail"
+	"github.com/pkg/errors"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	gmhtml "github.com/yuin/goldmark/renderer/html"
+)
+
+const replySubjectPrefix = "Re: "
+
+// raw HTML in Markdown is not rendered, so answers of ChatGPT cannot inject markup
+var markdownRenderer = goldmark.New(
+	goldmark.WithExtensions(extension.GFM),
+	goldmark.WithRendererOptions(gmhtml.WithHardWraps()),
+)
+
+// buildBodies gives the Markdown and the HTML body of the response, buttons are listed as commands to send,
+// attachments without data are given as links
+func buildBodies(resp *msg.Response) (markdownBody, htmlBody string) {
+	markdownBody, htmlBody = resp.Message, ""
+
+	switch resp.Options.GetFormat() {
+	case msg.OutputFormatMarkdown, msg.OutputFormatMarkdown1, msg.OutputFormatMarkdown2:
+		var buf bytes.Buffer
+		err := markdownRenderer.Convert([]byte(resp.Message), &buf)
+		if err == nil {
+			htmlBody = buf.String()
+		} else {
+			htmlBody = "<pre>" + html.EscapeString(resp.Message) + "</pre>"
+		}
+	case msg.OutputFormatHTML:
+		htmlBody = resp.Message
+		markdownBody = html.UnescapeString(htmlTagRegex.ReplaceAllString(htmlBreakRegex.ReplaceAllString(resp.Message, "\n"), ""))
+	case msg.OutputFormatUndefined:
+		fallthrough
+	default:
+		htmlBody = "<p>" + strings.ReplaceAll(html.EscapeString(resp.Message), "\n", "<br>") + "</p>"
+	}
+
+	if resp.Type == msg.Error {
+		markdownBody = "❗" + markdownBody
+		htmlBody = "<p>❗</p>" + htmlBody
+	}
+
+	commands := []string{}
+	for _, row := range resp.Options.GetInlineButtons() {
+		for _, b := range row {
+			switch {
+			case b.URL != "":
+				markdownBody += fmt.Sprintf("\n- [%s](%s)", b.Text, b.URL)
+				htmlBody += fmt.Sprintf(`<p><a href="%s">%s</a></p>`, html.EscapeString(b.URL), html.EscapeString(b.Text))
+			case b.Data != "":
+				commands = append(commands, b.Data)
+			}
+		}
+	}
+
+	for _, predefinedResp := range resp.Options.GetPredefinedResponses() {
+		if predefinedResp != "" {
+			commands = append(commands, string(predefinedResp))
+		}
+	}
+
+	for _, a := range resp.Attachments {
+		if len(a.Data) == 0 && a.URL != "" {
+			markdownBody += fmt.Sprintf("\n- [%s](%s)", a.FileName, a.URL)
+			htmlBody += fmt.Sprintf(`<p><a href="%s">%s</a></p>`, html.EscapeString(a.URL), html.EscapeString(a.FileName))
+		}
+	}
+
+	if len(commands) > 0 {
+		markdownBody += "\n\nReply with one of:"
+		htmlBody += "<p>Reply with one of:</p><ul>"
+		for _, c := range commands {
+			markdownBody += "\n- `" + c + "`"
+			htmlBody += "<li><code>" + html.EscapeString(c) + "</code></li>"
+		}
+		htmlBody += "</ul>"
+	}
+
+	return markdownBody, htmlBody
+}
+
+func buildReplySubject(subject string) string {
+	if strings.HasPrefix(strings.ToLower(subject), strings.ToLower(replySubjectPrefix)) {
+		return subject
+	}
+
+	return replySubjectPrefix + subject
+}
+
+// buildReply composes the answer in the thread of the incoming email with a Markdown and an HTML alternative,
+// the Auto-Submitted header keeps other bots from answering it
+func buildReply(from *mail.Address, im *incomingMessage, resp *msg.Response) ([]byte, error) {
+	var h mail.Header
+	h.SetDate(time.Now())
+	h.SetAddressList("From", []*mail.Address{from})
+	h.SetAddressList("To", []*mail.Address{im.From})
+	h.SetSubject(buildReplySubject(im.Subject))
+	h.Set("Auto-Submitted", "auto-replied")
+
+	_, hostname, _ := strings.Cut(from.Address, "@")
+	err := h.GenerateMessageIDWithHostname(hostname)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to generate message id")
+	}
+
+	if im.MessageID != "" {
+		h.SetMsgIDList("In-Reply-To", []string{im.MessageID})
+		h.SetMsgIDList("References", append(append([]string{}, im.References...), im.MessageID))
+	}
+
+	var buf bytes.Buffer
+	mw, err := mail.CreateWriter(&buf, h)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create email")
+	}
+
+	markdownBody, htmlBody := buildBodies(resp)
+
+	tw, err := mw.CreateInline()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create email text")
+	}
+
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain", markdownBody},
+		{"text/html", htmlBody},
+	} {
+		var ph mail.InlineHeader
+		ph.SetContentType(part.contentType, map[string]string{"charset": "utf-8"})
+
+		w, err := tw.CreatePart(ph)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to create %s part", part.contentType)
+		}
+
+		_, err = w.Write([]byte(part.body))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to write %s part", part.contentType)
+		}
+
+		err = w.Close()
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	err = tw.Close()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	for _, a := range resp.Attachments {
+		if len(a.Data) == 0 {
+			continue
+		}
+
+		var ah mail.AttachmentHeader
+		ah.SetFilename(a.FileName)
+		if a.MIMEType != "" {
+			ah.SetContentType(a.MIMEType, nil)
+		}
+
+		w, err := mw.CreateAttachment(ah)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to create attachment %q", a.FileName)
+		}
+
+		_, err = w.Write(a.Data)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to write attachment %q", a.FileName)
+		}
+
+		err = w.Close()
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	err = mw.Close()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return buf.Bytes(), nil
+}
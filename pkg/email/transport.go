@@ -0,0 +1,123 @@
+package email
+
+import (
+	"bytes"
+	"crypto/tls"
+	"io"
+	"net"
+
+	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-sasl"
+	"github.com/emersion/go-smtp"
+	"github.com/pkg/errors"
+)
+
+func (c *Config) buildTLSConfig(addr string) *tls.Config {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+
+	return &tls.Config{
+		ServerName: host,
+		// some self-hosted servers use self-signed certificates
+		InsecureSkipVerify: c.InsecureSkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+}
+
+// dialIMAP connects and logs in to the IMAP server
+func (c *Config) dialIMAP() (*client.Client, error) {
+	var (
+		imapClient *client.Client
+		err        error
+	)
+
+	tlsConfig := c.buildTLSConfig(c.IMAPAddr)
+	if c.IMAPSecurity == SecurityTLS {
+		imapClient, err = client.DialTLS(c.IMAPAddr, tlsConfig)
+	} else {
+		imapClient, err = client.Dial(c.IMAPAddr)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to connect to imap server %q", c.IMAPAddr)
+	}
+
+	if c.IMAPSecurity == SecurityStartTLS {
+		err = imapClient.StartTLS(tlsConfig)
+		if err != nil {
+			_ = imapClient.Logout()
+			return nil, errors.Wrap(err, "failed to start tls with imap server")
+		}
+	}
+
+	err = imapClient.Login(c.IMAPUser, c.IMAPPassword)
+	if err != nil {
+		_ = imapClient.Logout()
+		return nil, errors.Wrapf(err, "failed to log in to imap server as %q", c.IMAPUser)
+	}
+
+	return imapClient, nil
+}
+
+// sendMail delivers the composed email over SMTP
+func (c *Config) sendMail(from string, to []string, data []byte) error {
+	var (
+		smtpClient *smtp.Client
+		err        error
+	)
+
+	tlsConfig := c.buildTLSConfig(c.SMTPAddr)
+	if c.SMTPSecurity == SecurityTLS {
+		smtpClient, err = smtp.DialTLS(c.SMTPAddr, tlsConfig)
+	} else {
+		smtpClient, err = smtp.Dial(c.SMTPAddr)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to connect to smtp server %q", c.SMTPAddr)
+	}
+	defer smtpClient.Close()
+
+	if c.SMTPSecurity == SecurityStartTLS {
+		err = smtpClient.StartTLS(tlsConfig)
+		if err != nil {
+			return errors.Wrap(err, "failed to start tls with smtp server")
+		}
+	}
+
+	if c.SMTPUser != "" {
+		err = smtpClient.Auth(sasl.NewPlainClient("", c.SMTPUser, c.SMTPPassword))
+		if err != nil {
+			return errors.Wrapf(err, "failed to authenticate at smtp server as %q", c.SMTPUser)
+		}
+	}
+
+	err = smtpClient.Mail(from, nil)
+	if err != nil {
+		return errors.Wrapf(err, "smtp server rejected sender %q", from)
+	}
+
+	for _, addr := range to {
+		err = smtpClient.Rcpt(addr)
+		if err != nil {
+			return errors.Wrapf(err, "smtp server rejected recipient %q", addr)
+		}
+	}
+
+	w, err := smtpClient.Data()
+	if err != nil {
+		return errors.Wrap(err, "failed to start sending email")
+	}
+
+	_, err = io.Copy(w, bytes.NewReader(data))
+	if err != nil {
+		return errors.Wrap(err, "failed to send email")
+	}
+
+	err = w.Close()
+	if err != nil {
+		return errors.Wrap(err, "smtp server rejected email")
+	}
+
+	return errors.WithStack(smtpClient.Quit())
+}
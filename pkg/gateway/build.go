@@ -0,0 +1,28 @@
+package gateway
+
+import (
+	"github.com/pkg/errors"
+
+	"breathbathChatGPT/pkg/auth"
+	"breathbathChatGPT/pkg/chatgpt"
+	"breathbathChatGPT/pkg/storage"
+)
+
+func BuildServer(db storage.Client) (*Server, error) {
+	config, err := LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	chatGptCfg, err := chatgpt.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	scriptRunner, ok := db.(storage.ScriptRunner)
+	if !ok {
+		return nil, errors.New("gateway usage needs a storage which supports scripts")
+	}
+
+	return NewServer(config, chatGptCfg.APIKey, auth.NewUserStorage(db), NewUsageRecorder(scriptRunner))
+}
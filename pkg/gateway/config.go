@@ -0,0 +1,66 @@
+package gateway
+
+import (
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+	"github.com/pkg/errors"
+
+	"breathbathChatGPT/pkg/errs"
+)
+
+type Config struct {
+	Listen          string        `envconfig:"GATEWAY_LISTEN" default:":8081"`
+	TLSCert         string        `envconfig:"GATEWAY_TLS_CERT"`
+	TLSKey          string        `envconfig:"GATEWAY_TLS_KEY"`
+	ShutdownTimeout time.Duration `envconfig:"GATEWAY_SHUTDOWN_TIMEOUT" default:"30s"`
+	MaxBodySize     int64         `envconfig:"GATEWAY_MAX_BODY_SIZE" default:"10485760"`
+	UpstreamURL     string        `envconfig:"GATEWAY_UPSTREAM_URL" default:"https://api.openai.com"`
+
+	UserModels  []string `envconfig:"GATEWAY_USER_MODELS"`
+	AdminModels []string `envconfig:"GATEWAY_ADMIN_MODELS"`
+
+	UserDailyTokens  int `envconfig:"GATEWAY_USER_DAILY_TOKENS" default:"100000"`
+	AdminDailyTokens int `envconfig:"GATEWAY_ADMIN_DAILY_TOKENS" default:"0"`
+}
+
+func (c *Config) Validate() *errs.Multi {
+	e := errs.NewMulti()
+
+	if c.Listen == "" {
+		e.Errf("GATEWAY_LISTEN cannot be empty")
+	}
+
+	if c.UpstreamURL == "" {
+		e.Errf("GATEWAY_UPSTREAM_URL cannot be empty")
+	}
+
+	if (c.TLSCert == "") != (c.TLSKey == "") {
+		e.Errf("GATEWAY_TLS_CERT and GATEWAY_TLS_KEY should be set together")
+	}
+
+	if c.MaxBodySize <= 0 {
+		e.Errf("GATEWAY_MAX_BODY_SIZE should be positive, got %d", c.MaxBodySize)
+	}
+
+	if c.UserDailyTokens < 0 {
+		e.Errf("GATEWAY_USER_DAILY_TOKENS cannot be negative, got %d", c.UserDailyTokens)
+	}
+
+	if c.AdminDailyTokens < 0 {
+		e.Errf("GATEWAY_ADMIN_DAILY_TOKENS cannot be negative, got %d", c.AdminDailyTokens)
+	}
+
+	return e
+}
+
+func LoadConfig() (cfg *Config, err error) {
+	cfg = new(Config)
+
+	err = envconfig.Process("gateway", cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load gateway config")
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,44 @@
+package gateway
+
+const (
+	errTypeInvalidRequest = "invalid_request_error"
+	errTypeAuthentication = "authentication_error"
+	errTypePermission     = "permission_error"
+	errTypeRateLimit      = "rate_limit_error"
+	errTypeServer         = "server_error"
+)
+
+// ErrorResponse follows the error format of OpenAI API, so SDKs show the gateway errors properly
+type ErrorResponse struct {
+	Error ErrorDetails `json:"error"`
+}
+
+type ErrorDetails struct {
+	Message string `json:"message"`
+	Type    string `json:"type"`
+	Code    string `json:"code,omitempty"`
+}
+
+type TokenUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// completionUsage is the part of a completion or a stream chunk which is needed to record the usage
+type completionUsage struct {
+	Choices []interface{} `json:"choices"`
+	Usage   *TokenUsage   `json:"usage"`
+}
+
+type Model struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+}
+
+type ModelsResponse struct {
+	Object string  `json:"object"`
+	Data   []Model `json:"data"`
+}
@@ -0,0 +1,457 @@
+package gateway
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"breathbathChatGPT/pkg/auth"
+
+	"github.com/pkg/errors"
+	logging "github.com/sirupsen/logrus"
+)
+
+const (
+	ChatCompletionsPath = "/v1/chat/completions"
+	ModelsPath          = "/v1/models"
+
+	readHeaderTimeout = time.Second * 10
+	bearerPrefix      = "Bearer "
+	sseDataPrefix     = "data: "
+	sseDone           = "[DONE]"
+	maxSSELineSize    = 1024 * 1024
+)
+
+// Server implements the chat completions and models endpoints of OpenAI API, it authenticates callers with
+// API tokens issued by admins and forwards their requests upstream with the shared API key
+type Server struct {
+	cfg         *Config
+	upstreamKey string
+	us          *auth.UserStorage
+	usage       *UsageRecorder
+	server      *http.Server
+	httpClient  *http.Client
+}
+
+func NewServer(cfg *Config, upstreamKey string, us *auth.UserStorage, usage *UsageRecorder) (*Server, error) {
+	e := cfg.Validate()
+	if upstreamKey == "" {
+		e.Errf("upstream API key cannot be empty")
+	}
+	if e.HasErrors() {
+		return nil, e
+	}
+
+	s := &Server{
+		cfg:         cfg,
+		upstreamKey: upstreamKey,
+		us:          us,
+		usage:       usage,
+		httpClient:  &http.Client{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(ChatCompletionsPath, s.handleChatCompletions)
+	mux.HandleFunc(ModelsPath, s.handleModels)
+
+	s.server = &http.Server{
+		Addr:              cfg.Listen,
+		Handler:           mux,
+		ReadHeaderTimeout: readHeaderTimeout,
+	}
+
+	return s, nil
+}
+
+func (s *Server) Start() error {
+	logging.Infof("will listen for gateway requests on %q", s.cfg.Listen)
+
+	var err error
+	if s.cfg.TLSCert != "" {
+		err = s.server.ListenAndServeTLS(s.cfg.TLSCert, s.cfg.TLSKey)
+	} else {
+		err = s.server.ListenAndServe()
+	}
+
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+
+	return errors.Wrap(err, "gateway listener failed")
+}
+
+// Stop waits for the requests in progress, including streams, till the shutdown timeout
+func (s *Server) Stop() {
+	logging.Info("will stop gateway server")
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.ShutdownTimeout)
+	defer cancel()
+
+	err := s.server.Shutdown(ctx)
+	if err != nil {
+		logging.Errorf("failed to shutdown gateway server gracefully: %v", err)
+		return
+	}
+
+	logging.Info("stopped gateway server")
+}
+
+func (s *Server) authenticate(w http.ResponseWriter, r *http.Request) *auth.CachedUser {
+	ctx := r.Context()
+
+	authHeader := r.Header.Get("Authorization")
+	if !strings.HasPrefix(authHeader, bearerPrefix) {
+		s.writeError(ctx, w, http.StatusUnauthorized, errTypeAuthentication, "invalid_api_key", "missing API token")
+		return nil
+	}
+
+	user, err := s.us.FindUserByAPIToken(ctx, strings.TrimSpace(strings.TrimPrefix(authHeader, bearerPrefix)))
+	if err != nil {
+		logging.WithContext(ctx).Errorf("failed to authenticate gateway request: %v", err)
+		s.writeError(ctx, w, http.StatusInternalServerError, errTypeServer, "", "internal error")
+		return nil
+	}
+
+	if !user.IsLoggedIn() {
+		logging.WithContext(ctx).Warnf("got gateway request with invalid token from %q", r.RemoteAddr)
+		s.writeError(ctx, w, http.StatusUnauthorized, errTypeAuthentication, "invalid_api_key", "invalid API token")
+		return nil
+	}
+
+	return user
+}
+
+func (s *Server) getAllowedModels(user *auth.CachedUser) []string {
+	if user.Role == auth.AdminRole {
+		return s.cfg.AdminModels
+	}
+
+	return s.cfg.UserModels
+}
+
+// isModelAllowed checks the model against the allowlist of the user role, an empty allowlist allows any model
+func (s *Server) isModelAllowed(user *auth.CachedUser, model string) bool {
+	allowedModels := s.getAllowedModels(user)
+	if len(allowedModels) == 0 {
+		return true
+	}
+
+	for _, allowedModel := range allowedModels {
+		if strings.EqualFold(strings.TrimSpace(allowedModel), model) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *Server) getDailyTokens(user *auth.CachedUser) int {
+	if user.Role == auth.AdminRole {
+		return s.cfg.AdminDailyTokens
+	}
+
+	return s.cfg.UserDailyTokens
+}
+
+func (s *Server) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	log := logging.WithContext(ctx)
+
+	if r.Method != http.MethodPost {
+		s.writeError(ctx, w, http.StatusMethodNotAllowed, errTypeInvalidRequest, "", "only POST method is allowed")
+		return
+	}
+
+	user := s.authenticate(w, r)
+	if user == nil {
+		return
+	}
+
+	// the body is kept as a map to forward the fields unknown to the gateway unchanged
+	body := map[string]interface{}{}
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, s.cfg.MaxBodySize)).Decode(&body)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, errTypeInvalidRequest, "", "invalid JSON body: "+err.Error())
+		return
+	}
+
+	model, _ := body["model"].(string)
+	if model == "" {
+		s.writeError(ctx, w, http.StatusBadRequest, errTypeInvalidRequest, "", "model cannot be empty")
+		return
+	}
+
+	if !s.isModelAllowed(user, model) {
+		s.writeError(ctx, w, http.StatusForbidden, errTypePermission, "model_not_allowed", fmt.Sprintf("model %q is not allowed", model))
+		return
+	}
+
+	reservation, err := s.usage.Reserve(ctx, user, s.getDailyTokens(user), getMaxTokens(body))
+	if err != nil {
+		log.Errorf("failed to check gateway quota: %v", err)
+		s.writeError(ctx, w, http.StatusInternalServerError, errTypeServer, "", "internal error")
+		return
+	}
+
+	if reservation == nil {
+		log.Warnf("daily token quota of user %q is exceeded", user.Login)
+		s.writeError(ctx, w, http.StatusTooManyRequests, errTypeRateLimit, "quota_exceeded", "daily token quota is exceeded")
+		return
+	}
+
+	// the reservation is released even if the upstream request fails
+	var usage *TokenUsage
+	defer func() {
+		s.recordUsage(ctx, user, reservation, usage)
+	}()
+
+	isStream, _ := body["stream"].(bool)
+	isUsageRequested := false
+	if isStream {
+		// usage is sent in the last chunk of a stream only on request, the gateway needs it to record the usage
+		streamOptions, _ := body["stream_options"].(map[string]interface{})
+		if streamOptions == nil {
+			streamOptions = map[string]interface{}{}
+		}
+		isUsageRequested, _ = streamOptions["include_usage"].(bool)
+		streamOptions["include_usage"] = true
+		body["stream_options"] = streamOptions
+	}
+
+	upstreamResp, err := s.requestUpstream(ctx, http.MethodPost, ChatCompletionsPath, body)
+	if err != nil {
+		log.Errorf("failed to forward chat completion request: %v", err)
+		s.writeError(ctx, w, http.StatusBadGateway, errTypeServer, "", "upstream request failed")
+		return
+	}
+	defer upstreamResp.Body.Close()
+
+	log.Debugf("forwarded chat completion request of %q for model %q, stream: %v", user.Login, model, isStream)
+
+	if upstreamResp.StatusCode != http.StatusOK || !isStream {
+		usage = s.forwardResponse(ctx, w, upstreamResp)
+		return
+	}
+
+	usage = s.forwardStream(ctx, w, upstreamResp, isUsageRequested)
+}
+
+// getMaxTokens gives the completion tokens limit of the request, which is reserved in the quota while the request runs
+func getMaxTokens(body map[string]interface{}) int {
+	for _, field := range []string{"max_completion_tokens", "max_tokens"} {
+		maxTokens, ok := body[field].(float64)
+		if ok && maxTokens > 0 {
+			return int(maxTokens)
+		}
+	}
+
+	return 0
+}
+
+func (s *Server) requestUpstream(ctx context.Context, method, path string, body interface{}) (*http.Response, error) {
+	var bodyReader io.Reader
+	if body != nil {
+		rawBody, err := json.Marshal(body)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create upstream request body")
+		}
+		bodyReader = bytes.NewReader(rawBody)
+	}
+
+	upstreamReq, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(s.cfg.UpstreamURL, "/")+path, bodyReader)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create upstream request")
+	}
+
+	upstreamReq.Header.Set("Authorization", bearerPrefix+s.upstreamKey)
+	upstreamReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.httpClient.Do(upstreamReq)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return resp, nil
+}
+
+// forwardResponse passes the complete upstream response to the caller and gives the usage of successful completions
+func (s *Server) forwardResponse(ctx context.Context, w http.ResponseWriter, upstreamResp *http.Response) *TokenUsage {
+	log := logging.WithContext(ctx)
+
+	rawBody, err := io.ReadAll(upstreamResp.Body)
+	if err != nil {
+		log.Errorf("failed to read upstream response: %v", err)
+		s.writeError(ctx, w, http.StatusBadGateway, errTypeServer, "", "failed to read upstream response")
+		return nil
+	}
+
+	w.Header().Set("Content-Type", upstreamResp.Header.Get("Content-Type"))
+	w.WriteHeader(upstreamResp.StatusCode)
+
+	_, err = w.Write(rawBody)
+	if err != nil {
+		log.Errorf("failed to write gateway response: %v", err)
+	}
+
+	if upstreamResp.StatusCode != http.StatusOK {
+		log.Warnf("upstream responded with status %d: %s", upstreamResp.StatusCode, string(rawBody))
+		return nil
+	}
+
+	completion := new(completionUsage)
+	err = json.Unmarshal(rawBody, completion)
+	if err != nil {
+		log.Warnf("failed to parse usage of upstream response: %v", err)
+	}
+
+	return completion.Usage
+}
+
+// forwardStream passes the server sent events to the caller as they arrive and gives the usage of the last chunk,
+// the usage chunk is dropped if the caller didn't request it
+func (s *Server) forwardStream(
+	ctx context.Context,
+	w http.ResponseWriter,
+	upstreamResp *http.Response,
+	isUsageRequested bool,
+) *TokenUsage {
+	log := logging.WithContext(ctx)
+
+	flusher, _ := w.(http.Flusher)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	var usage *TokenUsage
+
+	scanner := bufio.NewScanner(upstreamResp.Body)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), maxSSELineSize)
+
+	isSkippingEvent := false
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if line == "" && isSkippingEvent {
+			isSkippingEvent = false
+			continue
+		}
+
+		if data := strings.TrimPrefix(line, sseDataPrefix); data != line && data != sseDone {
+			chunk := new(completionUsage)
+			if json.Unmarshal([]byte(data), chunk) == nil && chunk.Usage != nil {
+				usage = chunk.Usage
+				if !isUsageRequested && len(chunk.Choices) == 0 {
+					isSkippingEvent = true
+					continue
+				}
+			}
+		}
+
+		_, err := io.WriteString(w, line+"\n")
+		if err != nil {
+			log.Warnf("failed to write gateway stream, the caller has probably gone: %v", err)
+			break
+		}
+
+		if line == "" && flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	if err := scanner.Err(); err != nil {
+		log.Errorf("failed to read upstream stream: %v", err)
+	}
+
+	return usage
+}
+
+func (s *Server) recordUsage(ctx context.Context, user *auth.CachedUser, reservation *UsageReservation, tokens *TokenUsage) {
+	log := logging.WithContext(ctx)
+
+	if tokens == nil {
+		log.Warnf("got no token usage for the request of %q, will record the request only", user.Login)
+	}
+
+	// the caller can be gone already and the request context canceled, but the usage should be recorded anyway
+	err := s.usage.Record(context.Background(), reservation, tokens)
+	if err != nil {
+		log.Errorf("failed to record gateway usage of %q: %v", user.Login, err)
+	}
+}
+
+func (s *Server) handleModels(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	log := logging.WithContext(ctx)
+
+	if r.Method != http.MethodGet {
+		s.writeError(ctx, w, http.StatusMethodNotAllowed, errTypeInvalidRequest, "", "only GET method is allowed")
+		return
+	}
+
+	user := s.authenticate(w, r)
+	if user == nil {
+		return
+	}
+
+	upstreamResp, err := s.requestUpstream(ctx, http.MethodGet, ModelsPath, nil)
+	if err != nil {
+		log.Errorf("failed to request upstream models: %v", err)
+		s.writeError(ctx, w, http.StatusBadGateway, errTypeServer, "", "upstream request failed")
+		return
+	}
+	defer upstreamResp.Body.Close()
+
+	upstreamModels := new(ModelsResponse)
+	if upstreamResp.StatusCode == http.StatusOK {
+		err = json.NewDecoder(upstreamResp.Body).Decode(upstreamModels)
+	} else {
+		err = errors.Errorf("upstream responded with status %d", upstreamResp.StatusCode)
+	}
+
+	if err != nil {
+		log.Errorf("failed to read upstream models: %v", err)
+		s.writeError(ctx, w, http.StatusBadGateway, errTypeServer, "", "failed to read upstream models")
+		return
+	}
+
+	models := &ModelsResponse{Object: "list", Data: []Model{}}
+	for _, m := range upstreamModels.Data {
+		if s.isModelAllowed(user, m.ID) {
+			models.Data = append(models.Data, m)
+		}
+	}
+
+	s.writeJSON(ctx, w, http.StatusOK, models)
+}
+
+func (s *Server) writeError(ctx context.Context, w http.ResponseWriter, status int, errType, code, message string) {
+	s.writeJSON(ctx, w, status, &ErrorResponse{
+		Error: ErrorDetails{
+			Message: message,
+			Type:    errType,
+			Code:    code,
+		},
+	})
+}
+
+func (s *Server) writeJSON(ctx context.Context, w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	err := json.NewEncoder(w).Encode(data)
+	if err != nil {
+		logging.WithContext(ctx).Errorf("failed to write gateway response: %v", err)
+	}
+}
@@ -0,0 +1,115 @@
+package gateway
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"breathbathChatGPT/pkg/auth"
+	"breathbathChatGPT/pkg/storage"
+)
+
+const (
+	// usage is kept in redis hashes since v2, v1 had JSON values which couldn't be changed atomically
+	usageVersion   = "v2"
+	usageValidity  = time.Hour * 24 * 31
+	usageDayFormat = "2006-01-02"
+)
+
+// reserveUsageScript checks the daily quota and counts the request in one step, so that parallel requests cannot pass
+// the check with the same usage, the reserved tokens count towards the quota till the actual usage is recorded
+const reserveUsageScript = `
+local quota = tonumber(ARGV[1])
+if quota > 0 then
+	local used = tonumber(redis.call('HGET', KEYS[1], 'total_tokens') or '0')
+		+ tonumber(redis.call('HGET', KEYS[1], 'reserved_tokens') or '0')
+	if used >= quota then
+		return 0
+	end
+end
+
+redis.call('HINCRBY', KEYS[1], 'requests', 1)
+redis.call('HINCRBY', KEYS[1], 'reserved_tokens', ARGV[2])
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+
+return 1
+`
+
+// recordUsageScript releases the reserved tokens and adds the actual ones
+const recordUsageScript = `
+redis.call('HINCRBY', KEYS[1], 'reserved_tokens', -tonumber(ARGV[1]))
+redis.call('HINCRBY', KEYS[1], 'prompt_tokens', ARGV[2])
+redis.call('HINCRBY', KEYS[1], 'completion_tokens', ARGV[3])
+redis.call('HINCRBY', KEYS[1], 'total_tokens', ARGV[4])
+redis.call('PEXPIRE', KEYS[1], ARGV[5])
+
+return 1
+`
+
+// UsageReservation is a request admitted by the quota, it's recorded in the usage of the day when it was admitted
+type UsageReservation struct {
+	key    string
+	tokens int
+}
+
+type UsageRecorder struct {
+	runner storage.ScriptRunner
+}
+
+func NewUsageRecorder(runner storage.ScriptRunner) *UsageRecorder {
+	return &UsageRecorder{runner: runner}
+}
+
+func getUsageKey(user *auth.CachedUser, day time.Time) string {
+	return storage.GenerateCacheKey(
+		usageVersion,
+		"gateway",
+		"usage",
+		user.PlatformName,
+		user.Login,
+		day.UTC().Format(usageDayFormat),
+	)
+}
+
+// Reserve counts the request in the usage of the current day if the daily tokens quota isn't used up yet,
+// 0 tokens means no quota, the returned reservation is nil if the quota is exceeded
+func (ur *UsageRecorder) Reserve(ctx context.Context, user *auth.CachedUser, dailyTokens, tokens int) (*UsageReservation, error) {
+	key := getUsageKey(user, time.Now())
+
+	res, err := ur.runner.RunScript(ctx, reserveUsageScript, []string{key}, dailyTokens, tokens, usageValidity.Milliseconds())
+	if err != nil {
+		return nil, err
+	}
+
+	isReserved, ok := res.(int64)
+	if !ok {
+		return nil, errors.Errorf("unexpected usage script result %v", res)
+	}
+
+	if isReserved != 1 {
+		return nil, nil
+	}
+
+	return &UsageReservation{key: key, tokens: tokens}, nil
+}
+
+// Record replaces the reserved tokens with the actual usage, nil tokens only release the reservation
+func (ur *UsageRecorder) Record(ctx context.Context, reservation *UsageReservation, tokens *TokenUsage) error {
+	if tokens == nil {
+		tokens = &TokenUsage{}
+	}
+
+	_, err := ur.runner.RunScript(
+		ctx,
+		recordUsageScript,
+		[]string{reservation.key},
+		reservation.tokens,
+		tokens.PromptTokens,
+		tokens.CompletionTokens,
+		tokens.TotalTokens,
+		usageValidity.Milliseconds(),
+	)
+
+	return err
+}
@@ -18,6 +18,18 @@ type Provider interface {
 	GetHelp(ctx context.Context, req *msg.Request) Result
 }
 
+// Command is a short command description for the command menus of messengers
+type Command struct {
+	Name        string
+	Description string
+	IsAdminOnly bool
+}
+
+// CommandsProvider gives the commands which should be listed in the command menu
+type CommandsProvider interface {
+	GetCommands() []Command
+}
+
 type Handler struct {
 	Providers     []Provider
 	AdminDetector func(req *msg.Request) bool
@@ -73,3 +85,9 @@ func (ch *Handler) Handle(ctx context.Context, req *msg.Request) (*msg.Response,
 		Options: op,
 	}, nil
 }
+
+func (ch *Handler) GetCommands() []Command {
+	return []Command{
+		{Name: helpCommand, Description: "show the list of available commands", IsAdminOnly: ch.ModeDetector()},
+	}
+}
@@ -0,0 +1,15 @@
+package httpapi
+
+import (
+	"breathbathChatGPT/pkg/auth"
+	"breathbathChatGPT/pkg/msg"
+)
+
+func BuildServer(r *msg.Router, us *auth.UserStorage) (*Server, error) {
+	config, err := LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewServer(config, r, us)
+}
@@ -0,0 +1,47 @@
+package httpapi
+
+import (
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+	"github.com/pkg/errors"
+
+	"breathbathChatGPT/pkg/errs"
+)
+
+type Config struct {
+	Listen          string        `envconfig:"HTTP_API_LISTEN" default:":8080"`
+	TLSCert         string        `envconfig:"HTTP_API_TLS_CERT"`
+	TLSKey          string        `envconfig:"HTTP_API_TLS_KEY"`
+	ShutdownTimeout time.Duration `envconfig:"HTTP_API_SHUTDOWN_TIMEOUT" default:"30s"`
+	MaxBodySize     int64         `envconfig:"HTTP_API_MAX_BODY_SIZE" default:"1048576"`
+}
+
+func (c *Config) Validate() *errs.Multi {
+	e := errs.NewMulti()
+
+	if c.Listen == "" {
+		e.Errf("HTTP_API_LISTEN cannot be empty")
+	}
+
+	if (c.TLSCert == "") != (c.TLSKey == "") {
+		e.Errf("HTTP_API_TLS_CERT and HTTP_API_TLS_KEY should be set together")
+	}
+
+	if c.MaxBodySize <= 0 {
+		e.Errf("HTTP_API_MAX_BODY_SIZE should be positive, got %d", c.MaxBodySize)
+	}
+
+	return e
+}
+
+func LoadConfig() (cfg *Config, err error) {
+	cfg = new(Config)
+
+	err = envconfig.Process("http_api", cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load http api config")
+	}
+
+	return cfg, nil
+}
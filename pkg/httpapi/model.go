@@ -0,0 +1,125 @@
+package httpapi
+
+import "breathbathChatGPT/pkg/msg"
+
+type MessageRequest struct {
+	Message        string `json:"message"`
+	ConversationID string `json:"conversation_id"`
+}
+
+type Button struct {
+	Text string `json:"text"`
+	Data string `json:"data,omitempty"`
+	URL  string `json:"url,omitempty"`
+}
+
+type Attachment struct {
+	Type     string `json:"type"`
+	FileName string `json:"file_name,omitempty"`
+	MIMEType string `json:"mime_type,omitempty"`
+	Data     []byte `json:"data,omitempty"`
+	URL      string `json:"url,omitempty"`
+	Caption  string `json:"caption,omitempty"`
+}
+
+type MessageResponse struct {
+	Message     string       `json:"message"`
+	Type        string       `json:"type"`
+	Format      string       `json:"format"`
+	Buttons     [][]Button   `json:"buttons,omitempty"`
+	Attachments []Attachment `json:"attachments,omitempty"`
+}
+
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+func typeToString(t msg.Type) string {
+	switch t {
+	case msg.Success:
+		return "success"
+	case msg.Error:
+		return "error"
+	case msg.Undefined:
+		return "undefined"
+	default:
+		return "undefined"
+	}
+}
+
+func formatToString(f msg.OutputFormat) string {
+	switch f {
+	case msg.OutputFormatMarkdown, msg.OutputFormatMarkdown1, msg.OutputFormatMarkdown2:
+		return "markdown"
+	case msg.OutputFormatHTML:
+		return "html"
+	case msg.OutputFormatUndefined:
+		return "plain"
+	default:
+		return "plain"
+	}
+}
+
+func attachmentTypeToString(t msg.AttachmentType) string {
+	switch t {
+	case msg.AttachmentPhoto:
+		return "photo"
+	case msg.AttachmentDocument:
+		return "document"
+	case msg.AttachmentAudio:
+		return "audio"
+	case msg.AttachmentVoice:
+		return "voice"
+	case msg.AttachmentUndefined:
+		return "undefined"
+	default:
+		return "undefined"
+	}
+}
+
+// buttons are given as predefined responses or inline buttons, API clients send the data back as a message
+func buildButtons(opts *msg.Options) [][]Button {
+	buttons := [][]Button{}
+	for _, row := range opts.GetInlineButtons() {
+		buttonsRow := make([]Button, 0, len(row))
+		for _, b := range row {
+			buttonsRow = append(buttonsRow, Button{Text: b.Text, Data: b.Data, URL: b.URL})
+		}
+		buttons = append(buttons, buttonsRow)
+	}
+
+	predefinedRow := []Button{}
+	for _, r := range opts.GetPredefinedResponses() {
+		if r == "" {
+			continue
+		}
+		predefinedRow = append(predefinedRow, Button{Text: string(r), Data: string(r)})
+	}
+	if len(predefinedRow) > 0 {
+		buttons = append(buttons, predefinedRow)
+	}
+
+	return buttons
+}
+
+func responseToAPI(resp *msg.Response) *MessageResponse {
+	res := &MessageResponse{
+		Message: resp.Message,
+		Type:    typeToString(resp.Type),
+		Format:  formatToString(resp.Options.GetFormat()),
+		Buttons: buildButtons(resp.Options),
+	}
+
+	for _, a := range resp.Attachments {
+		res.Attachments = append(res.Attachments, Attachment{
+			Type:     attachmentTypeToString(a.Type),
+			FileName: a.FileName,
+			MIMEType: a.MIMEType,
+			Data:     a.Data,
+			URL:      a.URL,
+			Caption:  a.Caption,
+		})
+	}
+
+	return res
+}
@@ -0,0 +1,183 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"breathbathChatGPT/pkg/auth"
+	"breathbathChatGPT/pkg/msg"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	logging "github.com/sirupsen/logrus"
+)
+
+const (
+	MessagesPath = "/v1/messages"
+
+	defaultConversationID = "default"
+	readHeaderTimeout     = time.Second * 10
+	bearerPrefix          = "Bearer "
+)
+
+// Server exposes the message router over a JSON HTTP API, callers authenticate with API tokens issued by admins
+type Server struct {
+	cfg        *Config
+	msgHandler *msg.Router
+	us         *auth.UserStorage
+	server     *http.Server
+}
+
+func NewServer(cfg *Config, r *msg.Router, us *auth.UserStorage) (*Server, error) {
+	e := cfg.Validate()
+	if e.HasErrors() {
+		return nil, e
+	}
+
+	s := &Server{
+		cfg:        cfg,
+		msgHandler: r,
+		us:         us,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(MessagesPath, s.handleMessage)
+
+	s.server = &http.Server{
+		Addr:              cfg.Listen,
+		Handler:           mux,
+		ReadHeaderTimeout: readHeaderTimeout,
+	}
+
+	return s, nil
+}
+
+func (s *Server) Start() error {
+	logging.Infof("will listen for http api requests on %q", s.cfg.Listen)
+
+	var err error
+	if s.cfg.TLSCert != "" {
+		err = s.server.ListenAndServeTLS(s.cfg.TLSCert, s.cfg.TLSKey)
+	} else {
+		err = s.server.ListenAndServe()
+	}
+
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+
+	return errors.Wrap(err, "http api listener failed")
+}
+
+// Stop waits for the requests in progress till the shutdown timeout
+func (s *Server) Stop() {
+	logging.Info("will stop http api server")
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.ShutdownTimeout)
+	defer cancel()
+
+	err := s.server.Shutdown(ctx)
+	if err != nil {
+		logging.Errorf("failed to shutdown http api server gracefully: %v", err)
+		return
+	}
+
+	logging.Info("stopped http api server")
+}
+
+func (s *Server) handleMessage(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	log := logging.WithContext(ctx)
+
+	if r.Method != http.MethodPost {
+		s.writeError(ctx, w, http.StatusMethodNotAllowed, "only POST method is allowed")
+		return
+	}
+
+	user, err := s.authenticate(r)
+	if err != nil {
+		log.Errorf("failed to authenticate http api request: %v", err)
+		s.writeError(ctx, w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	if user == nil {
+		log.Warnf("got http api request with invalid token from %q", r.RemoteAddr)
+		s.writeError(ctx, w, http.StatusUnauthorized, "invalid API token")
+		return
+	}
+
+	apiReq := new(MessageRequest)
+	err = json.NewDecoder(http.MaxBytesReader(w, r.Body, s.cfg.MaxBodySize)).Decode(apiReq)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return
+	}
+
+	apiReq.Message = strings.TrimSpace(apiReq.Message)
+	if apiReq.Message == "" {
+		s.writeError(ctx, w, http.StatusBadRequest, "message cannot be empty")
+		return
+	}
+
+	resp, err := s.msgHandler.Route(ctx, s.buildRequest(user, apiReq))
+	if err != nil {
+		log.Errorf("failed to handle http api message: %v", err)
+		s.writeError(ctx, w, http.StatusInternalServerError, "Unexpected error")
+		return
+	}
+
+	if resp == nil {
+		resp = &msg.Response{}
+	}
+
+	s.writeJSON(ctx, w, http.StatusOK, responseToAPI(resp))
+}
+
+func (s *Server) authenticate(r *http.Request) (*auth.CachedUser, error) {
+	authHeader := r.Header.Get("Authorization")
+	if !strings.HasPrefix(authHeader, bearerPrefix) {
+		return nil, nil
+	}
+
+	return s.us.FindUserByAPIToken(r.Context(), strings.TrimSpace(strings.TrimPrefix(authHeader, bearerPrefix)))
+}
+
+// buildRequest sends the message on behalf of the token owner, so it shares the users and conversations of its platform
+func (s *Server) buildRequest(user *auth.CachedUser, apiReq *MessageRequest) *msg.Request {
+	conversationID := apiReq.ConversationID
+	if conversationID == "" {
+		conversationID = defaultConversationID
+	}
+
+	return &msg.Request{
+		Platform: user.PlatformName,
+		ID:       uuid.NewString(),
+		Sender: &msg.Sender{
+			ID: user.Login,
+		},
+		Message: apiReq.Message,
+		Meta: map[string]interface{}{
+			"conversation_id": conversationID,
+			"timestamp":       time.Now().Unix(),
+			"is_api_request":  true,
+		},
+	}
+}
+
+func (s *Server) writeError(ctx context.Context, w http.ResponseWriter, status int, message string) {
+	s.writeJSON(ctx, w, status, &ErrorResponse{Error: message})
+}
+
+func (s *Server) writeJSON(ctx context.Context, w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	err := json.NewEncoder(w).Encode(data)
+	if err != nil {
+		logging.WithContext(ctx).Errorf("failed to write http api response: %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+package markdown
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	htmlTagRegex  = regexp.MustCompile(`<(/?)([a-zA-Z]+)([^>]*)>`)
+	htmlHrefRegex = regexp.MustCompile(`href\s*=\s*"([^"]*)"`)
+)
+
+// HTMLConverter gives the markup of a platform for the tags of the HTML produced by the handlers
+type HTMLConverter interface {
+	// Text escapes the unescaped text between the tags, isCode tells if it's inside of a code or pre tag
+	Text(text string, isCode bool) string
+	// Tag gives the markup of a lower case tag, href is the link of an "a" tag, unknown tags should give ""
+	Tag(tag string, isClosing bool, href string) string
+}
+
+// ConvertHTML converts the subset of HTML used by the handlers with the converter of a platform
+func ConvertHTML(text string, c HTMLConverter) string {
+	var sb strings.Builder
+	hrefs := []string{}
+	isCode := false
+
+	pos := 0
+	for _, match := range htmlTagRegex.FindAllStringSubmatchIndex(text, -1) {
+		sb.WriteString(c.Text(html.UnescapeString(text[pos:match[0]]), isCode))
+		pos = match[1]
+
+		isClosing := text[match[2]:match[3]] == "/"
+		tag := strings.ToLower(text[match[4]:match[5]])
+		attrs := text[match[6]:match[7]]
+
+		href := ""
+		switch tag {
+		case "code", "pre":
+			isCode = !isClosing
+		case "a":
+			if !isClosing {
+				if hrefMatch := htmlHrefRegex.FindStringSubmatch(attrs); hrefMatch != nil {
+					href = html.UnescapeString(hrefMatch[1])
+				}
+				hrefs = append(hrefs, href)
+				break
+			}
+
+			// a closing tag without an opening one is dropped
+			if len(hrefs) == 0 {
+				continue
+			}
+			href = hrefs[len(hrefs)-1]
+			hrefs = hrefs[:len(hrefs)-1]
+		}
+
+		sb.WriteString(c.Tag(tag, isClosing, href))
+	}
+	sb.WriteString(c.Text(html.UnescapeString(text[pos:]), isCode))
+
+	return sb.String()
+}
@@ -0,0 +1,206 @@
+package markdown
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	east "github.com/yuin/goldmark/extension/ast"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+const listIndent = "  "
+
+var markdownParser = goldmark.New(goldmark.WithExtensions(extension.Strikethrough)).Parser()
+
+// Renderer gives the markup of a platform for the Markdown entities, text is given already rendered
+// to all methods except of Text, Code and CodeBlock which get the raw text
+type Renderer interface {
+	// Text escapes the plain text for the platform
+	Text(text string) string
+	Bold(text string) string
+	Italic(text string) string
+	Strikethrough(text string) string
+	Code(code string) string
+	Link(text, url string) string
+	CodeBlock(code, lang string) string
+	Heading(text string, level int) string
+	Blockquote(text string) string
+	ThematicBreak() string
+}
+
+// Render parses Markdown produced by the model and writes it with the markup of the renderer,
+// blocks are separated like in the source, list items are prefixed with bullets or numbers
+func Render(markdown string, r Renderer) string {
+	source := []byte(strings.ReplaceAll(markdown, "\r\n", "\n"))
+	doc := markdownParser.Parse(text.NewReader(source))
+
+	w := &walker{source: source, r: r}
+
+	return w.renderBlocks(doc, 0)
+}
+
+type walker struct {
+	source []byte
+	r      Renderer
+}
+
+// renderBlocks joins the children blocks with an empty line if there is one in the source
+func (w *walker) renderBlocks(parent ast.Node, depth int) string {
+	var sb strings.Builder
+
+	for child := parent.FirstChild(); child != nil; child = child.NextSibling() {
+		if child != parent.FirstChild() {
+			sb.WriteString("\n")
+			if child.HasBlankPreviousLines() {
+				sb.WriteString("\n")
+			}
+		}
+
+		sb.WriteString(w.renderBlock(child, depth))
+	}
+
+	return sb.String()
+}
+
+func (w *walker) renderBlock(node ast.Node, depth int) string {
+	switch n := node.(type) {
+	case *ast.Paragraph, *ast.TextBlock:
+		return w.renderInlines(n)
+	case *ast.Heading:
+		return w.r.Heading(w.renderInlines(n), n.Level)
+	case *ast.ThematicBreak:
+		return w.r.ThematicBreak()
+	case *ast.FencedCodeBlock:
+		return w.r.CodeBlock(w.readLines(n), string(n.Language(w.source)))
+	case *ast.CodeBlock:
+		return w.r.CodeBlock(w.readLines(n), "")
+	case *ast.Blockquote:
+		return w.r.Blockquote(w.renderBlocks(n, depth))
+	case *ast.List:
+		return w.renderList(n, depth)
+	case *ast.HTMLBlock:
+		// raw HTML of the model is shown as text, so it cannot inject markup
+		return w.r.Text(w.readLines(n))
+	default:
+		return w.renderBlocks(n, depth)
+	}
+}
+
+func (w *walker) renderList(list *ast.List, depth int) string {
+	var sb strings.Builder
+
+	number := list.Start
+	for item := list.FirstChild(); item != nil; item = item.NextSibling() {
+		if item != list.FirstChild() {
+			sb.WriteString("\n")
+			if item.HasBlankPreviousLines() {
+				sb.WriteString("\n")
+			}
+		}
+
+		marker := "• "
+		if list.IsOrdered() {
+			marker = fmt.Sprintf("%d. ", number)
+			number++
+		}
+
+		sb.WriteString(strings.Repeat(listIndent, depth) + marker + w.renderBlocks(item, depth+1))
+	}
+
+	return sb.String()
+}
+
+func (w *walker) readLines(node ast.Node) string {
+	var sb strings.Builder
+
+	lines := node.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		line := lines.At(i)
+		sb.Write(line.Value(w.source))
+	}
+
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+func (w *walker) renderInlines(parent ast.Node) string {
+	var sb strings.Builder
+
+	for child := parent.FirstChild(); child != nil; child = child.NextSibling() {
+		sb.WriteString(w.renderInline(child))
+	}
+
+	return sb.String()
+}
+
+func (w *walker) renderInline(node ast.Node) string {
+	switch n := node.(type) {
+	case *ast.Text:
+		res := w.r.Text(w.readText(n))
+		if n.SoftLineBreak() || n.HardLineBreak() {
+			res += "\n"
+		}
+
+		return res
+	case *ast.String:
+		return w.r.Text(string(n.Value))
+	case *ast.CodeSpan:
+		return w.r.Code(w.readRawText(n))
+	case *ast.Emphasis:
+		if n.Level >= 2 {
+			return w.r.Bold(w.renderInlines(n))
+		}
+
+		return w.r.Italic(w.renderInlines(n))
+	case *east.Strikethrough:
+		return w.r.Strikethrough(w.renderInlines(n))
+	case *ast.Link:
+		return w.r.Link(w.renderInlines(n), string(n.Destination))
+	case *ast.Image:
+		return w.r.Link(w.renderInlines(n), string(n.Destination))
+	case *ast.AutoLink:
+		url := string(n.URL(w.source))
+
+		return w.r.Link(w.r.Text(string(n.Label(w.source))), url)
+	case *ast.RawHTML:
+		var sb strings.Builder
+		for i := 0; i < n.Segments.Len(); i++ {
+			segment := n.Segments.At(i)
+			sb.Write(segment.Value(w.source))
+		}
+
+		return w.r.Text(sb.String())
+	default:
+		return w.renderInlines(n)
+	}
+}
+
+// readText gives the text without backslash escapes and with resolved HTML entities
+func (w *walker) readText(n *ast.Text) string {
+	value := n.Segment.Value(w.source)
+	if n.IsRaw() {
+		return string(value)
+	}
+
+	value = util.UnescapePunctuations(value)
+	value = util.ResolveNumericReferences(value)
+	value = util.ResolveEntityNames(value)
+
+	return string(value)
+}
+
+// readRawText gives the text of the children as it's written in the source, e.g. of inline code
+func (w *walker) readRawText(parent ast.Node) string {
+	var sb strings.Builder
+
+	for child := parent.FirstChild(); child != nil; child = child.NextSibling() {
+		if t, ok := child.(*ast.Text); ok {
+			sb.Write(t.Segment.Value(w.source))
+		}
+	}
+
+	return sb.String()
+}
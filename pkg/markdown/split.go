@@ -0,0 +1,45 @@
+package markdown
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+const codeFence = "```"
+
+// SplitText splits Markdown into parts of at most limit bytes, on line boundaries if possible,
+// code blocks interrupted by a split are closed and reopened
+func SplitText(text string, limit int) []string {
+	parts := []string{}
+
+	for len(text) > limit {
+		// the reserve is for the closing code fence
+		cut := limit - len("\n"+codeFence)
+		pos := strings.LastIndex(text[:cut], "\n")
+		if pos < cut/2 {
+			pos = strings.LastIndex(text[:cut], " ")
+		}
+		if pos < cut/2 {
+			pos = cut
+			for pos > 0 && !utf8.RuneStart(text[pos]) {
+				pos--
+			}
+		}
+
+		part := text[:pos]
+		text = strings.TrimLeft(text[pos:], "\n ")
+
+		if strings.Count(part, codeFence)%2 == 1 {
+			part += "\n" + codeFence
+			text = codeFence + "\n" + text
+		}
+
+		parts = append(parts, part)
+	}
+
+	if strings.TrimSpace(text) != "" {
+		parts = append(parts, text)
+	}
+
+	return parts
+}
@@ -0,0 +1,207 @@
+package matrix
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	logging "github.com/sirupsen/logrus"
+)
+
+const (
+	clientPath      = "/_matrix/client/v3"
+	mediaPath       = "/_matrix/media/v3"
+	maxRateLimitHit = 3
+	// typingTimeout is how long clients show the typing notice if it's not refreshed
+	typingTimeout = time.Second * 30
+)
+
+// apiClient calls the client-server API of the homeserver, see https://spec.matrix.org/v1.8/client-server-api/
+type apiClient struct {
+	cfg        *Config
+	httpClient *http.Client
+}
+
+func (ac *apiClient) buildURL(basePath, path string, query url.Values) string {
+	u := strings.TrimSuffix(ac.cfg.HomeserverURL, "/") + basePath + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	return u
+}
+
+// do sends the request and decodes the response into target if given, requests hitting
+// the rate limit are repeated after the time given by the homeserver
+func (ac *apiClient) do(ctx context.Context, method, url, contentType string, body []byte, target interface{}) error {
+	for attempt := 1; ; attempt++ {
+		httpReq, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+		if err != nil {
+			return errors.Wrap(err, "failed to create matrix request")
+		}
+
+		httpReq.Header.Set("Authorization", "Bearer "+ac.cfg.AccessToken)
+		if contentType != "" {
+			httpReq.Header.Set("Content-Type", contentType)
+		}
+
+		resp, err := ac.httpClient.Do(httpReq)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		respBody, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return errors.Wrap(err, "failed to read matrix response")
+		}
+
+		if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+			errResp := new(ErrorResponse)
+			_ = json.Unmarshal(respBody, errResp)
+
+			if errResp.ErrCode == errCodeLimitExceeded && attempt < maxRateLimitHit {
+				wait := time.Duration(errResp.RetryAfterMs) * time.Millisecond
+				logging.WithContext(ctx).Warnf("hit matrix rate limit, will retry in %v", wait)
+
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(wait):
+				}
+				continue
+			}
+
+			// the url is not logged since it may contain the sync token
+			return errors.Errorf("matrix responded to %s with status %d: %s %s", method, resp.StatusCode, errResp.ErrCode, errResp.Error)
+		}
+
+		if target == nil {
+			return nil
+		}
+
+		err = json.Unmarshal(respBody, target)
+		if err != nil {
+			return errors.Wrap(err, "failed to decode matrix response")
+		}
+
+		return nil
+	}
+}
+
+func (ac *apiClient) doJSON(ctx context.Context, method, url string, data, target interface{}) error {
+	rawBody, err := json.Marshal(data)
+	if err != nil {
+		return errors.Wrap(err, "failed to create matrix request body")
+	}
+
+	return ac.do(ctx, method, url, "application/json", rawBody, target)
+}
+
+func (ac *apiClient) whoAmI(ctx context.Context) (string, error) {
+	resp := new(WhoAmIResponse)
+	err := ac.do(ctx, http.MethodGet, ac.buildURL(clientPath, "/account/whoami", nil), "", nil, resp)
+	if err != nil {
+		return "", err
+	}
+
+	return resp.UserID, nil
+}
+
+// sync waits for new events since the given batch token, the initial sync without a token gives the current state
+func (ac *apiClient) sync(ctx context.Context, since string, filter *Filter) (*SyncResponse, error) {
+	rawFilter, err := json.Marshal(filter)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create matrix sync filter")
+	}
+
+	query := url.Values{}
+	query.Set("filter", string(rawFilter))
+	if since != "" {
+		query.Set("since", since)
+		query.Set("timeout", strconv.FormatInt(ac.cfg.SyncTimeout.Milliseconds(), 10))
+	}
+
+	resp := new(SyncResponse)
+	err = ac.do(ctx, http.MethodGet, ac.buildURL(clientPath, "/sync", query), "", nil, resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+func (ac *apiClient) joinRoom(ctx context.Context, roomID string) error {
+	return ac.doJSON(ctx, http.MethodPost, ac.buildURL(clientPath, "/join/"+url.PathEscape(roomID), nil), struct{}{}, nil)
+}
+
+// leaveRoom leaves a joined room or declines an invite
+func (ac *apiClient) leaveRoom(ctx context.Context, roomID string) error {
+	return ac.doJSON(ctx, http.MethodPost, ac.buildURL(clientPath, "/rooms/"+url.PathEscape(roomID)+"/leave", nil), struct{}{}, nil)
+}
+
+func (ac *apiClient) getJoinedMemberCount(ctx context.Context, roomID string) (int, error) {
+	resp := new(JoinedMembersResponse)
+	err := ac.do(ctx, http.MethodGet, ac.buildURL(clientPath, "/rooms/"+url.PathEscape(roomID)+"/joined_members", nil), "", nil, resp)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(resp.Joined), nil
+}
+
+func (ac *apiClient) sendMessage(ctx context.Context, roomID string, content *MessageContent) (string, error) {
+	path := "/rooms/" + url.PathEscape(roomID) + "/send/" + eventRoomMessage + "/" + uuid.NewString()
+
+	resp := new(SendResponse)
+	err := ac.doJSON(ctx, http.MethodPut, ac.buildURL(clientPath, path, nil), content, resp)
+	if err != nil {
+		return "", err
+	}
+
+	return resp.EventID, nil
+}
+
+func (ac *apiClient) setTyping(ctx context.Context, roomID, userID string, isTyping bool) error {
+	path := "/rooms/" + url.PathEscape(roomID) + "/typing/" + url.PathEscape(userID)
+
+	typingReq := &TypingRequest{Typing: isTyping}
+	if isTyping {
+		typingReq.Timeout = typingTimeout.Milliseconds()
+	}
+
+	return ac.doJSON(ctx, http.MethodPut, ac.buildURL(clientPath, path, nil), typingReq, nil)
+}
+
+// redact removes the content of an event, the bot needs the power level for redactions of other users
+func (ac *apiClient) redact(ctx context.Context, roomID, eventID, reason string) error {
+	path := "/rooms/" + url.PathEscape(roomID) + "/redact/" + url.PathEscape(eventID) + "/" + uuid.NewString()
+
+	return ac.doJSON(ctx, http.MethodPut, ac.buildURL(clientPath, path, nil), &RedactRequest{Reason: reason}, nil)
+}
+
+// upload stores the file in the media repository and gives its mxc:// uri
+func (ac *apiClient) upload(ctx context.Context, fileName, mimeType string, data []byte) (string, error) {
+	if mimeType == "" {
+		mimeType = http.DetectContentType(data)
+	}
+
+	query := url.Values{}
+	query.Set("filename", fileName)
+
+	resp := new(UploadResponse)
+	err := ac.do(ctx, http.MethodPost, ac.buildURL(mediaPath, "/upload", query), mimeType, data, resp)
+	if err != nil {
+		return "", err
+	}
+
+	return resp.ContentURI, nil
+}
@@ -0,0 +1,546 @@
+package matrix
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"breathbathChatGPT/pkg/msg"
+	"breathbathChatGPT/pkg/storage"
+
+	"github.com/pkg/errors"
+	logging "github.com/sirupsen/logrus"
+)
+
+const (
+	Platform = "matrix"
+
+	syncTokenVersion = "v1"
+	minRetryWait     = time.Second
+	requestTimeout   = time.Second * 30
+	// directRoomMembers is the count of members in a room of the bot with one user, where all messages are answered
+	directRoomMembers = 2
+
+	encryptedRoomNotice = "Encrypted rooms are not supported, please invite me to a room without encryption"
+)
+
+// Bot long-polls the sync endpoint of the homeserver, joins rooms on invites and answers messages in the
+// rooms as replies, in rooms with other members only messages mentioning the bot and commands are answered
+type Bot struct {
+	cfg        *Config
+	msgHandler *msg.Router
+	api        *apiClient
+	db         storage.Client
+	inFlight   sync.WaitGroup
+
+	stopCtx context.Context
+	stop    context.CancelFunc
+
+	userID string
+
+	mu             sync.Mutex
+	memberCounts   map[string]int
+	noticedRoomIDs map[string]bool
+}
+
+func NewBot(cfg *Config, r *msg.Router, db storage.Client) (*Bot, error) {
+	e := cfg.Validate()
+	if e.HasErrors() {
+		return nil, e
+	}
+
+	stopCtx, stop := context.WithCancel(context.Background())
+
+	return &Bot{
+		cfg:        cfg,
+		msgHandler: r,
+		api: &apiClient{
+			cfg: cfg,
+			// the sync request is held by the homeserver till the sync timeout
+			httpClient: &http.Client{Timeout: cfg.SyncTimeout + requestTimeout},
+		},
+		db:             db,
+		stopCtx:        stopCtx,
+		stop:           stop,
+		memberCounts:   map[string]int{},
+		noticedRoomIDs: map[string]bool{},
+	}, nil
+}
+
+func (b *Bot) getSyncTokenKey() string {
+	return storage.GenerateCacheKey(syncTokenVersion, Platform, "sync_token", b.userID)
+}
+
+// Start syncs till the bot is stopped, the sync token is stored, so that messages sent while the bot was down
+// are answered after a restart, on the very first start the history of the rooms is skipped
+func (b *Bot) Start() error {
+	userID, err := b.api.whoAmI(b.stopCtx)
+	if err != nil {
+		if b.stopCtx.Err() != nil {
+			return nil
+		}
+		return errors.Wrap(err, "failed to get matrix user of the access token")
+	}
+	b.userID = userID
+
+	logging.Infof("will sync with matrix homeserver %q as %q", b.cfg.HomeserverURL, b.userID)
+
+	since, _, err := b.db.Read(b.stopCtx, b.getSyncTokenKey())
+	if err != nil {
+		return err
+	}
+
+	filter := b.buildFilter()
+	isInitial := len(since) == 0
+	wait := minRetryWait
+
+	for {
+		resp, err := b.api.sync(b.stopCtx, string(since), filter)
+		if b.stopCtx.Err() != nil {
+			return nil
+		}
+
+		if err != nil {
+			logging.Warnf("failed to sync with matrix homeserver, will retry in %v: %v", wait, err)
+
+			select {
+			case <-b.stopCtx.Done():
+				return nil
+			case <-time.After(wait):
+			}
+
+			wait *= 2
+			if wait > b.cfg.MaxRetryWait {
+				wait = b.cfg.MaxRetryWait
+			}
+			continue
+		}
+		wait = minRetryWait
+
+		b.handleSync(resp, isInitial)
+		isInitial = false
+
+		since = []byte(resp.NextBatch)
+		err = b.db.Write(b.stopCtx, b.getSyncTokenKey(), since, 0)
+		if err != nil && b.stopCtx.Err() == nil {
+			logging.Errorf("failed to store matrix sync token: %v", err)
+		}
+	}
+}
+
+// Stop interrupts the sync and waits for the messages in progress till the shutdown timeout
+func (b *Bot) Stop() {
+	logging.Info("will stop matrix bot")
+
+	b.stop()
+
+	done := make(chan struct{})
+	go func() {
+		b.inFlight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		logging.Info("stopped matrix bot")
+	case <-time.After(b.cfg.ShutdownTimeout):
+		logging.Warnf("stopped waiting for in-flight matrix messages after %v", b.cfg.ShutdownTimeout)
+	}
+}
+
+func (b *Bot) buildFilter() *Filter {
+	return &Filter{
+		Presence:    EventFilter{Types: []string{}},
+		AccountData: EventFilter{Types: []string{}},
+		Room: RoomFilter{
+			Timeline:    RoomEventFilter{Types: []string{eventRoomMessage, eventEncrypted}},
+			State:       RoomEventFilter{Types: []string{eventRoomMember}, LazyLoadMembers: true},
+			Ephemeral:   RoomEventFilter{Types: []string{}},
+			AccountData: RoomEventFilter{Types: []string{}},
+		},
+	}
+}
+
+func (b *Bot) runAsync(f func()) {
+	b.inFlight.Add(1)
+	go func() {
+		defer b.inFlight.Done()
+		f()
+	}()
+}
+
+// handleSync answers invites and new messages, the timeline of the initial sync is the room history and is skipped
+func (b *Bot) handleSync(resp *SyncResponse, isInitial bool) {
+	for roomID, room := range resp.Rooms.Invite {
+		b.handleInvite(roomID, room)
+	}
+
+	for roomID := range resp.Rooms.Leave {
+		b.mu.Lock()
+		delete(b.memberCounts, roomID)
+		b.mu.Unlock()
+	}
+
+	for roomID, room := range resp.Rooms.Join {
+		roomID := roomID
+		if room.Summary.JoinedMemberCount != nil {
+			b.mu.Lock()
+			b.memberCounts[roomID] = *room.Summary.JoinedMemberCount
+			b.mu.Unlock()
+		}
+
+		if isInitial {
+			continue
+		}
+
+		for i := range room.Timeline.Events {
+			event := room.Timeline.Events[i]
+			if event.Sender == b.userID {
+				continue
+			}
+
+			switch event.Type {
+			case eventEncrypted:
+				b.runAsync(func() {
+					b.noticeEncryptedRoom(roomID)
+				})
+			case eventRoomMessage:
+				b.dispatchMessage(roomID, &event)
+			}
+		}
+	}
+}
+
+// isInviteAllowed checks the homeserver of the inviting user against the allowed ones
+func (b *Bot) isInviteAllowed(inviter string) bool {
+	if len(b.cfg.InviteServers) == 0 {
+		return true
+	}
+
+	_, server, found := strings.Cut(inviter, ":")
+	if !found {
+		return false
+	}
+
+	for _, allowedServer := range b.cfg.InviteServers {
+		if strings.EqualFold(server, allowedServer) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (b *Bot) handleInvite(roomID string, room InvitedRoom) {
+	inviter := ""
+	for _, event := range room.InviteState.Events {
+		if event.Type == eventRoomMember && event.StateKey != nil && *event.StateKey == b.userID {
+			inviter = event.Sender
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(b.stopCtx, requestTimeout)
+	defer cancel()
+
+	if !b.isInviteAllowed(inviter) {
+		logging.Warnf("declined invite of %q to matrix room %q from a not allowed homeserver", inviter, roomID)
+
+		err := b.api.leaveRoom(ctx, roomID)
+		if err != nil {
+			logging.Errorf("failed to decline invite to matrix room %q: %v", roomID, err)
+		}
+		return
+	}
+
+	err := b.api.joinRoom(ctx, roomID)
+	if err != nil {
+		logging.Errorf("failed to join matrix room %q: %v", roomID, err)
+		return
+	}
+
+	logging.Infof("joined matrix room %q on invite of %q", roomID, inviter)
+}
+
+// noticeEncryptedRoom tells once per room that the bot cannot read encrypted messages
+func (b *Bot) noticeEncryptedRoom(roomID string) {
+	b.mu.Lock()
+	isNoticed := b.noticedRoomIDs[roomID]
+	b.noticedRoomIDs[roomID] = true
+	b.mu.Unlock()
+
+	if isNoticed {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	logging.Warnf("got encrypted message in matrix room %q, encryption is not supported", roomID)
+
+	_, err := b.api.sendMessage(ctx, roomID, &MessageContent{MsgType: msgTypeNotice, Body: encryptedRoomNotice})
+	if err != nil {
+		logging.Errorf("failed to send notice to matrix room %q: %v", roomID, err)
+	}
+}
+
+func (b *Bot) dispatchMessage(roomID string, event *Event) {
+	content := new(MessageContent)
+	err := json.Unmarshal(event.Content, content)
+	if err != nil {
+		logging.Errorf("failed to decode matrix message %q: %v", event.EventID, err)
+		return
+	}
+
+	// notices are sent by bots, edits are new versions of messages which were answered already
+	if content.MsgType != msgTypeText || (content.RelatesTo != nil && content.RelatesTo.RelType == relationReplace) {
+		return
+	}
+
+	b.runAsync(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), b.cfg.HandleTimeout)
+		defer cancel()
+
+		if !b.isMessageToHandle(ctx, roomID, content) {
+			return
+		}
+
+		b.handleMessage(ctx, roomID, event, content)
+	})
+}
+
+func (b *Bot) getMemberCount(ctx context.Context, roomID string) int {
+	b.mu.Lock()
+	count, ok := b.memberCounts[roomID]
+	b.mu.Unlock()
+
+	if ok {
+		return count
+	}
+
+	count, err := b.api.getJoinedMemberCount(ctx, roomID)
+	if err != nil {
+		logging.WithContext(ctx).Errorf("failed to get members of matrix room %q: %v", roomID, err)
+		return 0
+	}
+
+	b.mu.Lock()
+	b.memberCounts[roomID] = count
+	b.mu.Unlock()
+
+	return count
+}
+
+// isMessageToHandle accepts all messages in direct rooms, in other rooms only commands and mentions of the bot
+func (b *Bot) isMessageToHandle(ctx context.Context, roomID string, content *MessageContent) bool {
+	if count := b.getMemberCount(ctx, roomID); count > 0 && count <= directRoomMembers {
+		return true
+	}
+
+	if strings.HasPrefix(stripReplyFallback(content), msg.CommandPrefix) {
+		return true
+	}
+
+	if content.Mentions != nil {
+		for _, userID := range content.Mentions.UserIDs {
+			if userID == b.userID {
+				return true
+			}
+		}
+	}
+
+	return strings.Contains(content.Body, b.userID) || strings.Contains(content.FormattedBody, "matrix.to/#/"+b.userID)
+}
+
+// stripReplyFallback removes the quote of the replied message which older clients put into the body
+func stripReplyFallback(content *MessageContent) string {
+	body := content.Body
+	if content.RelatesTo == nil || content.RelatesTo.InReplyTo == nil {
+		return strings.TrimSpace(body)
+	}
+
+	lines := strings.Split(body, "\n")
+	for len(lines) > 0 && strings.HasPrefix(lines[0], ">") {
+		lines = lines[1:]
+	}
+
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// stripMention removes the mention of the bot, clients put either the user id or the display name of the bot
+// in front of the message, e.g. "bgpt: what is Go?"
+func (b *Bot) stripMention(text string) string {
+	localpart, _, _ := strings.Cut(strings.TrimPrefix(b.userID, "@"), ":")
+
+	for _, name := range []string{b.userID, localpart} {
+		if name != "" && len(text) >= len(name) && strings.EqualFold(text[:len(name)], name) {
+			return strings.TrimLeft(text[len(name):], ":, ")
+		}
+	}
+
+	return strings.TrimSpace(strings.ReplaceAll(text, b.userID, ""))
+}
+
+func (b *Bot) eventToRequest(ctx context.Context, roomID string, event *Event, content *MessageContent) *msg.Request {
+	// a room with an unknown member count is treated as shared
+	count := b.getMemberCount(ctx, roomID)
+
+	return &msg.Request{
+		Platform: Platform,
+		ID:       event.EventID,
+		Sender: &msg.Sender{
+			ID: event.Sender,
+		},
+		Message: b.stripMention(stripReplyFallback(content)),
+		Meta: map[string]interface{}{
+			"conversation_id": roomID,
+			"timestamp":       event.OriginServerTS / int64(time.Second/time.Millisecond),
+			"is_group_chat":   count == 0 || count > directRoomMembers,
+		},
+	}
+}
+
+// buildNotifier sends notices to the room before the response is ready
+func (b *Bot) buildNotifier(roomID string) msg.Notifier {
+	return func(ctx context.Context, text string) {
+		_, err := b.api.sendMessage(ctx, roomID, &MessageContent{MsgType: msgTypeNotice, Body: text})
+		if err != nil {
+			logging.WithContext(ctx).Errorf("failed to send notice to matrix room %q: %v", roomID, err)
+		}
+	}
+}
+
+func (b *Bot) handleMessage(ctx context.Context, roomID string, event *Event, content *MessageContent) {
+	log := logging.WithContext(ctx)
+
+	req := b.eventToRequest(ctx, roomID, event, content)
+	log.Debugf("got matrix message: %q", req.Message)
+
+	indicator := newTypingIndicator(b.api, roomID, b.userID)
+	routeCtx := msg.WithNotifier(msg.WithProgressReporter(ctx, indicator.Report), b.buildNotifier(roomID))
+	resp, err := b.msgHandler.Route(routeCtx, req)
+	indicator.Stop(ctx)
+
+	if err != nil {
+		log.Errorf("failed to handle matrix message: %v", err)
+		resp = &msg.Response{Message: "Unexpected error", Type: msg.Error}
+	}
+
+	if resp == nil {
+		return
+	}
+
+	replyTo := &RelatesTo{InReplyTo: &InReplyTo{EventID: event.EventID}}
+	if resp.Options.IsResponseToHiddenMessage() {
+		replyTo = nil
+		err = b.api.redact(ctx, roomID, event.EventID, "contains sensitive data")
+		if err != nil {
+			log.Errorf("failed to redact matrix message %q with sensitive data: %v", event.EventID, err)
+		}
+	}
+
+	contents := b.buildContents(ctx, resp)
+	if len(contents) == 0 {
+		log.Info("response message is empty, will send nothing to the sender")
+		return
+	}
+
+	contents[0].RelatesTo = replyTo
+	for _, c := range contents {
+		_, err = b.api.sendMessage(ctx, roomID, c)
+		if err != nil {
+			log.Errorf("failed to send matrix message to room %q: %v", roomID, err)
+			return
+		}
+	}
+}
+
+// buildContents converts the response to HTML messages, buttons are listed as commands to type,
+// attachments with data are uploaded to the media repository, the ones with a url are given as links
+func (b *Bot) buildContents(ctx context.Context, resp *msg.Response) []*MessageContent {
+	parts := []formattedPart{}
+	if resp.Message != "" {
+		parts = buildFormattedParts(resp.Message, resp.Options.GetFormat(), b.cfg.MaxMessageLength)
+		if resp.Type == msg.Error && len(parts) > 0 {
+			parts[0].Plain = "❗" + parts[0].Plain
+			parts[0].HTML = "❗" + parts[0].HTML
+		}
+	}
+
+	if optionsPart, ok := buildOptionsPart(resp); ok {
+		if len(parts) == 0 {
+			parts = append(parts, optionsPart)
+		} else {
+			last := &parts[len(parts)-1]
+			last.Plain += "\n" + optionsPart.Plain
+			last.HTML += optionsPart.HTML
+		}
+	}
+
+	contents := make([]*MessageContent, 0, len(parts)+len(resp.Attachments))
+	for _, part := range parts {
+		contents = append(contents, &MessageContent{
+			MsgType:       msgTypeText,
+			Body:          part.Plain,
+			Format:        formatHTML,
+			FormattedBody: part.HTML,
+			// answers of ChatGPT should never ping users
+			Mentions: &Mentions{},
+		})
+	}
+
+	for _, a := range resp.Attachments {
+		c, err := b.buildAttachmentContent(ctx, a)
+		if err != nil {
+			logging.WithContext(ctx).Errorf("failed to upload attachment %q to matrix: %v", a.FileName, err)
+			continue
+		}
+
+		if c != nil {
+			contents = append(contents, c)
+		}
+	}
+
+	return contents
+}
+
+func (b *Bot) buildAttachmentContent(ctx context.Context, a msg.Attachment) (*MessageContent, error) {
+	if len(a.Data) == 0 {
+		if a.URL == "" {
+			logging.WithContext(ctx).Warnf("attachment %q has neither data nor url, it cannot be sent to matrix", a.FileName)
+			return nil, nil
+		}
+
+		return &MessageContent{
+			MsgType:       msgTypeText,
+			Body:          fmt.Sprintf("%s: %s", a.FileName, a.URL),
+			Format:        formatHTML,
+			FormattedBody: fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(a.URL), html.EscapeString(a.FileName)),
+		}, nil
+	}
+
+	contentURI, err := b.api.upload(ctx, a.FileName, a.MIMEType, a.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	msgType := msgTypeFile
+	switch a.Type {
+	case msg.AttachmentPhoto:
+		msgType = msgTypeImage
+	case msg.AttachmentAudio, msg.AttachmentVoice:
+		msgType = msgTypeAudio
+	case msg.AttachmentDocument, msg.AttachmentUndefined:
+	}
+
+	return &MessageContent{
+		MsgType: msgType,
+		Body:    a.FileName,
+		URL:     contentURI,
+		Info:    &FileInfo{MIMEType: a.MIMEType, Size: len(a.Data)},
+	}, nil
+}
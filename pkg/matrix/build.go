@@ -0,0 +1,15 @@
+package matrix
+
+import (
+	"breathbathChatGPT/pkg/msg"
+	"breathbathChatGPT/pkg/storage"
+)
+
+func BuildBot(r *msg.Router, db storage.Client) (*Bot, error) {
+	config, err := LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewBot(config, r, db)
+}
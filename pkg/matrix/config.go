@@ -0,0 +1,65 @@
+package matrix
+
+import (
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+	"github.com/pkg/errors"
+
+	"breathbathChatGPT/pkg/errs"
+)
+
+type Config struct {
+	HomeserverURL string `envconfig:"MATRIX_HOMESERVER_URL"`
+	AccessToken   string `envconfig:"MATRIX_ACCESS_TOKEN"`
+	// InviteServers limits the homeservers of users whose invites are accepted, empty means all
+	InviteServers   []string      `envconfig:"MATRIX_INVITE_SERVERS"`
+	SyncTimeout     time.Duration `envconfig:"MATRIX_SYNC_TIMEOUT" default:"30s"`
+	ShutdownTimeout time.Duration `envconfig:"MATRIX_SHUTDOWN_TIMEOUT" default:"30s"`
+	HandleTimeout   time.Duration `envconfig:"MATRIX_HANDLE_TIMEOUT" default:"10m"`
+	MaxRetryWait    time.Duration `envconfig:"MATRIX_MAX_RETRY_WAIT" default:"1m"`
+	// MaxMessageLength keeps the plain and the HTML body of one message below the 64KiB event limit
+	MaxMessageLength int `envconfig:"MATRIX_MAX_MESSAGE_LENGTH" default:"30000"`
+}
+
+func (c *Config) Validate() *errs.Multi {
+	e := errs.NewMulti()
+
+	if c.HomeserverURL == "" {
+		e.Errf("MATRIX_HOMESERVER_URL cannot be empty")
+	}
+
+	if c.AccessToken == "" {
+		e.Errf("MATRIX_ACCESS_TOKEN cannot be empty")
+	}
+
+	if c.SyncTimeout <= 0 {
+		e.Errf("MATRIX_SYNC_TIMEOUT should be positive, got %v", c.SyncTimeout)
+	}
+
+	if c.HandleTimeout <= 0 {
+		e.Errf("MATRIX_HANDLE_TIMEOUT should be positive, got %v", c.HandleTimeout)
+	}
+
+	if c.MaxRetryWait <= 0 {
+		e.Errf("MATRIX_MAX_RETRY_WAIT should be positive, got %v", c.MaxRetryWait)
+	}
+
+	const minMessageLength = 1000
+	if c.MaxMessageLength < minMessageLength {
+		e.Errf("MATRIX_MAX_MESSAGE_LENGTH should be at least %d, got %d", minMessageLength, c.MaxMessageLength)
+	}
+
+	return e
+}
+
+func LoadConfig() (cfg *Config, err error) {
+	cfg = new(Config)
+
+	err = envconfig.Process("matrix", cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load matrix config")
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,108 @@
+package matrix
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+
+	"breathbathChatGPT/pkg/markdown"
+	"breathbathChatGPT/pkg/msg"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	gmhtml "github.com/yuin/goldmark/renderer/html"
+)
+
+var (
+	// raw HTML in Markdown is not rendered, so answers of ChatGPT cannot inject markup
+	markdownRenderer = goldmark.New(
+		goldmark.WithExtensions(extension.GFM),
+		goldmark.WithRendererOptions(gmhtml.WithHardWraps()),
+	)
+	htmlTagRegex = regexp.MustCompile(`<[^>]*>`)
+)
+
+// formattedPart is a message with the plain body for clients without HTML support and the HTML body
+type formattedPart struct {
+	Plain string
+	HTML  string
+}
+
+// buildFormattedParts converts the text to HTML, see https://spec.matrix.org/v1.8/client-server-api/#mroommessage-msgtypes,
+// long texts are split into parts which are converted separately
+func buildFormattedParts(text string, format msg.OutputFormat, limit int) []formattedPart {
+	parts := []formattedPart{}
+
+	switch format {
+	case msg.OutputFormatMarkdown, msg.OutputFormatMarkdown1, msg.OutputFormatMarkdown2:
+		for _, part := range markdown.SplitText(text, limit) {
+			parts = append(parts, formattedPart{Plain: part, HTML: markdownToHTML(part)})
+		}
+	case msg.OutputFormatHTML:
+		// HTML of the handlers is short, splitting it would break the tags
+		parts = append(parts, formattedPart{Plain: htmlToPlain(text), HTML: text})
+	case msg.OutputFormatUndefined:
+		fallthrough
+	default:
+		for _, part := range markdown.SplitText(text, limit) {
+			parts = append(parts, formattedPart{Plain: part, HTML: plainToHTML(part)})
+		}
+	}
+
+	return parts
+}
+
+func markdownToHTML(text string) string {
+	var buf bytes.Buffer
+	err := markdownRenderer.Convert([]byte(text), &buf)
+	if err != nil {
+		return plainToHTML(text)
+	}
+
+	return strings.TrimSpace(buf.String())
+}
+
+func plainToHTML(text string) string {
+	return strings.ReplaceAll(html.EscapeString(text), "\n", "<br>")
+}
+
+func htmlToPlain(text string) string {
+	return html.UnescapeString(htmlTagRegex.ReplaceAllString(strings.ReplaceAll(text, "<br>", "\n"), ""))
+}
+
+// buildOptionsPart lists buttons and predefined responses as commands to type since Matrix has no buttons
+func buildOptionsPart(resp *msg.Response) (formattedPart, bool) {
+	plainLines := []string{}
+	htmlItems := []string{}
+
+	for _, row := range resp.Options.GetInlineButtons() {
+		for _, b := range row {
+			switch {
+			case b.URL != "":
+				plainLines = append(plainLines, fmt.Sprintf("• %s: %s", b.Text, b.URL))
+				htmlItems = append(htmlItems, fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(b.URL), html.EscapeString(b.Text)))
+			case b.Data != "":
+				plainLines = append(plainLines, "• "+b.Data)
+				htmlItems = append(htmlItems, "<code>"+html.EscapeString(b.Data)+"</code>")
+			}
+		}
+	}
+
+	for _, predefinedResp := range resp.Options.GetPredefinedResponses() {
+		if predefinedResp != "" {
+			plainLines = append(plainLines, "• "+string(predefinedResp))
+			htmlItems = append(htmlItems, "<code>"+html.EscapeString(string(predefinedResp))+"</code>")
+		}
+	}
+
+	if len(plainLines) == 0 {
+		return formattedPart{}, false
+	}
+
+	return formattedPart{
+		Plain: strings.Join(plainLines, "\n"),
+		HTML:  "<ul><li>" + strings.Join(htmlItems, "</li><li>") + "</li></ul>",
+	}, true
+}
@@ -0,0 +1,150 @@
+package matrix
+
+import "encoding/json"
+
+const (
+	eventRoomMessage = "m.room.message"
+	eventRoomMember  = "m.room.member"
+	eventEncrypted   = "m.room.encrypted"
+
+	msgTypeText   = "m.text"
+	msgTypeNotice = "m.notice"
+	msgTypeImage  = "m.image"
+	msgTypeAudio  = "m.audio"
+	msgTypeFile   = "m.file"
+
+	relationReplace = "m.replace"
+	formatHTML      = "org.matrix.custom.html"
+
+	errCodeLimitExceeded = "M_LIMIT_EXCEEDED"
+)
+
+// SyncResponse contains the part of https://spec.matrix.org/v1.8/client-server-api/#get_matrixclientv3sync used by the bot
+type SyncResponse struct {
+	NextBatch string `json:"next_batch"`
+	Rooms     Rooms  `json:"rooms"`
+}
+
+type Rooms struct {
+	Join   map[string]JoinedRoom  `json:"join"`
+	Invite map[string]InvitedRoom `json:"invite"`
+	Leave  map[string]LeftRoom    `json:"leave"`
+}
+
+type JoinedRoom struct {
+	Summary  RoomSummary `json:"summary"`
+	Timeline Timeline    `json:"timeline"`
+}
+
+type RoomSummary struct {
+	JoinedMemberCount *int `json:"m.joined_member_count"`
+}
+
+type Timeline struct {
+	Events []Event `json:"events"`
+}
+
+type InvitedRoom struct {
+	InviteState struct {
+		Events []Event `json:"events"`
+	} `json:"invite_state"`
+}
+
+type LeftRoom struct{}
+
+type Event struct {
+	Type           string          `json:"type"`
+	EventID        string          `json:"event_id"`
+	Sender         string          `json:"sender"`
+	StateKey       *string         `json:"state_key"`
+	OriginServerTS int64           `json:"origin_server_ts"`
+	Content        json.RawMessage `json:"content"`
+}
+
+type MessageContent struct {
+	MsgType       string     `json:"msgtype"`
+	Body          string     `json:"body"`
+	Format        string     `json:"format,omitempty"`
+	FormattedBody string     `json:"formatted_body,omitempty"`
+	RelatesTo     *RelatesTo `json:"m.relates_to,omitempty"`
+	Mentions      *Mentions  `json:"m.mentions,omitempty"`
+	URL           string     `json:"url,omitempty"`
+	Info          *FileInfo  `json:"info,omitempty"`
+}
+
+type MemberContent struct {
+	Membership string `json:"membership"`
+}
+
+type RelatesTo struct {
+	RelType   string     `json:"rel_type,omitempty"`
+	EventID   string     `json:"event_id,omitempty"`
+	InReplyTo *InReplyTo `json:"m.in_reply_to,omitempty"`
+}
+
+type InReplyTo struct {
+	EventID string `json:"event_id"`
+}
+
+type Mentions struct {
+	UserIDs []string `json:"user_ids,omitempty"`
+}
+
+type FileInfo struct {
+	MIMEType string `json:"mimetype,omitempty"`
+	Size     int    `json:"size,omitempty"`
+}
+
+type WhoAmIResponse struct {
+	UserID string `json:"user_id"`
+}
+
+type JoinedMembersResponse struct {
+	Joined map[string]json.RawMessage `json:"joined"`
+}
+
+type SendResponse struct {
+	EventID string `json:"event_id"`
+}
+
+type UploadResponse struct {
+	ContentURI string `json:"content_uri"`
+}
+
+type TypingRequest struct {
+	Typing  bool  `json:"typing"`
+	Timeout int64 `json:"timeout,omitempty"`
+}
+
+type RedactRequest struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+type ErrorResponse struct {
+	ErrCode      string `json:"errcode"`
+	Error        string `json:"error"`
+	RetryAfterMs int64  `json:"retry_after_ms"`
+}
+
+// Filter limits the sync to the events handled by the bot, see https://spec.matrix.org/v1.8/client-server-api/#filtering
+type Filter struct {
+	Presence    EventFilter `json:"presence"`
+	AccountData EventFilter `json:"account_data"`
+	Room        RoomFilter  `json:"room"`
+}
+
+type RoomFilter struct {
+	Timeline    RoomEventFilter `json:"timeline"`
+	State       RoomEventFilter `json:"state"`
+	Ephemeral   RoomEventFilter `json:"ephemeral"`
+	AccountData RoomEventFilter `json:"account_data"`
+}
+
+type EventFilter struct {
+	Types []string `json:"types"`
+}
+
+type RoomEventFilter struct {
+	Types           []string `json:"types"`
+	LazyLoadMembers bool     `json:"lazy_load_members,omitempty"`
+}
@@ -0,0 +1,22 @@
+package matrix
+
+import (
+	"context"
+	"time"
+
+	"breathbathChatGPT/pkg/msg"
+
+	"github.com/pkg/errors"
+)
+
+// typingRefreshInterval renews the typing notice before its timeout
+const typingRefreshInterval = time.Second * 20
+
+// newTypingIndicator shows the typing notice of the bot user in the room
+func newTypingIndicator(api *apiClient, roomID, userID string) *msg.TypingIndicator {
+	return msg.NewTypingIndicator(typingRefreshInterval, func(ctx context.Context, isTyping bool) error {
+		err := api.setTyping(ctx, roomID, userID, isTyping)
+
+		return errors.Wrapf(err, "failed to set matrix typing notice in room %q", roomID)
+	})
+}
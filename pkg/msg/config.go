@@ -0,0 +1,37 @@
+package msg
+
+import (
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+	"github.com/pkg/errors"
+
+	"breathbathChatGPT/pkg/errs"
+)
+
+type RouterConfig struct {
+	// Middlewares are names of the enabled middlewares, the first one is the outermost, empty means all in the default order
+	Middlewares    []string      `envconfig:"ROUTER_MIDDLEWARES"`
+	RequestTimeout time.Duration `envconfig:"ROUTER_REQUEST_TIMEOUT" default:"3m"`
+}
+
+func (c *RouterConfig) Validate() *errs.Multi {
+	e := errs.NewMulti()
+
+	if c.RequestTimeout < 0 {
+		e.Errf("ROUTER_REQUEST_TIMEOUT cannot be negative, got %v", c.RequestTimeout)
+	}
+
+	return e
+}
+
+func LoadRouterConfig() (cfg *RouterConfig, err error) {
+	cfg = new(RouterConfig)
+
+	err = envconfig.Process("router", cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load router config")
+	}
+
+	return cfg, nil
+}
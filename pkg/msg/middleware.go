@@ -0,0 +1,192 @@
+package msg
+
+import (
+	"context"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	logging "github.com/sirupsen/logrus"
+)
+
+// NamedMiddleware allows to enable and reorder middlewares with ROUTER_MIDDLEWARES,
+// a required middleware cannot be left out since the handlers depend on it
+type NamedMiddleware struct {
+	Name       string
+	Middleware Middleware
+	Required   bool
+	// After are the names of the middlewares which should run before this one if they are used,
+	// e.g. "user" for the ones reading the user
+	After []string
+}
+
+// OrderMiddlewares picks the middlewares in the given order of names, with no names all of them are used in the given order
+func OrderMiddlewares(available []NamedMiddleware, names []string) ([]Middleware, error) {
+	if len(names) == 0 {
+		err := checkMiddlewareDependencies(available)
+		if err != nil {
+			return nil, err
+		}
+
+		res := make([]Middleware, 0, len(available))
+		for _, nm := range available {
+			res = append(res, nm.Middleware)
+		}
+
+		return res, nil
+	}
+
+	byName := make(map[string]NamedMiddleware, len(available))
+	knownNames := make([]string, 0, len(available))
+	for _, nm := range available {
+		byName[nm.Name] = nm
+		knownNames = append(knownNames, nm.Name)
+	}
+
+	ordered := make([]NamedMiddleware, 0, len(names))
+	used := make(map[string]bool, len(names))
+	for _, name := range names {
+		nm, ok := byName[name]
+		if !ok {
+			return nil, errors.Errorf(
+				"unknown or disabled middleware %q, available are: %s",
+				name,
+				strings.Join(knownNames, ", "),
+			)
+		}
+
+		if used[name] {
+			return nil, errors.Errorf("middleware %q is used more than once", name)
+		}
+		used[name] = true
+
+		ordered = append(ordered, nm)
+	}
+
+	for _, nm := range available {
+		if nm.Required && !used[nm.Name] {
+			return nil, errors.Errorf("middleware %q is required", nm.Name)
+		}
+	}
+
+	err := checkMiddlewareDependencies(ordered)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]Middleware, 0, len(ordered))
+	for _, nm := range ordered {
+		res = append(res, nm.Middleware)
+	}
+
+	return res, nil
+}
+
+// checkMiddlewareDependencies fails if a middleware comes before one it depends on, dependencies which are not used are skipped,
+// the ones which cannot be left out are marked as required
+func checkMiddlewareDependencies(ordered []NamedMiddleware) error {
+	positions := make(map[string]int, len(ordered))
+	for i, nm := range ordered {
+		positions[nm.Name] = i
+	}
+
+	for i, nm := range ordered {
+		for _, dependency := range nm.After {
+			pos, ok := positions[dependency]
+			if ok && pos > i {
+				return errors.Errorf("middleware %q should come after middleware %q", nm.Name, dependency)
+			}
+		}
+	}
+
+	return nil
+}
+
+// LoggingMiddleware logs the outcome and the latency of each request
+type LoggingMiddleware struct{}
+
+func (lm LoggingMiddleware) Handle(ctx context.Context, req *Request, next Next) (*Response, error) {
+	start := time.Now()
+
+	resp, err := next(ctx, req)
+
+	log := logging.WithContext(ctx).WithFields(logging.Fields{
+		"platform": req.Platform,
+		"sender":   req.Sender.GetID(),
+		"duration": time.Since(start).String(),
+	})
+
+	switch {
+	case err != nil:
+		log.Errorf("failed to handle message: %v", err)
+	case resp == nil:
+		log.Info("handled message without response")
+	case resp.Type == Error:
+		log.Info("handled message with error response")
+	default:
+		log.Info("handled message")
+	}
+
+	return resp, err
+}
+
+const (
+	PanicMessage   = "Sorry, something went wrong while handling your message, please try again later"
+	TimeoutMessage = "Sorry, it took too long to answer your message, please try again later"
+)
+
+// RecoveryMiddleware turns panics of the inner middlewares and handlers into logged errors and a polite reply
+type RecoveryMiddleware struct{}
+
+func (rm RecoveryMiddleware) Handle(ctx context.Context, req *Request, next Next) (resp *Response, err error) {
+	defer func() {
+		rec := recover()
+		if rec == nil {
+			return
+		}
+
+		logging.WithContext(ctx).Errorf(
+			"recovered from panic while handling message from %q on %q: %v\n%s",
+			req.Sender.GetID(),
+			req.Platform,
+			rec,
+			debug.Stack(),
+		)
+
+		resp = &Response{
+			Message: PanicMessage,
+			Type:    Error,
+		}
+		err = nil
+	}()
+
+	return next(ctx, req)
+}
+
+// TimeoutMiddleware limits the time of handling a request, the deadline reaches HTTP and Redis calls through the context
+type TimeoutMiddleware struct {
+	Timeout time.Duration
+}
+
+func (tm TimeoutMiddleware) Handle(ctx context.Context, req *Request, next Next) (*Response, error) {
+	timeoutCtx, cancel := context.WithTimeout(ctx, tm.Timeout)
+	defer cancel()
+
+	resp, err := next(timeoutCtx, req)
+	if err == nil || !errors.Is(timeoutCtx.Err(), context.DeadlineExceeded) {
+		return resp, err
+	}
+
+	// the outer context expired as well, so there is no time left to reply
+	if ctx.Err() != nil {
+		return resp, err
+	}
+
+	logging.WithContext(ctx).Errorf("message handling exceeded the timeout of %v: %v", tm.Timeout, err)
+
+	return &Response{
+		Message: TimeoutMessage,
+		Type:    Error,
+	}, nil
+}
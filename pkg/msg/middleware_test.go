@@ -0,0 +1,112 @@
+package msg
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testMiddleware is identified by its name in the ordered middlewares
+type testMiddleware string
+
+func (tm testMiddleware) Handle(ctx context.Context, req *Request, next Next) (*Response, error) {
+	return next(ctx, req)
+}
+
+func TestOrderMiddlewares(t *testing.T) {
+	available := []NamedMiddleware{
+		{Name: "log", Middleware: testMiddleware("log")},
+		{Name: "user", Middleware: testMiddleware("user"), Required: true},
+		{Name: "ratelimit", Middleware: testMiddleware("ratelimit"), After: []string{"user"}},
+		{Name: "queue", Middleware: testMiddleware("queue")},
+		{Name: "timeout", Middleware: testMiddleware("timeout"), After: []string{"queue"}},
+	}
+
+	testCases := []struct {
+		name      string
+		available []NamedMiddleware
+		names     []string
+		ordered   []string
+		err       string
+	}{
+		{
+			name:      "default order",
+			available: available,
+			ordered:   []string{"log", "user", "ratelimit", "queue", "timeout"},
+		},
+		{
+			name:      "default order breaking dependency",
+			available: []NamedMiddleware{available[2], available[1]},
+			err:       `middleware "ratelimit" should come after middleware "user"`,
+		},
+		{
+			name:      "custom order",
+			available: available,
+			names:     []string{"user", "log", "queue", "ratelimit", "timeout"},
+			ordered:   []string{"user", "log", "queue", "ratelimit", "timeout"},
+		},
+		{
+			name:      "unknown name",
+			available: available,
+			names:     []string{"user", "moderation"},
+			err:       `unknown or disabled middleware "moderation"`,
+		},
+		{
+			name:      "duplicate",
+			available: available,
+			names:     []string{"user", "log", "log"},
+			err:       `middleware "log" is used more than once`,
+		},
+		{
+			name:      "required left out",
+			available: available,
+			names:     []string{"log", "queue"},
+			err:       `middleware "user" is required`,
+		},
+		{
+			name:      "dependency violated",
+			available: available,
+			names:     []string{"log", "timeout", "user", "queue"},
+			err:       `middleware "timeout" should come after middleware "queue"`,
+		},
+		{
+			name:      "unused dependency skipped",
+			available: available,
+			names:     []string{"log", "user", "timeout"},
+			ordered:   []string{"log", "user", "timeout"},
+		},
+		{
+			name:      "dependency not available skipped",
+			available: []NamedMiddleware{available[0], available[1], available[4]},
+			ordered:   []string{"log", "user", "timeout"},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			middlewares, err := OrderMiddlewares(tc.available, tc.names)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("expected error %q, got %v", tc.err, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			ordered := make([]string, 0, len(middlewares))
+			for _, m := range middlewares {
+				ordered = append(ordered, string(m.(testMiddleware)))
+			}
+
+			if !reflect.DeepEqual(ordered, tc.ordered) {
+				t.Errorf("expected order %q, got %q", tc.ordered, ordered)
+			}
+		})
+	}
+}
@@ -5,8 +5,12 @@ import (
 	"strings"
 )
 
+const sharedConversationParticipant = "all"
+
 type Sender struct {
-	ID        string
+	ID string
+	// Alias is a changeable name of the sender on the platform, e.g. the Telegram user name
+	Alias     string
 	FirstName string
 	LastName  string
 }
@@ -19,6 +23,14 @@ func (s *Sender) GetID() string {
 	return s.ID
 }
 
+func (s *Sender) GetAlias() string {
+	if s == nil {
+		return ""
+	}
+
+	return s.Alias
+}
+
 type Request struct {
 	Platform string
 	ID       string
@@ -34,7 +46,77 @@ func (r Request) GetConversationID() string {
 		conversationID = fmt.Sprint(conversationIDI)
 	}
 
-	return fmt.Sprintf("%s/%s/%s", strings.ToLower(r.Platform), conversationID, strings.ToLower(r.Sender.GetID()))
+	participantID := strings.ToLower(r.Sender.GetID())
+	if r.IsSharedConversation() {
+		participantID = sharedConversationParticipant
+	}
+
+	return fmt.Sprintf("%s/%s/%s", strings.ToLower(r.Platform), conversationID, participantID)
+}
+
+// GetTimestamp gives the unix time when the message was sent on the platform, 0 if it's unknown
+func (r Request) GetTimestamp() int64 {
+	switch timestamp := r.Meta["timestamp"].(type) {
+	case int64:
+		return timestamp
+	case int:
+		return int64(timestamp)
+	case float64:
+		return int64(timestamp)
+	default:
+		return 0
+	}
+}
+
+// IsSharedConversation tells if all participants of a group chat share one conversation
+func (r Request) IsSharedConversation() bool {
+	isShared, ok := r.Meta["is_shared_conversation"].(bool)
+
+	return ok && isShared
+}
+
+// IsCallback tells if the request was sent by pressing an inline button
+func (r Request) IsCallback() bool {
+	_, ok := r.Meta["callback_data"]
+	return ok
+}
+
+func (r Request) GetCallbackData() string {
+	callbackDataI, ok := r.Meta["callback_data"]
+	if !ok {
+		return ""
+	}
+
+	return fmt.Sprint(callbackDataI)
+}
+
+// IsInlineQuery tells if the request comes from an inline query, which is typed in any chat after the bot name
+func (r Request) IsInlineQuery() bool {
+	isInline, ok := r.Meta["is_inline_query"].(bool)
+
+	return ok && isInline
+}
+
+// IsAPIRequest tells if the request comes from the HTTP API, its sender is authenticated by an API token
+// and not by a login session
+func (r Request) IsAPIRequest() bool {
+	isAPI, ok := r.Meta["is_api_request"].(bool)
+
+	return ok && isAPI
+}
+
+// IsGroupChat tells if the request comes from a chat with other people, who see everything what the sender writes
+func (r Request) IsGroupChat() bool {
+	isGroup, ok := r.Meta["is_group_chat"].(bool)
+
+	return ok && isGroup
+}
+
+// IsEdited tells if the request contains a new text of a message which was sent before
+func (r Request) IsEdited() bool {
+	isEdited, ok := r.Meta["is_edited"].(bool)
+
+	return ok && isEdited
 }
 
 type Type uint
@@ -45,8 +127,29 @@ const (
 	Error
 )
 
+type AttachmentType uint
+
+const (
+	AttachmentUndefined AttachmentType = iota
+	AttachmentPhoto
+	AttachmentDocument
+	AttachmentAudio
+	AttachmentVoice
+)
+
+// Attachment is a file sent along with the response, the content is given either as Data or as URL
+type Attachment struct {
+	Type     AttachmentType
+	FileName string
+	MIMEType string
+	Data     []byte
+	URL      string
+	Caption  string
+}
+
 type Response struct {
-	Message string
-	Type    Type
-	Options *Options
+	Message     string
+	Type        Type
+	Options     *Options
+	Attachments []Attachment
 }
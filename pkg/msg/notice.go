@@ -0,0 +1,50 @@
+package msg
+
+import "context"
+
+// Notifier sends a short message to the sender while the request is still being processed
+type Notifier func(ctx context.Context, text string)
+
+type NotifierCtxType string
+
+const notifierCtxKey NotifierCtxType = "notifier"
+
+func WithNotifier(ctx context.Context, notifier Notifier) context.Context {
+	return context.WithValue(ctx, notifierCtxKey, notifier)
+}
+
+// Notify tells the sender something before the response is ready, it does nothing if the platform doesn't support it
+func Notify(ctx context.Context, text string) {
+	notifier, ok := ctx.Value(notifierCtxKey).(Notifier)
+	if !ok || notifier == nil {
+		return
+	}
+
+	notifier(ctx, text)
+}
+
+// UserChange describes a user of a platform whose role was changed by a handler, e.g. by an admin adding or deleting it
+type UserChange struct {
+	Platform string
+	Login    string
+	IsAdmin  bool
+}
+
+// UserChangeListener updates the platform state which depends on the role, e.g. the command menu of the user
+type UserChangeListener func(ctx context.Context, change UserChange)
+
+const userChangeListenerCtxKey NotifierCtxType = "user_change_listener"
+
+func WithUserChangeListener(ctx context.Context, listener UserChangeListener) context.Context {
+	return context.WithValue(ctx, userChangeListenerCtxKey, listener)
+}
+
+// NotifyUserChange tells the listeners of the router about a changed user, it does nothing if there are none
+func NotifyUserChange(ctx context.Context, change UserChange) {
+	listener, ok := ctx.Value(userChangeListenerCtxKey).(UserChangeListener)
+	if !ok || listener == nil {
+		return
+	}
+
+	listener(ctx, change)
+}
@@ -7,6 +7,8 @@ const (
 	OutputFormatMarkdown1
 	OutputFormatMarkdown2
 	OutputFormatHTML
+	// OutputFormatMarkdown is the generic Markdown, e.g. produced by ChatGPT, which platforms render in their own way
+	OutputFormatMarkdown
 )
 
 type PredefinedResponse string
@@ -16,10 +18,28 @@ type PredefinedResponseOptions struct {
 	IsTemp    bool
 }
 
+// InlineButton is shown under the response message, pressing it sends Data back as a callback request,
+// if URL is set, the button opens it instead
+type InlineButton struct {
+	Text string
+	Data string
+	URL  string
+}
+
+// CallbackAnswer is shown to the user as a notification after pressing an inline button
+type CallbackAnswer struct {
+	Text      string
+	ShowAlert bool
+}
+
 type Options struct {
 	outputFormat              OutputFormat
 	isResponseToHiddenMessage bool
+	isSensitive               bool
 	predefinedResponseOptions *PredefinedResponseOptions
+	inlineButtons             [][]InlineButton
+	isEditOriginalMessage     bool
+	callbackAnswer            *CallbackAnswer
 }
 
 func (o *Options) WithFormat(f OutputFormat) {
@@ -30,6 +50,11 @@ func (o *Options) WithIsResponseToHiddenMessage() {
 	o.isResponseToHiddenMessage = true
 }
 
+// WithIsSensitive marks responses with secrets, e.g. API tokens, which should never be logged
+func (o *Options) WithIsSensitive() {
+	o.isSensitive = true
+}
+
 func (o *Options) WithPredefinedResponse(r string) {
 	if o.predefinedResponseOptions == nil {
 		o.predefinedResponseOptions = &PredefinedResponseOptions{}
@@ -49,6 +74,23 @@ func (o *Options) WithIsTempPredefinedResponse() {
 	o.predefinedResponseOptions.IsTemp = true
 }
 
+func (o *Options) WithInlineButtonsRow(buttons ...InlineButton) {
+	o.inlineButtons = append(o.inlineButtons, buttons)
+}
+
+// WithEditOriginalMessage replaces the message with the pressed inline button or the previous answer to an edited message
+// instead of sending a new one
+func (o *Options) WithEditOriginalMessage() {
+	o.isEditOriginalMessage = true
+}
+
+func (o *Options) WithCallbackAnswer(text string, showAlert bool) {
+	o.callbackAnswer = &CallbackAnswer{
+		Text:      text,
+		ShowAlert: showAlert,
+	}
+}
+
 func (o *Options) GetFormat() OutputFormat {
 	if o == nil {
 		return OutputFormatUndefined
@@ -65,6 +107,14 @@ func (o *Options) IsResponseToHiddenMessage() bool {
 	return o.isResponseToHiddenMessage
 }
 
+func (o *Options) IsSensitive() bool {
+	if o == nil {
+		return false
+	}
+
+	return o.isSensitive
+}
+
 func (o *Options) GetPredefinedResponses() []PredefinedResponse {
 	if o == nil || o.predefinedResponseOptions == nil {
 		return nil
@@ -80,3 +130,27 @@ func (o *Options) IsTempPredefinedResponse() bool {
 
 	return o.predefinedResponseOptions.IsTemp
 }
+
+func (o *Options) GetInlineButtons() [][]InlineButton {
+	if o == nil {
+		return nil
+	}
+
+	return o.inlineButtons
+}
+
+func (o *Options) IsEditOriginalMessage() bool {
+	if o == nil {
+		return false
+	}
+
+	return o.isEditOriginalMessage
+}
+
+func (o *Options) GetCallbackAnswer() *CallbackAnswer {
+	if o == nil {
+		return nil
+	}
+
+	return o.callbackAnswer
+}
@@ -0,0 +1,33 @@
+package msg
+
+import "context"
+
+type Activity uint
+
+const (
+	ActivityTyping Activity = iota
+	ActivityUploadingPhoto
+	ActivityUploadingDocument
+	ActivityUploadingAudio
+)
+
+// ProgressReporter shows the user that the request is being processed, e.g. as a typing indicator
+type ProgressReporter func(ctx context.Context, activity Activity)
+
+type ProgressCtxType string
+
+const progressReporterCtxKey ProgressCtxType = "progress_reporter"
+
+func WithProgressReporter(ctx context.Context, reporter ProgressReporter) context.Context {
+	return context.WithValue(ctx, progressReporterCtxKey, reporter)
+}
+
+// ReportProgress notifies the platform about a long-running activity, it does nothing if the platform doesn't support it
+func ReportProgress(ctx context.Context, activity Activity) {
+	reporter, ok := ctx.Value(progressReporterCtxKey).(ProgressReporter)
+	if !ok || reporter == nil {
+		return
+	}
+
+	reporter(ctx, activity)
+}
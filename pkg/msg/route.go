@@ -6,31 +6,64 @@ import (
 	"github.com/pkg/errors"
 )
 
+// Next passes the request further down the chain, to the following middleware or to the matching handler
+type Next func(ctx context.Context, req *Request) (*Response, error)
+
+// Middleware wraps the handling of requests, it can change the request before calling next,
+// change the response or the error returned by next, or answer on its own without calling next at all
 type Middleware interface {
-	Handle(ctx context.Context, req *Request) (*Response, error)
+	Handle(ctx context.Context, req *Request, next Next) (*Response, error)
+}
+
+// MiddlewareFunc allows using ordinary functions as middlewares
+type MiddlewareFunc func(ctx context.Context, req *Request, next Next) (*Response, error)
+
+func (f MiddlewareFunc) Handle(ctx context.Context, req *Request, next Next) (*Response, error) {
+	return f(ctx, req, next)
 }
 
 type Router struct {
-	Handlers    []Handler
+	Handlers []Handler
+	// Middlewares wrap the handlers in the given order, the first one is the outermost
 	Middlewares []Middleware
+	// UserChangeListeners are told about users whose role was changed by a handler, whichever frontend the request came from
+	UserChangeListeners []UserChangeListener
 }
 
 func (ch *Router) UseMiddleware(m Middleware) {
 	ch.Middlewares = append(ch.Middlewares, m)
 }
 
+// OnUserChange registers a listener of role changes, e.g. of a frontend which shows commands depending on the role
+func (ch *Router) OnUserChange(l UserChangeListener) {
+	ch.UserChangeListeners = append(ch.UserChangeListeners, l)
+}
+
 func (ch *Router) Route(ctx context.Context, req *Request) (*Response, error) {
-	for _, m := range ch.Middlewares {
-		resp, err := m.Handle(ctx, req)
-		if err != nil {
-			return nil, err
-		}
+	if len(ch.UserChangeListeners) > 0 {
+		ctx = WithUserChangeListener(ctx, ch.notifyUserChange)
+	}
 
-		if resp != nil {
-			return resp, nil
-		}
+	return ch.next(0)(ctx, req)
+}
+
+func (ch *Router) notifyUserChange(ctx context.Context, change UserChange) {
+	for _, l := range ch.UserChangeListeners {
+		l(ctx, change)
 	}
+}
+
+func (ch *Router) next(pos int) Next {
+	if pos >= len(ch.Middlewares) {
+		return ch.handle
+	}
+
+	return func(ctx context.Context, req *Request) (*Response, error) {
+		return ch.Middlewares[pos].Handle(ctx, req, ch.next(pos+1))
+	}
+}
 
+func (ch *Router) handle(ctx context.Context, req *Request) (*Response, error) {
 	for _, h := range ch.Handlers {
 		canHandle, err := h.CanHandle(ctx, req)
 		if err != nil {
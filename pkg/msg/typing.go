@@ -0,0 +1,94 @@
+package msg
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	logging "github.com/sirupsen/logrus"
+)
+
+// SetTypingFunc shows or hides the typing indicator of a platform in one chat
+type SetTypingFunc func(ctx context.Context, isTyping bool) error
+
+// TypingIndicator shows that the bot is typing on the first reported activity and repeats it until stopped,
+// it's used by platforms without indicators for uploads, so all activities are shown as typing
+type TypingIndicator struct {
+	setTyping       SetTypingFunc
+	refreshInterval time.Duration
+
+	mu        sync.Mutex
+	isStarted bool
+	stopCh    chan struct{}
+	stopOnce  sync.Once
+}
+
+// NewTypingIndicator creates an indicator which is refreshed before the platform hides it
+func NewTypingIndicator(refreshInterval time.Duration, setTyping SetTypingFunc) *TypingIndicator {
+	return &TypingIndicator{
+		setTyping:       setTyping,
+		refreshInterval: refreshInterval,
+		stopCh:          make(chan struct{}),
+	}
+}
+
+// Report is a ProgressReporter
+func (ti *TypingIndicator) Report(ctx context.Context, _ Activity) {
+	ti.mu.Lock()
+	isStarted := ti.isStarted
+	ti.isStarted = true
+	ti.mu.Unlock()
+
+	if isStarted {
+		return
+	}
+
+	ti.notify(ctx, true)
+	go ti.refresh(ctx)
+}
+
+// Stop ends the refreshes and hides the indicator if it was shown
+func (ti *TypingIndicator) Stop(ctx context.Context) {
+	ti.stopOnce.Do(func() {
+		close(ti.stopCh)
+
+		ti.mu.Lock()
+		isStarted := ti.isStarted
+		ti.mu.Unlock()
+
+		if isStarted {
+			ti.notify(ctx, false)
+		}
+	})
+}
+
+func (ti *TypingIndicator) refresh(ctx context.Context) {
+	ticker := time.NewTicker(ti.refreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ti.stopCh:
+			return
+		case <-ticker.C:
+			ti.notify(ctx, true)
+		}
+	}
+}
+
+func (ti *TypingIndicator) notify(ctx context.Context, isTyping bool) {
+	if isTyping {
+		select {
+		case <-ti.stopCh:
+			return
+		default:
+		}
+	}
+
+	err := ti.setTyping(ctx, isTyping)
+	if err != nil {
+		logging.WithContext(ctx).Warnf("failed to set typing indicator: %v", err)
+	}
+}
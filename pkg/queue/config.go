@@ -0,0 +1,45 @@
+package queue
+
+import (
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+	"github.com/pkg/errors"
+
+	"breathbathChatGPT/pkg/errs"
+)
+
+type Config struct {
+	Enabled      bool          `envconfig:"QUEUE_ENABLED" default:"true"`
+	Lease        time.Duration `envconfig:"QUEUE_LEASE" default:"30s"`
+	PollInterval time.Duration `envconfig:"QUEUE_POLL_INTERVAL" default:"200ms"`
+}
+
+func (c *Config) Validate() *errs.Multi {
+	e := errs.NewMulti()
+
+	if c.Lease < time.Second {
+		e.Errf("QUEUE_LEASE should be at least 1s, got %v", c.Lease)
+	}
+
+	if c.PollInterval <= 0 {
+		e.Errf("QUEUE_POLL_INTERVAL should be positive, got %v", c.PollInterval)
+	}
+
+	if c.PollInterval >= c.Lease/heartbeatsPerLease {
+		e.Errf("QUEUE_POLL_INTERVAL should be less than a third of QUEUE_LEASE, got %v", c.PollInterval)
+	}
+
+	return e
+}
+
+func LoadConfig() (cfg *Config, err error) {
+	cfg = new(Config)
+
+	err = envconfig.Process("queue", cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load queue config")
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,88 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	logging "github.com/sirupsen/logrus"
+
+	"breathbathChatGPT/pkg/msg"
+	"breathbathChatGPT/pkg/storage"
+)
+
+const (
+	keyVersion  = "v1"
+	keyPlatform = "queue"
+	keyDomain   = "conversation"
+
+	StillWorkingMessage = "Still working on your previous message, I'll answer this one right after it"
+)
+
+// Middleware processes the messages of one conversation one by one in the order they were sent,
+// so that concurrent requests don't overwrite each other's changes of the conversation,
+// the frontends handle messages concurrently, so the order of arrival here can differ from the order of sending
+type Middleware struct {
+	queue *Queue
+}
+
+func NewMiddleware(q *Queue) *Middleware {
+	return &Middleware{queue: q}
+}
+
+func (m *Middleware) Handle(ctx context.Context, req *msg.Request, next msg.Next) (*msg.Response, error) {
+	// inline queries don't change the conversation and have to be answered within seconds
+	if req.IsInlineQuery() {
+		return next(ctx, req)
+	}
+
+	log := logging.WithContext(ctx)
+
+	key := storage.GenerateCacheKey(keyVersion, keyPlatform, keyDomain, req.GetConversationID())
+	sentAt := req.GetTimestamp()
+	if sentAt == 0 {
+		sentAt = time.Now().Unix()
+	}
+	entryID := buildEntryID(req)
+
+	isFirst, err := m.queue.Join(ctx, key, entryID, sentAt)
+	if err != nil {
+		// an unavailable queue shouldn't make the bot unavailable
+		log.Errorf("failed to join queue %q, the message is processed without waiting: %v", key, err)
+		return next(ctx, req)
+	}
+	defer m.queue.Leave(key, entryID)
+
+	if !isFirst {
+		log.Infof("message waits for the previous ones in queue %q", key)
+		msg.Notify(ctx, StillWorkingMessage)
+
+		err = m.queue.WaitTurn(ctx, key, entryID)
+		if ctx.Err() != nil {
+			return nil, err
+		}
+
+		if err != nil {
+			log.Errorf("failed to wait in queue %q, the message is processed without waiting: %v", key, err)
+		}
+	}
+
+	stopKeeping := m.queue.KeepTurn(key, entryID)
+	defer stopKeeping()
+
+	return next(ctx, req)
+}
+
+// buildEntryID starts the id with the message id if it's a number, e.g. of Telegram or Discord, or a Slack timestamp,
+// so that messages sent within the same second are ordered as well, otherwise the time of arrival is used
+func buildEntryID(req *msg.Request) string {
+	order, err := strconv.ParseUint(strings.Replace(req.ID, ".", "", 1), 10, 64)
+	if err != nil {
+		order = uint64(time.Now().UnixNano())
+	}
+
+	return fmt.Sprintf("%020d/%s", order, uuid.NewString())
+}
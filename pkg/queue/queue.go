@@ -0,0 +1,183 @@
+package queue
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	logging "github.com/sirupsen/logrus"
+
+	"breathbathChatGPT/pkg/storage"
+)
+
+const (
+	// heartbeatsPerLease is how often the lease is refreshed within its validity, so that a slow refresh doesn't lose it
+	heartbeatsPerLease = 3
+
+	releaseTimeout = time.Second * 5
+)
+
+// takeTurnScript refreshes the lease of the entry and drops the entries from the head of the queue whose leases expired,
+// since their instances crashed, it returns 0 if the entry is the first one, 1 if it has to wait and -1 if it's not queued,
+// the entry taking its turn gets the lowest score, so that a message sent earlier but joining later cannot get before it
+const takeTurnScript = `
+if not redis.call('ZSCORE', KEYS[1], ARGV[1]) then
+	return -1
+end
+
+local lease_prefix = KEYS[1] .. '/lease/'
+redis.call('SET', lease_prefix .. ARGV[1], 1, 'PX', ARGV[2])
+redis.call('PEXPIRE', KEYS[1], ARGV[2])
+
+while true do
+	local head = redis.call('ZRANGE', KEYS[1], 0, 0)[1]
+	if not head then
+		return -1
+	end
+
+	if head == ARGV[1] then
+		redis.call('ZADD', KEYS[1], '-inf', ARGV[1])
+		return 0
+	end
+
+	if redis.call('EXISTS', lease_prefix .. head) == 1 then
+		return 1
+	end
+
+	redis.call('ZREM', KEYS[1], head)
+end
+`
+
+// joinScript adds the entry with the send time of the message as the score, entries with the same score
+// are ordered by their ids, which start with the message id
+const joinScript = `
+redis.call('ZADD', KEYS[1], ARGV[3], ARGV[1])
+` + takeTurnScript
+
+const leaveScript = `
+redis.call('ZREM', KEYS[1], ARGV[1])
+redis.call('DEL', KEYS[1] .. '/lease/' .. ARGV[1])
+`
+
+const (
+	turnTaken   = 0
+	turnWaiting = 1
+	turnLost    = -1
+)
+
+// Queue lets requests with the same key run one by one in the order they were sent on all bot instances,
+// each entry holds a lease which is refreshed while it waits or runs, entries of crashed instances are skipped when it expires
+type Queue struct {
+	cfg    *Config
+	runner storage.ScriptRunner
+}
+
+func NewQueue(cfg *Config, runner storage.ScriptRunner) (*Queue, error) {
+	e := cfg.Validate()
+	if e.HasErrors() {
+		return nil, e
+	}
+
+	return &Queue{cfg: cfg, runner: runner}, nil
+}
+
+// Join puts the entry to the queue after the entries sent before it and tells if it's the first one,
+// which can run immediately, sentAt is the unix time of the message
+func (q *Queue) Join(ctx context.Context, key, entryID string, sentAt int64) (isFirst bool, err error) {
+	turn, err := q.run(ctx, joinScript, key, entryID, sentAt)
+	if err != nil {
+		return false, err
+	}
+
+	return turn == turnTaken, nil
+}
+
+// WaitTurn blocks till all entries before the given one leave the queue or the context is done
+func (q *Queue) WaitTurn(ctx context.Context, key, entryID string) error {
+	ticker := time.NewTicker(q.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		turn, err := q.run(ctx, takeTurnScript, key, entryID)
+		if err != nil {
+			return err
+		}
+
+		switch turn {
+		case turnTaken:
+			return nil
+		case turnLost:
+			return errors.Errorf("entry %q was dropped from queue %q", entryID, key)
+		}
+	}
+}
+
+// KeepTurn refreshes the lease of the running entry till the returned function is called
+func (q *Queue) KeepTurn(key, entryID string) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(q.cfg.Lease / heartbeatsPerLease)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			turn, err := q.run(ctx, takeTurnScript, key, entryID)
+			if err != nil && ctx.Err() == nil {
+				logging.Errorf("failed to refresh lease of entry %q in queue %q: %v", entryID, key, err)
+				continue
+			}
+
+			if turn != turnTaken && ctx.Err() == nil {
+				logging.Warnf("entry %q lost its turn in queue %q since its lease has expired", entryID, key)
+				return
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// Leave removes the entry, so that the next one can run, it doesn't depend on the request context which might be done already
+func (q *Queue) Leave(key, entryID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+	defer cancel()
+
+	_, err := q.runner.RunScript(ctx, leaveScript, []string{key}, entryID)
+	if err != nil {
+		logging.Errorf("failed to remove entry %q from queue %q: %v", entryID, key, err)
+	}
+}
+
+func (q *Queue) run(ctx context.Context, script, key, entryID string, args ...interface{}) (int64, error) {
+	args = append([]interface{}{entryID, q.cfg.Lease.Milliseconds()}, args...)
+
+	res, err := q.runner.RunScript(ctx, script, []string{key}, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	turn, ok := res.(int64)
+	if !ok {
+		return 0, errors.Errorf("unexpected queue script result %v", res)
+	}
+
+	return turn, nil
+}
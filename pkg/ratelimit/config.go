@@ -0,0 +1,46 @@
+package ratelimit
+
+import (
+	"github.com/kelseyhightower/envconfig"
+	"github.com/pkg/errors"
+
+	"breathbathChatGPT/pkg/errs"
+)
+
+type Config struct {
+	// Commands and Completions map roles to limits like "20/1h", roles without a limit are not limited
+	Commands    map[string]string `envconfig:"RATELIMIT_COMMANDS"`
+	Completions map[string]string `envconfig:"RATELIMIT_COMPLETIONS"`
+}
+
+func (c *Config) Validate() *errs.Multi {
+	e := errs.NewMulti()
+
+	_, err := parseLimits(c.Commands)
+	if err != nil {
+		e.Errf("invalid RATELIMIT_COMMANDS: %v", err)
+	}
+
+	_, err = parseLimits(c.Completions)
+	if err != nil {
+		e.Errf("invalid RATELIMIT_COMPLETIONS: %v", err)
+	}
+
+	return e
+}
+
+// IsEnabled tells if any role is limited
+func (c *Config) IsEnabled() bool {
+	return len(c.Commands) > 0 || len(c.Completions) > 0
+}
+
+func LoadConfig() (cfg *Config, err error) {
+	cfg = new(Config)
+
+	err = envconfig.Process("ratelimit", cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load rate limit config")
+	}
+
+	return cfg, nil
+}
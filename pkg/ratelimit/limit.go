@@ -0,0 +1,59 @@
+package ratelimit
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Limit is a token bucket which holds up to Burst requests and is refilled completely within Period
+type Limit struct {
+	Burst  int
+	Period time.Duration
+}
+
+// refillInterval is the time to get one request back
+func (l Limit) refillInterval() time.Duration {
+	return l.Period / time.Duration(l.Burst)
+}
+
+// parseLimit reads limits like "20/1h", which allows bursts of 20 requests and 20 requests per hour in average
+func parseLimit(input string) (Limit, error) {
+	burstStr, periodStr, ok := strings.Cut(strings.TrimSpace(input), "/")
+	if !ok {
+		return Limit{}, errors.Errorf("limit %q should look like {requests}/{period}, e.g. 20/1h", input)
+	}
+
+	burst, err := strconv.Atoi(strings.TrimSpace(burstStr))
+	if err != nil || burst <= 0 {
+		return Limit{}, errors.Errorf("requests count of limit %q should be a positive number", input)
+	}
+
+	period, err := time.ParseDuration(strings.TrimSpace(periodStr))
+	if err != nil || period <= 0 {
+		return Limit{}, errors.Errorf("period of limit %q should be a positive duration like 30s, 10m or 1h", input)
+	}
+
+	limit := Limit{Burst: burst, Period: period}
+	if limit.refillInterval() < time.Millisecond {
+		return Limit{}, errors.Errorf("limit %q allows more than one request per millisecond", input)
+	}
+
+	return limit, nil
+}
+
+func parseLimits(inputs map[string]string) (map[string]Limit, error) {
+	limits := make(map[string]Limit, len(inputs))
+	for role, input := range inputs {
+		limit, err := parseLimit(input)
+		if err != nil {
+			return nil, errors.Wrapf(err, "role %q", role)
+		}
+
+		limits[strings.TrimSpace(role)] = limit
+	}
+
+	return limits, nil
+}
@@ -0,0 +1,86 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"breathbathChatGPT/pkg/storage"
+)
+
+// takeTokenScript refills the bucket by the time passed since the last request and takes one token from it if possible,
+// the redis clock is used, so that all bot instances see the same time, it returns the flag if a token was taken
+// and the milliseconds till the next token otherwise
+const takeTokenScript = `
+redis.replicate_commands()
+
+local burst = tonumber(ARGV[1])
+local refill_ms = tonumber(ARGV[2])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil or ts == nil then
+	tokens = burst
+	ts = now
+end
+
+tokens = math.min(burst, tokens + math.max(0, now - ts) / refill_ms)
+
+local allowed = 0
+local wait_ms = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	wait_ms = math.ceil((1 - tokens) * refill_ms)
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst * refill_ms))
+
+return {allowed, wait_ms}
+`
+
+// Limiter keeps token buckets in redis, so that the limits apply to all bot instances together
+type Limiter struct {
+	runner storage.ScriptRunner
+}
+
+func NewLimiter(runner storage.ScriptRunner) *Limiter {
+	return &Limiter{runner: runner}
+}
+
+// Take takes one request from the bucket under the key, if it's empty, it tells how long to wait for the next request
+func (l *Limiter) Take(ctx context.Context, key string, limit Limit) (isAllowed bool, retryAfter time.Duration, err error) {
+	res, err := l.runner.RunScript(
+		ctx,
+		takeTokenScript,
+		[]string{key},
+		limit.Burst,
+		limit.refillInterval().Milliseconds(),
+	)
+	if err != nil {
+		return false, 0, err
+	}
+
+	values, ok := res.([]interface{})
+	if !ok || len(values) != 2 {
+		return false, 0, errors.Errorf("unexpected rate limit script result %v", res)
+	}
+
+	allowed, ok := values[0].(int64)
+	if !ok {
+		return false, 0, errors.Errorf("unexpected rate limit script result %v", res)
+	}
+
+	waitMs, ok := values[1].(int64)
+	if !ok {
+		return false, 0, errors.Errorf("unexpected rate limit script result %v", res)
+	}
+
+	return allowed == 1, time.Duration(waitMs) * time.Millisecond, nil
+}
@@ -0,0 +1,122 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	logging "github.com/sirupsen/logrus"
+
+	"breathbathChatGPT/pkg/msg"
+	"breathbathChatGPT/pkg/storage"
+)
+
+const (
+	keyVersion = "v1"
+	keyDomain  = "ratelimit"
+
+	// GuestRole is the role of senders who aren't logged in
+	GuestRole = "guest"
+
+	KindCommands    = "commands"
+	KindCompletions = "completions"
+)
+
+// Identity is the role which defines the limits and the id of whom the limits are applied to
+type Identity struct {
+	Role string
+	ID   string
+}
+
+// Middleware refuses requests over the limits of the sender's role, commands and completions are limited separately
+type Middleware struct {
+	limiter     *Limiter
+	commands    map[string]Limit
+	completions map[string]Limit
+	identify    func(req *msg.Request) Identity
+}
+
+func NewMiddleware(cfg *Config, limiter *Limiter, identify func(req *msg.Request) Identity) (*Middleware, error) {
+	e := cfg.Validate()
+	if e.HasErrors() {
+		return nil, e
+	}
+
+	commands, err := parseLimits(cfg.Commands)
+	if err != nil {
+		return nil, err
+	}
+
+	completions, err := parseLimits(cfg.Completions)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Middleware{
+		limiter:     limiter,
+		commands:    commands,
+		completions: completions,
+		identify:    identify,
+	}, nil
+}
+
+func (m *Middleware) Handle(ctx context.Context, req *msg.Request, next msg.Next) (*msg.Response, error) {
+	log := logging.WithContext(ctx)
+
+	kind, limits := KindCompletions, m.completions
+	if strings.HasPrefix(req.Message, msg.CommandPrefix) {
+		kind, limits = KindCommands, m.commands
+	}
+
+	identity := m.identify(req)
+	limit, ok := limits[identity.Role]
+	if !ok || identity.ID == "" {
+		return next(ctx, req)
+	}
+
+	key := storage.GenerateCacheKey(keyVersion, keyDomain, kind, identity.ID)
+	isAllowed, retryAfter, err := m.limiter.Take(ctx, key, limit)
+	if err != nil {
+		// an unavailable limiter shouldn't make the bot unavailable
+		log.Errorf("failed to check rate limit under key %q, the request is let through: %v", key, err)
+		return next(ctx, req)
+	}
+
+	if isAllowed {
+		return next(ctx, req)
+	}
+
+	log.Infof("%s of %q exceeded the limit of %d per %v", kind, identity.ID, limit.Burst, limit.Period)
+
+	return &msg.Response{
+		Message: fmt.Sprintf(
+			"You are sending %s too often, please try again in %s",
+			describeKind(kind),
+			formatWait(retryAfter),
+		),
+		Type: msg.Error,
+	}, nil
+}
+
+func describeKind(kind string) string {
+	if kind == KindCommands {
+		return "commands"
+	}
+
+	return "messages"
+}
+
+// formatWait rounds the wait time up to seconds, so that the user doesn't come back too early
+func formatWait(wait time.Duration) string {
+	rounded := wait.Truncate(time.Second)
+	if rounded < wait {
+		rounded += time.Second
+	}
+
+	if rounded < time.Second {
+		rounded = time.Second
+	}
+
+	return rounded.String()
+}
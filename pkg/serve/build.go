@@ -0,0 +1,15 @@
+package serve
+
+// BuildSupervisor loads the config, non empty frontends override SERVE_FRONTENDS
+func BuildSupervisor(frontends []string) (*Supervisor, error) {
+	config, err := LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(frontends) > 0 {
+		config.Frontends = frontends
+	}
+
+	return NewSupervisor(config)
+}
@@ -0,0 +1,64 @@
+package serve
+
+import (
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+	"github.com/pkg/errors"
+
+	"breathbathChatGPT/pkg/errs"
+)
+
+type Config struct {
+	Frontends       []string      `envconfig:"SERVE_FRONTENDS"`
+	HealthListen    string        `envconfig:"SERVE_HEALTH_LISTEN" default:":8090"`
+	StartupWait     time.Duration `envconfig:"SERVE_STARTUP_WAIT" default:"3s"`
+	ShutdownTimeout time.Duration `envconfig:"SERVE_SHUTDOWN_TIMEOUT" default:"1m"`
+	CheckTimeout    time.Duration `envconfig:"SERVE_CHECK_TIMEOUT" default:"5s"`
+}
+
+func (c *Config) Validate() *errs.Multi {
+	e := errs.NewMulti()
+
+	if len(c.Frontends) == 0 {
+		e.Errf("SERVE_FRONTENDS cannot be empty")
+	}
+
+	seen := make(map[string]bool, len(c.Frontends))
+	for _, name := range c.Frontends {
+		if name == "" {
+			e.Errf("SERVE_FRONTENDS cannot contain empty names")
+			continue
+		}
+
+		if seen[name] {
+			e.Errf("SERVE_FRONTENDS contains %q more than once", name)
+		}
+		seen[name] = true
+	}
+
+	if c.StartupWait < 0 {
+		e.Errf("SERVE_STARTUP_WAIT cannot be negative, got %v", c.StartupWait)
+	}
+
+	if c.ShutdownTimeout <= 0 {
+		e.Errf("SERVE_SHUTDOWN_TIMEOUT should be positive, got %v", c.ShutdownTimeout)
+	}
+
+	if c.CheckTimeout <= 0 {
+		e.Errf("SERVE_CHECK_TIMEOUT should be positive, got %v", c.CheckTimeout)
+	}
+
+	return e
+}
+
+func LoadConfig() (cfg *Config, err error) {
+	cfg = new(Config)
+
+	err = envconfig.Process("serve", cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load serve config")
+	}
+
+	return cfg, nil
+}
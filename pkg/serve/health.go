@@ -0,0 +1,86 @@
+package serve
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	logging "github.com/sirupsen/logrus"
+)
+
+type FrontendStatus struct {
+	State State  `json:"state"`
+	Error string `json:"error,omitempty"`
+}
+
+type HealthReport struct {
+	Healthy   bool                      `json:"healthy"`
+	Frontends map[string]FrontendStatus `json:"frontends"`
+	Checks    map[string]string         `json:"checks,omitempty"`
+}
+
+// Report gives the states of the frontends and the results of the health checks,
+// it's healthy only if all frontends are running and all checks pass
+func (s *Supervisor) Report(ctx context.Context) *HealthReport {
+	report := &HealthReport{
+		Healthy:   true,
+		Frontends: make(map[string]FrontendStatus, len(s.frontends)),
+		Checks:    make(map[string]string, len(s.checks)),
+	}
+
+	s.mu.RLock()
+	for _, mf := range s.frontends {
+		status := FrontendStatus{State: mf.state}
+		if mf.err != nil {
+			status.Error = mf.err.Error()
+		}
+		report.Frontends[mf.name] = status
+
+		if mf.state != StateRunning {
+			report.Healthy = false
+		}
+	}
+	s.mu.RUnlock()
+
+	for name, check := range s.checks {
+		checkCtx, cancel := context.WithTimeout(ctx, s.cfg.CheckTimeout)
+		err := check(checkCtx)
+		cancel()
+
+		if err != nil {
+			report.Checks[name] = err.Error()
+			report.Healthy = false
+			continue
+		}
+
+		report.Checks[name] = "ok"
+	}
+
+	return report
+}
+
+func (s *Supervisor) handleHealth(w http.ResponseWriter, r *http.Request) {
+	report := s.Report(r.Context())
+
+	status := http.StatusOK
+	if !report.Healthy {
+		status = http.StatusServiceUnavailable
+	}
+
+	writeJSON(w, status, report)
+}
+
+// handleLive only tells that the process is able to answer, unlike handleHealth it doesn't depend on the frontends
+func (s *Supervisor) handleLive(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	err := json.NewEncoder(w).Encode(data)
+	if err != nil {
+		logging.Errorf("failed to write health response: %v", err)
+	}
+}
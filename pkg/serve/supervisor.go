@@ -0,0 +1,268 @@
+package serve
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	logging "github.com/sirupsen/logrus"
+)
+
+const (
+	HealthPath = "/healthz"
+	LivePath   = "/livez"
+
+	readHeaderTimeout = time.Second * 10
+)
+
+// Frontend is a blocking server, Start returns when it's stopped or fails, Stop waits for the requests in progress
+type Frontend interface {
+	Start() error
+	Stop()
+}
+
+// HealthCheck tells if a dependency shared by the frontends, e.g. the storage, is usable
+type HealthCheck func(ctx context.Context) error
+
+type State string
+
+const (
+	StateStarting State = "starting"
+	StateRunning  State = "running"
+	StateFailed   State = "failed"
+	StateStopping State = "stopping"
+	StateStopped  State = "stopped"
+)
+
+type frontendExit struct {
+	name string
+	err  error
+}
+
+type managedFrontend struct {
+	name     string
+	frontend Frontend
+	state    State
+	err      error
+}
+
+// Supervisor runs several frontends in one process, if one of them fails all others are stopped as well
+type Supervisor struct {
+	cfg       *Config
+	frontends []*managedFrontend
+	checks    map[string]HealthCheck
+	health    *http.Server
+
+	mu       sync.RWMutex
+	exits    chan frontendExit
+	stopping chan struct{}
+	stopOnce sync.Once
+	stopped  chan struct{}
+}
+
+func NewSupervisor(cfg *Config) (*Supervisor, error) {
+	e := cfg.Validate()
+	if e.HasErrors() {
+		return nil, e
+	}
+
+	s := &Supervisor{
+		cfg:      cfg,
+		checks:   map[string]HealthCheck{},
+		stopping: make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+
+	if cfg.HealthListen != "" {
+		mux := http.NewServeMux()
+		mux.HandleFunc(HealthPath, s.handleHealth)
+		mux.HandleFunc(LivePath, s.handleLive)
+
+		s.health = &http.Server{
+			Addr:              cfg.HealthListen,
+			Handler:           mux,
+			ReadHeaderTimeout: readHeaderTimeout,
+		}
+	}
+
+	return s, nil
+}
+
+// AddFrontend registers a frontend before the supervisor is started, frontends are started in the order of adding
+func (s *Supervisor) AddFrontend(name string, f Frontend) {
+	s.frontends = append(s.frontends, &managedFrontend{
+		name:     name,
+		frontend: f,
+		state:    StateStarting,
+	})
+}
+
+// AddCheck registers a health check which is run on each request to the health endpoint
+func (s *Supervisor) AddCheck(name string, check HealthCheck) {
+	s.checks[name] = check
+}
+
+// Start starts all frontends and blocks till the supervisor is stopped, a frontend which fails or exits
+// within the startup wait or later stops all others and its error is returned
+func (s *Supervisor) Start() error {
+	if len(s.frontends) == 0 {
+		return errors.New("no frontends to start")
+	}
+
+	s.exits = make(chan frontendExit, len(s.frontends)+1)
+
+	if s.health != nil {
+		go s.serveHealth()
+	}
+
+	for _, mf := range s.frontends {
+		mf := mf
+		logging.Infof("starting frontend %q", mf.name)
+		go func() {
+			s.exits <- frontendExit{name: mf.name, err: mf.frontend.Start()}
+		}()
+	}
+
+	startupTimer := time.NewTimer(s.cfg.StartupWait)
+	defer startupTimer.Stop()
+
+	select {
+	case exit := <-s.exits:
+		return s.fail(exit, "during startup")
+	case <-s.stopping:
+		<-s.stopped
+		return nil
+	case <-startupTimer.C:
+	}
+
+	s.mu.Lock()
+	for _, mf := range s.frontends {
+		if mf.state == StateStarting {
+			mf.state = StateRunning
+		}
+	}
+	s.mu.Unlock()
+
+	logging.Infof("started %d frontends", len(s.frontends))
+
+	select {
+	case exit := <-s.exits:
+		return s.fail(exit, "")
+	case <-s.stopping:
+		<-s.stopped
+		return nil
+	}
+}
+
+// Stop stops all frontends concurrently and waits till they finish the requests in progress or the shutdown timeout passes
+func (s *Supervisor) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stopping)
+		s.stopAll()
+		close(s.stopped)
+	})
+	<-s.stopped
+}
+
+func (s *Supervisor) fail(exit frontendExit, phase string) error {
+	// frontends exit as well when they are stopped by the supervisor
+	select {
+	case <-s.stopping:
+		<-s.stopped
+		return nil
+	default:
+	}
+
+	err := exit.err
+	if err == nil {
+		err = errors.New("stopped unexpectedly")
+	}
+
+	s.mu.Lock()
+	for _, mf := range s.frontends {
+		if mf.name == exit.name {
+			mf.state = StateFailed
+			mf.err = err
+		}
+	}
+	s.mu.Unlock()
+
+	if phase != "" {
+		logging.Errorf("frontend %q failed %s: %v", exit.name, phase, err)
+	} else {
+		logging.Errorf("frontend %q failed: %v", exit.name, err)
+	}
+
+	s.Stop()
+
+	return errors.Wrapf(err, "frontend %q failed", exit.name)
+}
+
+func (s *Supervisor) stopAll() {
+	logging.Infof("will stop %d frontends", len(s.frontends))
+
+	wg := sync.WaitGroup{}
+	for _, mf := range s.frontends {
+		mf := mf
+
+		s.mu.Lock()
+		if mf.state == StateFailed {
+			s.mu.Unlock()
+			continue
+		}
+		mf.state = StateStopping
+		s.mu.Unlock()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			mf.frontend.Stop()
+
+			s.mu.Lock()
+			mf.state = StateStopped
+			s.mu.Unlock()
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		logging.Info("stopped all frontends")
+	case <-time.After(s.cfg.ShutdownTimeout):
+		logging.Warnf("frontends didn't stop within %v, giving up", s.cfg.ShutdownTimeout)
+	}
+
+	if s.health != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), readHeaderTimeout)
+		defer cancel()
+
+		err := s.health.Shutdown(ctx)
+		if err != nil {
+			logging.Errorf("failed to shutdown health server gracefully: %v", err)
+		}
+	}
+}
+
+func (s *Supervisor) serveHealth() {
+	logging.Infof("will listen for health checks on %q", s.cfg.HealthListen)
+
+	err := s.health.ListenAndServe()
+	if err == nil || errors.Is(err, http.ErrServerClosed) {
+		return
+	}
+
+	s.exits <- frontendExit{name: "health", err: errors.Wrap(err, "health listener failed")}
+}
+
+// FrontendNames gives the configured frontends in the order they should be started
+func (s *Supervisor) FrontendNames() []string {
+	return s.cfg.Frontends
+}
@@ -0,0 +1,97 @@
+package slack
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"breathbathChatGPT/pkg/markdown"
+
+	"github.com/pkg/errors"
+	logging "github.com/sirupsen/logrus"
+)
+
+// maxMessageLength keeps messages well below the Slack limit, longer texts are truncated by Slack
+const maxMessageLength = 3900
+
+type apiClient struct {
+	cfg        *Config
+	httpClient *http.Client
+}
+
+func (ac *apiClient) postJSON(ctx context.Context, url string, data interface{}, withToken bool) error {
+	rawBody, err := json.Marshal(data)
+	if err != nil {
+		return errors.Wrap(err, "failed to create slack request body")
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(rawBody))
+	if err != nil {
+		return errors.Wrap(err, "failed to create slack request")
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json; charset=utf-8")
+	if withToken {
+		httpReq.Header.Set("Authorization", "Bearer "+ac.cfg.BotToken)
+	}
+
+	resp, err := ac.httpClient.Do(httpReq)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("slack responded with status %d to %q", resp.StatusCode, url)
+	}
+
+	// response urls of slash commands answer with plain "ok"
+	if !withToken {
+		return nil
+	}
+
+	apiResp := new(APIResponse)
+	err = json.NewDecoder(resp.Body).Decode(apiResp)
+	if err != nil {
+		return errors.Wrapf(err, "failed to decode slack response of %q", url)
+	}
+
+	if !apiResp.OK {
+		return errors.Errorf("slack request to %q failed: %s", url, apiResp.Error)
+	}
+
+	return nil
+}
+
+// postMessage sends the text in parts fitting into one Slack message
+func (ac *apiClient) postMessage(ctx context.Context, channel, threadTS, text string) error {
+	for _, part := range markdown.SplitText(text, maxMessageLength) {
+		err := ac.postJSON(ctx, strings.TrimSuffix(ac.cfg.APIURL, "/")+"/chat.postMessage", &PostMessageRequest{
+			Channel:  channel,
+			Text:     part,
+			ThreadTS: threadTS,
+			Mrkdwn:   true,
+		}, true)
+		if err != nil {
+			return err
+		}
+	}
+
+	logging.WithContext(ctx).Debugf("posted slack message to channel %q thread %q", channel, threadTS)
+
+	return nil
+}
+
+// respondToCommand sends the answer to a slash command which is visible only to the caller
+func (ac *apiClient) respondToCommand(ctx context.Context, responseURL, text string) error {
+	for _, part := range markdown.SplitText(text, maxMessageLength) {
+		err := ac.postJSON(ctx, responseURL, &CommandResponse{ResponseType: "ephemeral", Text: part}, false)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,12 @@
+package slack
+
+import "breathbathChatGPT/pkg/msg"
+
+func BuildServer(r *msg.Router) (*Server, error) {
+	config, err := LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewServer(config, r)
+}
@@ -0,0 +1,73 @@
+package slack
+
+import (
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+	"github.com/pkg/errors"
+
+	"breathbathChatGPT/pkg/errs"
+)
+
+type Config struct {
+	BotToken        string        `envconfig:"SLACK_BOT_TOKEN"`
+	SigningSecret   string        `envconfig:"SLACK_SIGNING_SECRET"`
+	APIURL          string        `envconfig:"SLACK_API_URL" default:"https://slack.com/api"`
+	Listen          string        `envconfig:"SLACK_LISTEN" default:":8082"`
+	TLSCert         string        `envconfig:"SLACK_TLS_CERT"`
+	TLSKey          string        `envconfig:"SLACK_TLS_KEY"`
+	ShutdownTimeout time.Duration `envconfig:"SLACK_SHUTDOWN_TIMEOUT" default:"30s"`
+	SignatureMaxAge time.Duration `envconfig:"SLACK_SIGNATURE_MAX_AGE" default:"5m"`
+	SlashCommand    string        `envconfig:"SLACK_SLASH_COMMAND" default:"/bgpt"`
+	MaxBodySize     int64         `envconfig:"SLACK_MAX_BODY_SIZE" default:"1048576"`
+	HandleTimeout   time.Duration `envconfig:"SLACK_HANDLE_TIMEOUT" default:"10m"`
+}
+
+func (c *Config) Validate() *errs.Multi {
+	e := errs.NewMulti()
+
+	if c.BotToken == "" {
+		e.Errf("SLACK_BOT_TOKEN cannot be empty")
+	}
+
+	if c.SigningSecret == "" {
+		e.Errf("SLACK_SIGNING_SECRET cannot be empty")
+	}
+
+	if c.APIURL == "" {
+		e.Errf("SLACK_API_URL cannot be empty")
+	}
+
+	if c.Listen == "" {
+		e.Errf("SLACK_LISTEN cannot be empty")
+	}
+
+	if (c.TLSCert == "") != (c.TLSKey == "") {
+		e.Errf("SLACK_TLS_CERT and SLACK_TLS_KEY should be set together")
+	}
+
+	if c.SignatureMaxAge <= 0 {
+		e.Errf("SLACK_SIGNATURE_MAX_AGE should be positive, got %v", c.SignatureMaxAge)
+	}
+
+	if c.MaxBodySize <= 0 {
+		e.Errf("SLACK_MAX_BODY_SIZE should be positive, got %d", c.MaxBodySize)
+	}
+
+	if c.HandleTimeout <= 0 {
+		e.Errf("SLACK_HANDLE_TIMEOUT should be positive, got %v", c.HandleTimeout)
+	}
+
+	return e
+}
+
+func LoadConfig() (cfg *Config, err error) {
+	cfg = new(Config)
+
+	err = envconfig.Process("slack", cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load slack config")
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,77 @@
+package slack
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	envelopeURLVerification = "url_verification"
+	envelopeEventCallback   = "event_callback"
+
+	eventMessage    = "message"
+	eventAppMention = "app_mention"
+
+	channelTypeIM = "im"
+)
+
+// Envelope is the outer payload of Events API requests
+type Envelope struct {
+	Type      string          `json:"type"`
+	Challenge string          `json:"challenge"`
+	EventID   string          `json:"event_id"`
+	EventTime int64           `json:"event_time"`
+	Event     json.RawMessage `json:"event"`
+}
+
+type Event struct {
+	Type        string `json:"type"`
+	Subtype     string `json:"subtype"`
+	User        string `json:"user"`
+	BotID       string `json:"bot_id"`
+	Text        string `json:"text"`
+	Channel     string `json:"channel"`
+	ChannelType string `json:"channel_type"`
+	TS          string `json:"ts"`
+	ThreadTS    string `json:"thread_ts"`
+}
+
+// getThreadTS gives the timestamp of the thread root, a message which is not in a thread starts a new one
+func (e *Event) getThreadTS() string {
+	if e.ThreadTS != "" {
+		return e.ThreadTS
+	}
+
+	return e.TS
+}
+
+// getSentAt gives the send time of the message from its timestamp, e.g. "1355517523.000005", the time of arrival if it's invalid
+func (e *Event) getSentAt() time.Time {
+	seconds, _, _ := strings.Cut(e.TS, ".")
+
+	unix, err := strconv.ParseInt(seconds, 10, 64)
+	if err != nil {
+		return time.Now()
+	}
+
+	return time.Unix(unix, 0)
+}
+
+type PostMessageRequest struct {
+	Channel  string `json:"channel"`
+	Text     string `json:"text"`
+	ThreadTS string `json:"thread_ts,omitempty"`
+	Mrkdwn   bool   `json:"mrkdwn"`
+}
+
+type CommandResponse struct {
+	ResponseType string `json:"response_type"`
+	Text         string `json:"text"`
+}
+
+type APIResponse struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error"`
+}
@@ -0,0 +1,114 @@
+package slack
+
+import (
+	"strings"
+
+	"breathbathChatGPT/pkg/markdown"
+	"breathbathChatGPT/pkg/msg"
+)
+
+var (
+	slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+	// a pipe in the link text would end the text of a Slack link
+	linkTextEscaper = strings.NewReplacer("|", "¦")
+)
+
+const horizontalRule = "──────────"
+
+// toMrkdwn converts the response text to Slack mrkdwn, see https://api.slack.com/reference/surfaces/formatting
+func toMrkdwn(text string, format msg.OutputFormat) string {
+	switch format {
+	case msg.OutputFormatMarkdown, msg.OutputFormatMarkdown1, msg.OutputFormatMarkdown2:
+		return markdownToMrkdwn(text)
+	case msg.OutputFormatHTML:
+		return htmlToMrkdwn(text)
+	case msg.OutputFormatUndefined:
+		return slackEscaper.Replace(text)
+	default:
+		return slackEscaper.Replace(text)
+	}
+}
+
+func markdownToMrkdwn(text string) string {
+	return markdown.Render(text, mrkdwnRenderer{})
+}
+
+// mrkdwnRenderer gives the markup of Slack, it has no headings, so they are shown in bold
+type mrkdwnRenderer struct{}
+
+func (mrkdwnRenderer) Text(text string) string {
+	return slackEscaper.Replace(text)
+}
+
+func (mrkdwnRenderer) Bold(text string) string {
+	return "*" + text + "*"
+}
+
+func (mrkdwnRenderer) Italic(text string) string {
+	return "_" + text + "_"
+}
+
+func (mrkdwnRenderer) Strikethrough(text string) string {
+	return "~" + text + "~"
+}
+
+func (mrkdwnRenderer) Code(code string) string {
+	return "`" + slackEscaper.Replace(code) + "`"
+}
+
+func (mrkdwnRenderer) Link(text, url string) string {
+	return "<" + slackEscaper.Replace(url) + "|" + linkTextEscaper.Replace(text) + ">"
+}
+
+// CodeBlock drops the language since Slack doesn't highlight code
+func (mrkdwnRenderer) CodeBlock(code, _ string) string {
+	return "```\n" + slackEscaper.Replace(code) + "\n```"
+}
+
+func (mrkdwnRenderer) Heading(text string, _ int) string {
+	return "*" + text + "*"
+}
+
+func (mrkdwnRenderer) Blockquote(text string) string {
+	return ">" + strings.ReplaceAll(text, "\n", "\n>")
+}
+
+func (mrkdwnRenderer) ThematicBreak() string {
+	return horizontalRule
+}
+
+// htmlToMrkdwn converts the subset of HTML used by the handlers, unknown tags are dropped
+func htmlToMrkdwn(text string) string {
+	return markdown.ConvertHTML(text, htmlConverter{})
+}
+
+// htmlConverter gives the mrkdwn of the tags, Slack needs escaping of the text inside of code as well
+type htmlConverter struct{}
+
+func (htmlConverter) Text(text string, _ bool) string {
+	return slackEscaper.Replace(text)
+}
+
+func (htmlConverter) Tag(tag string, isClosing bool, href string) string {
+	switch tag {
+	case "b", "strong":
+		return "*"
+	case "i", "em":
+		return "_"
+	case "s", "strike", "del":
+		return "~"
+	case "code":
+		return "`"
+	case "pre":
+		return "```"
+	case "br":
+		return "\n"
+	case "a":
+		if isClosing {
+			return ">"
+		}
+		return "<" + slackEscaper.Replace(href) + "|"
+	default:
+		return ""
+	}
+}
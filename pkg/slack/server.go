@@ -0,0 +1,418 @@
+package slack
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"breathbathChatGPT/pkg/msg"
+
+	"github.com/pkg/errors"
+	logging "github.com/sirupsen/logrus"
+)
+
+const (
+	Platform = "slack"
+
+	EventsPath   = "/slack/events"
+	CommandsPath = "/slack/commands"
+
+	readHeaderTimeout = time.Second * 10
+	retryNumHeader    = "X-Slack-Retry-Num"
+	seenEventValidity = time.Hour
+)
+
+var mentionRegex = regexp.MustCompile(`<@[A-Z0-9]+>`)
+
+// Server receives Events API callbacks and slash commands, requests are acknowledged at once
+// and handled in the background since Slack waits only 3 seconds for an answer
+type Server struct {
+	cfg        *Config
+	msgHandler *msg.Router
+	api        *apiClient
+	server     *http.Server
+	inFlight   sync.WaitGroup
+
+	mu         sync.Mutex
+	seenEvents map[string]time.Time
+}
+
+func NewServer(cfg *Config, r *msg.Router) (*Server, error) {
+	e := cfg.Validate()
+	if e.HasErrors() {
+		return nil, e
+	}
+
+	s := &Server{
+		cfg:        cfg,
+		msgHandler: r,
+		api:        &apiClient{cfg: cfg, httpClient: &http.Client{Timeout: time.Second * 30}},
+		seenEvents: map[string]time.Time{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(EventsPath, s.handleEvents)
+	mux.HandleFunc(CommandsPath, s.handleCommands)
+
+	s.server = &http.Server{
+		Addr:              cfg.Listen,
+		Handler:           mux,
+		ReadHeaderTimeout: readHeaderTimeout,
+	}
+
+	return s, nil
+}
+
+func (s *Server) Start() error {
+	logging.Infof("will listen for slack requests on %q", s.cfg.Listen)
+
+	var err error
+	if s.cfg.TLSCert != "" {
+		err = s.server.ListenAndServeTLS(s.cfg.TLSCert, s.cfg.TLSKey)
+	} else {
+		err = s.server.ListenAndServe()
+	}
+
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+
+	return errors.Wrap(err, "slack listener failed")
+}
+
+// Stop stops accepting requests and waits for the acknowledged ones till the shutdown timeout
+func (s *Server) Stop() {
+	logging.Info("will stop slack server")
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.ShutdownTimeout)
+	defer cancel()
+
+	err := s.server.Shutdown(ctx)
+	if err != nil {
+		logging.Errorf("failed to shutdown slack server gracefully: %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.inFlight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		logging.Info("stopped slack server")
+	case <-ctx.Done():
+		logging.Warnf("stopped waiting for in-flight slack requests after %v", s.cfg.ShutdownTimeout)
+	}
+}
+
+// readVerifiedBody gives the request body if it's signed by Slack, otherwise it answers with an error
+func (s *Server) readVerifiedBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return nil, false
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, s.cfg.MaxBodySize))
+	if err != nil {
+		logging.Errorf("failed to read slack request: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, false
+	}
+
+	err = verifySignature(
+		s.cfg.SigningSecret,
+		s.cfg.SignatureMaxAge,
+		r.Header.Get(timestampHeader),
+		r.Header.Get(signatureHeader),
+		body,
+	)
+	if err != nil {
+		logging.Warnf("rejected slack request from %q: %v", r.RemoteAddr, err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return nil, false
+	}
+
+	return body, true
+}
+
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	body, ok := s.readVerifiedBody(w, r)
+	if !ok {
+		return
+	}
+
+	envelope := new(Envelope)
+	err := json.Unmarshal(body, envelope)
+	if err != nil {
+		logging.Errorf("failed to decode slack event: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	switch envelope.Type {
+	case envelopeURLVerification:
+		w.Header().Set("Content-Type", "text/plain")
+		_, err = io.WriteString(w, envelope.Challenge)
+		if err != nil {
+			logging.Errorf("failed to answer slack url verification: %v", err)
+		}
+		return
+	case envelopeEventCallback:
+	default:
+		logging.Debugf("ignored slack request of type %q", envelope.Type)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	if !s.markEventSeen(envelope.EventID) {
+		logging.Debugf("ignored slack event %q delivered again, retry %q", envelope.EventID, r.Header.Get(retryNumHeader))
+		return
+	}
+
+	event := new(Event)
+	err = json.Unmarshal(envelope.Event, event)
+	if err != nil {
+		logging.Errorf("failed to decode slack event %q: %v", envelope.EventID, err)
+		return
+	}
+
+	if !s.isEventToHandle(event) {
+		return
+	}
+
+	s.inFlight.Add(1)
+	go func() {
+		defer s.inFlight.Done()
+		s.handleEvent(event)
+	}()
+}
+
+// markEventSeen gives false if the event was received before, Slack retries events which were not acknowledged in time
+func (s *Server) markEventSeen(eventID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for id, seenAt := range s.seenEvents {
+		if seenAt.Add(seenEventValidity).Before(now) {
+			delete(s.seenEvents, id)
+		}
+	}
+
+	if _, ok := s.seenEvents[eventID]; ok {
+		return false
+	}
+	s.seenEvents[eventID] = now
+
+	return true
+}
+
+// isEventToHandle accepts direct messages and mentions of the bot in channels, messages of bots and
+// changes of messages are ignored
+func (s *Server) isEventToHandle(event *Event) bool {
+	if event.BotID != "" || event.Subtype != "" || event.User == "" {
+		return false
+	}
+
+	switch event.Type {
+	case eventAppMention:
+		return true
+	case eventMessage:
+		return event.ChannelType == channelTypeIM
+	default:
+		return false
+	}
+}
+
+func (s *Server) eventToRequest(event *Event) *msg.Request {
+	text := mentionRegex.ReplaceAllString(event.Text, "")
+
+	return &msg.Request{
+		Platform: Platform,
+		ID:       event.TS,
+		Sender: &msg.Sender{
+			ID: event.User,
+		},
+		Message: strings.TrimSpace(html.UnescapeString(text)),
+		Meta: map[string]interface{}{
+			"conversation_id": event.Channel,
+			"timestamp":       event.getSentAt().Unix(),
+			// mentions in channels are seen by all members, only direct messages are private
+			"is_group_chat": event.ChannelType != channelTypeIM,
+		},
+	}
+}
+
+// buildNotifier posts notices to the thread of the event before the response is ready
+func (s *Server) buildNotifier(event *Event) msg.Notifier {
+	return func(ctx context.Context, text string) {
+		err := s.api.postMessage(ctx, event.Channel, event.getThreadTS(), text)
+		if err != nil {
+			logging.WithContext(ctx).Errorf("failed to post slack notice: %v", err)
+		}
+	}
+}
+
+func (s *Server) handleEvent(event *Event) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.HandleTimeout)
+	defer cancel()
+
+	log := logging.WithContext(ctx)
+
+	req := s.eventToRequest(event)
+	log.Debugf("got slack message: %q", req.Message)
+
+	resp, err := s.msgHandler.Route(msg.WithNotifier(ctx, s.buildNotifier(event)), req)
+	if err != nil {
+		log.Errorf("failed to handle slack message: %v", err)
+		resp = &msg.Response{Message: "Unexpected error", Type: msg.Error}
+	}
+
+	if resp != nil && resp.Options.IsResponseToHiddenMessage() {
+		log.Warnf("slack message %q contains sensitive data, but bots cannot delete messages of users", event.TS)
+	}
+
+	text := s.buildText(resp)
+	if text == "" {
+		log.Info("response message is empty, will send nothing to the sender")
+		return
+	}
+
+	err = s.api.postMessage(ctx, event.Channel, event.getThreadTS(), text)
+	if err != nil {
+		log.Errorf("failed to post slack message: %v", err)
+	}
+}
+
+// handleCommands accepts slash commands, the configured bot command passes its text to the router as is,
+// e.g. "/bgpt /model gpt-4", other commands are routed together with their text, e.g. "/model gpt-4"
+func (s *Server) handleCommands(w http.ResponseWriter, r *http.Request) {
+	body, ok := s.readVerifiedBody(w, r)
+	if !ok {
+		return
+	}
+
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		logging.Errorf("failed to decode slack command: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	req := s.commandToRequest(form)
+	responseURL := form.Get("response_url")
+
+	w.WriteHeader(http.StatusOK)
+
+	s.inFlight.Add(1)
+	go func() {
+		defer s.inFlight.Done()
+		s.handleCommand(req, responseURL)
+	}()
+}
+
+func (s *Server) commandToRequest(form url.Values) *msg.Request {
+	command := form.Get("command")
+	text := strings.TrimSpace(form.Get("text"))
+
+	message := strings.TrimSpace(command + " " + text)
+	if strings.EqualFold(command, s.cfg.SlashCommand) {
+		message = text
+		if message == "" {
+			message = "/help"
+		}
+	}
+
+	return &msg.Request{
+		Platform: Platform,
+		ID:       form.Get("trigger_id"),
+		Sender: &msg.Sender{
+			ID:    form.Get("user_id"),
+			Alias: form.Get("user_name"),
+		},
+		Message: message,
+		Meta: map[string]interface{}{
+			"conversation_id": form.Get("channel_id"),
+			// slash commands carry no send time, they are delivered at once
+			"timestamp": time.Now().Unix(),
+		},
+	}
+}
+
+func (s *Server) handleCommand(req *msg.Request, responseURL string) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.HandleTimeout)
+	defer cancel()
+
+	log := logging.WithContext(ctx)
+
+	resp, err := s.msgHandler.Route(ctx, req)
+	if err != nil {
+		log.Errorf("failed to handle slack command: %v", err)
+		resp = &msg.Response{Message: "Unexpected error", Type: msg.Error}
+	}
+
+	text := s.buildText(resp)
+	if text == "" || responseURL == "" {
+		return
+	}
+
+	err = s.api.respondToCommand(ctx, responseURL, text)
+	if err != nil {
+		log.Errorf("failed to respond to slack command: %v", err)
+	}
+}
+
+// buildText converts the response to mrkdwn, buttons are listed as commands to type since Slack
+// needs an interactivity endpoint for them, attachments are given as links
+func (s *Server) buildText(resp *msg.Response) string {
+	if resp == nil {
+		return ""
+	}
+
+	lines := []string{}
+	if resp.Message != "" {
+		text := toMrkdwn(resp.Message, resp.Options.GetFormat())
+		if resp.Type == msg.Error {
+			text = "❗" + text + "❗"
+		}
+		lines = append(lines, text)
+	}
+
+	for _, row := range resp.Options.GetInlineButtons() {
+		for _, b := range row {
+			switch {
+			case b.URL != "":
+				lines = append(lines, fmt.Sprintf("• <%s|%s>", slackEscaper.Replace(b.URL), slackEscaper.Replace(b.Text)))
+			case b.Data != "":
+				lines = append(lines, "• `"+slackEscaper.Replace(b.Data)+"`")
+			}
+		}
+	}
+
+	for _, predefinedResp := range resp.Options.GetPredefinedResponses() {
+		if predefinedResp != "" {
+			lines = append(lines, "• `"+slackEscaper.Replace(string(predefinedResp))+"`")
+		}
+	}
+
+	for _, a := range resp.Attachments {
+		if a.URL == "" {
+			logging.Warnf("attachment %q has no url, it cannot be sent to slack", a.FileName)
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("<%s|%s>", slackEscaper.Replace(a.URL), slackEscaper.Replace(a.FileName)))
+	}
+
+	return strings.Join(lines, "\n")
+}
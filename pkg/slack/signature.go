@@ -0,0 +1,42 @@
+package slack
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	signatureHeader = "X-Slack-Signature"
+	timestampHeader = "X-Slack-Request-Timestamp"
+	signatureVer    = "v0"
+)
+
+// verifySignature checks that the request is signed with the signing secret of the app and is not replayed,
+// see https://api.slack.com/authentication/verifying-requests-from-slack
+func verifySignature(signingSecret string, maxAge time.Duration, timestamp, signature string, body []byte) error {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.Errorf("invalid request timestamp %q", timestamp)
+	}
+
+	age := time.Since(time.Unix(ts, 0))
+	if age > maxAge || age < -maxAge {
+		return errors.Errorf("request timestamp %q is outside of the allowed %v", timestamp, maxAge)
+	}
+
+	mac := hmac.New(sha256.New, []byte(signingSecret))
+	mac.Write([]byte(signatureVer + ":" + timestamp + ":"))
+	mac.Write(body)
+	expectedSignature := signatureVer + "=" + hex.EncodeToString(mac.Sum(nil))
+
+	if !hmac.Equal([]byte(expectedSignature), []byte(signature)) {
+		return errors.New("invalid request signature")
+	}
+
+	return nil
+}
@@ -13,3 +13,8 @@ type Client interface {
 	Save(ctx context.Context, key string, data interface{}, validity time.Duration) error
 	FindKeys(ctx context.Context, pattern string) (keys []string, err error)
 }
+
+// ScriptRunner executes Lua scripts atomically, it's needed for state which is changed by several bot instances at once
+type ScriptRunner interface {
+	RunScript(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error)
+}
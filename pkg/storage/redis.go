@@ -95,6 +95,16 @@ func checkRedis(cl *base.Client) error {
 	return nil
 }
 
+// Ping checks if redis is reachable
+func (c *RedisClient) Ping(ctx context.Context) error {
+	err := c.baseClient.Ping(ctx).Err()
+	if err != nil {
+		return errors.Wrap(err, "failed to ping redis")
+	}
+
+	return nil
+}
+
 func (c *RedisClient) Read(ctx context.Context, key string) (raw []byte, found bool, err error) {
 	log := logrus.WithContext(ctx)
 
@@ -185,3 +195,13 @@ func (c *RedisClient) FindKeys(ctx context.Context, pattern string) (keys []stri
 
 	return val.Val(), nil
 }
+
+// RunScript runs the script by its hash and loads it to redis only if it's not cached there yet
+func (c *RedisClient) RunScript(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+	res, err := base.NewScript(script).Run(ctx, c.baseClient, keys, args...).Result()
+	if err != nil && !errors.Is(err, base.Nil) {
+		return nil, errors.Wrapf(err, "failed to run redis script on keys %v", keys)
+	}
+
+	return res, nil
+}
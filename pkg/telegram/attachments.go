@@ -0,0 +1,136 @@
+package telegram
+
+import (
+	"bytes"
+	"context"
+
+	"breathbathChatGPT/pkg/msg"
+
+	"github.com/pkg/errors"
+	logging "github.com/sirupsen/logrus"
+	"gopkg.in/telebot.v3"
+)
+
+// maxAlbumSize is the limit of media items in one Telegram media group
+const maxAlbumSize = 10
+
+func (b *Bot) attachmentToFile(a *msg.Attachment) telebot.File {
+	if a.URL != "" {
+		return telebot.FromURL(a.URL)
+	}
+
+	return telebot.FromReader(bytes.NewReader(a.Data))
+}
+
+func (b *Bot) attachmentToMedia(a *msg.Attachment) (interface{}, error) {
+	if a.URL == "" && len(a.Data) == 0 {
+		return nil, errors.Errorf("attachment %q has neither data nor url", a.FileName)
+	}
+
+	file := b.attachmentToFile(a)
+
+	switch a.Type {
+	case msg.AttachmentPhoto:
+		return &telebot.Photo{File: file, Caption: a.Caption}, nil
+	case msg.AttachmentDocument:
+		return &telebot.Document{File: file, Caption: a.Caption, MIME: a.MIMEType, FileName: a.FileName}, nil
+	case msg.AttachmentAudio:
+		return &telebot.Audio{File: file, Caption: a.Caption, MIME: a.MIMEType, FileName: a.FileName}, nil
+	case msg.AttachmentVoice:
+		return &telebot.Voice{File: file, Caption: a.Caption, MIME: a.MIMEType}, nil
+	case msg.AttachmentUndefined:
+		return nil, errors.Errorf("undefined type of attachment %q", a.FileName)
+	default:
+		return nil, errors.Errorf("unsupported type %d of attachment %q", a.Type, a.FileName)
+	}
+}
+
+// groupAttachments splits attachments into groups which can be sent as one album,
+// Telegram allows only items of the same kind in a media group and doesn't support voice albums
+func (b *Bot) groupAttachments(attachments []msg.Attachment) [][]msg.Attachment {
+	groups := [][]msg.Attachment{}
+
+	for i := range attachments {
+		lastIndex := len(groups) - 1
+		if lastIndex >= 0 {
+			lastGroup := groups[lastIndex]
+			if attachments[i].Type != msg.AttachmentVoice &&
+				lastGroup[0].Type == attachments[i].Type &&
+				len(lastGroup) < maxAlbumSize {
+				groups[lastIndex] = append(lastGroup, attachments[i])
+				continue
+			}
+		}
+
+		groups = append(groups, []msg.Attachment{attachments[i]})
+	}
+
+	return groups
+}
+
+func (b *Bot) sendAttachments(
+	ctx context.Context,
+	recipient telebot.Recipient,
+	attachments []msg.Attachment,
+	senderOpts *telebot.SendOptions,
+) error {
+	log := logging.WithContext(ctx)
+
+	for _, group := range b.groupAttachments(attachments) {
+		notifyErr := b.baseBot.Notify(recipient, activityToChatAction(attachmentToActivity(group[0].Type)))
+		if notifyErr != nil {
+			log.Warnf("failed to send telegram chat action: %v", notifyErr)
+		}
+
+		if len(group) == 1 {
+			media, err := b.attachmentToMedia(&group[0])
+			if err != nil {
+				return err
+			}
+
+			_, err = b.baseBot.Send(recipient, media, senderOpts)
+			if err != nil {
+				return errors.Wrapf(err, "failed to send attachment %q", group[0].FileName)
+			}
+
+			log.Debugf("sent attachment %q", group[0].FileName)
+			continue
+		}
+
+		album := make(telebot.Album, 0, len(group))
+		for i := range group {
+			media, err := b.attachmentToMedia(&group[i])
+			if err != nil {
+				return err
+			}
+
+			albumItem, ok := media.(telebot.Inputtable)
+			if !ok {
+				return errors.Errorf("attachment %q cannot be sent as a part of album", group[i].FileName)
+			}
+			album = append(album, albumItem)
+		}
+
+		_, err := b.baseBot.SendAlbum(recipient, album, &telebot.SendOptions{ParseMode: senderOpts.ParseMode})
+		if err != nil {
+			return errors.Wrapf(err, "failed to send album of %d attachments", len(album))
+		}
+
+		log.Debugf("sent album of %d attachments", len(album))
+	}
+
+	return nil
+}
+
+func attachmentToActivity(attachmentType msg.AttachmentType) msg.Activity {
+	switch attachmentType {
+	case msg.AttachmentPhoto:
+		return msg.ActivityUploadingPhoto
+	case msg.AttachmentAudio, msg.AttachmentVoice:
+		return msg.ActivityUploadingAudio
+	case msg.AttachmentDocument, msg.AttachmentUndefined:
+		return msg.ActivityUploadingDocument
+	default:
+		return msg.ActivityUploadingDocument
+	}
+}
@@ -3,29 +3,58 @@ package telegram
 import (
 	"context"
 	"fmt"
+	"strings"
+	"sync"
+	"time"
 
 	"breathbathChatGPT/pkg/errs"
 	"breathbathChatGPT/pkg/msg"
+	"breathbathChatGPT/pkg/storage"
 
 	"github.com/pkg/errors"
 	logging "github.com/sirupsen/logrus"
 	"gopkg.in/telebot.v3"
 )
 
+const longPollingTimeout = time.Second * 10
+
 type Bot struct {
-	conf       *Config
-	baseBot    *telebot.Bot
-	msgHandler *msg.Router
+	conf            *Config
+	baseBot         *telebot.Bot
+	msgHandler      *msg.Router
+	inFlight        sync.WaitGroup
+	inlineDebouncer *inlineDebouncer
+	menu            *commandMenu
+	replies         *replyTracker
+	pollErrs        <-chan error
+	stopOnce        sync.Once
 }
 
-func NewBot(c *Config, r *msg.Router) (*Bot, error) {
+func NewBot(c *Config, r *msg.Router, db storage.Client, adminDetector func(req *msg.Request) bool) (*Bot, error) {
 	validationErr := c.Validate()
 	if validationErr.HasErrors() {
 		return nil, validationErr
 	}
 
+	var poller telebot.Poller = &telebot.LongPoller{Timeout: longPollingTimeout}
+	var pollErrs <-chan error
+	if c.Mode == ModeWebhook {
+		wp := newWebhookPoller(c)
+		poller, pollErrs = wp, wp.errs
+	}
+
+	b := &Bot{
+		conf:            c,
+		msgHandler:      r,
+		inlineDebouncer: newInlineDebouncer(),
+		replies:         newReplyTracker(db),
+		pollErrs:        pollErrs,
+	}
+
 	botAPI, err := telebot.NewBot(telebot.Settings{
-		Token: c.APIToken,
+		Token:       c.APIToken,
+		Poller:      &dispatchingPoller{poller: poller, inFlight: &b.inFlight},
+		Synchronous: true,
 		OnError: func(err error, c telebot.Context) {
 			errs.Handle(err, false)
 		},
@@ -34,22 +63,16 @@ func NewBot(c *Config, r *msg.Router) (*Bot, error) {
 		return nil, errors.Wrap(err, "failed to create telegram bot")
 	}
 
-	return &Bot{conf: c, baseBot: botAPI, msgHandler: r}, nil
+	b.baseBot = botAPI
+	b.menu = newCommandMenu(botAPI, r, db, adminDetector)
+	// role changes made in other frontends of the process update the menus as well
+	r.OnUserChange(b.menu.SyncUser)
+
+	return b, nil
 }
 
 func (b *Bot) botMsgToRequest(telegramMsg telebot.Context) *msg.Request {
-	sender := new(msg.Sender)
-	telegramSender := telegramMsg.Sender()
-	if telegramSender != nil {
-		id := telegramSender.Username
-		if id == "" {
-			id = fmt.Sprint(telegramSender.ID)
-		}
-
-		sender.ID = id
-		sender.LastName = telegramSender.LastName
-		sender.FirstName = telegramSender.FirstName
-	}
+	sender := userToSender(telegramMsg.Sender())
 
 	var conversationID int64
 	chat := telegramMsg.Chat()
@@ -57,26 +80,85 @@ func (b *Bot) botMsgToRequest(telegramMsg telebot.Context) *msg.Request {
 		conversationID = chat.ID
 	}
 
+	if callback := telegramMsg.Callback(); callback != nil {
+		req := b.callbackToRequest(callback, sender, conversationID)
+		req.Meta["is_shared_conversation"] = isGroupChat(chat) && b.conf.GroupConversationMode == GroupConversationShared
+		req.Meta["is_group_chat"] = isGroupChat(chat)
+
+		return req
+	}
+
+	text := telegramMsg.Text()
+	isGroup := isGroupChat(chat)
+	if isGroup {
+		text = b.stripBotName(text)
+	}
+
 	return &msg.Request{
 		Platform: "telegram",
 		ID:       fmt.Sprint(telegramMsg.Message().ID),
 		Sender:   sender,
-		Message:  telegramMsg.Text(),
+		Message:  text,
 		Meta: map[string]interface{}{
-			"payload":         telegramMsg.Message().Payload,
-			"timestamp":       telegramMsg.Message().Unixtime,
-			"conversation_id": conversationID,
+			"payload":                telegramMsg.Message().Payload,
+			"timestamp":              telegramMsg.Message().Unixtime,
+			"conversation_id":        conversationID,
+			"is_shared_conversation": isGroup && b.conf.GroupConversationMode == GroupConversationShared,
+			"is_group_chat":          isGroup,
+			"is_edited":              isEditedMessage(telegramMsg),
 		},
 	}
 }
 
+// userToSender identifies users by the immutable numeric id, the user name can be changed so it's only an alias
+func userToSender(user *telebot.User) *msg.Sender {
+	sender := new(msg.Sender)
+	if user == nil {
+		return sender
+	}
+
+	sender.ID = fmt.Sprint(user.ID)
+	sender.Alias = user.Username
+	sender.LastName = user.LastName
+	sender.FirstName = user.FirstName
+
+	return sender
+}
+
+// callbackToRequest passes the data of the pressed inline button as the message text, so it can be routed like a command
+func (b *Bot) callbackToRequest(callback *telebot.Callback, sender *msg.Sender, conversationID int64) *msg.Request {
+	meta := map[string]interface{}{
+		"conversation_id": conversationID,
+		"callback_data":   callback.Data,
+		"callback_id":     callback.ID,
+		// the button is pressed now, the message with it could be sent long before
+		"timestamp": time.Now().Unix(),
+	}
+
+	if callback.Message != nil {
+		meta["callback_message_id"] = callback.Message.ID
+	}
+
+	return &msg.Request{
+		Platform: "telegram",
+		ID:       callback.ID,
+		Sender:   sender,
+		Message:  callback.Data,
+		Meta:     meta,
+	}
+}
+
 func (b *Bot) guessParseMode(resp *msg.Response) telebot.ParseMode {
-	switch resp.Options.GetFormat() {
+	return formatToParseMode(resp.Options.GetFormat())
+}
+
+func formatToParseMode(format msg.OutputFormat) telebot.ParseMode {
+	switch format {
 	case msg.OutputFormatMarkdown1:
 		return telebot.ModeMarkdown
 	case msg.OutputFormatMarkdown2:
 		return telebot.ModeMarkdownV2
-	case msg.OutputFormatHTML:
+	case msg.OutputFormatHTML, msg.OutputFormatMarkdown:
 		return telebot.ModeHTML
 	case msg.OutputFormatUndefined:
 		return telebot.ModeDefault
@@ -93,9 +175,23 @@ func (b *Bot) sendMessageSuccess(
 ) error {
 	log := logging.WithContext(ctx)
 
-	_, err := b.baseBot.Send(telegramMsg.Sender(), resp.Message, senderOpts)
+	if resp.Message != "" {
+		sent, err := b.sendText(
+			b.getRecipient(telegramMsg),
+			b.getEditables(ctx, telegramMsg, resp),
+			resp.Message,
+			resp.Options.GetFormat(),
+			senderOpts,
+		)
+		b.replies.track(ctx, telegramMsg.Message(), sent)
+		if err != nil {
+			return errors.Wrap(err, "failed to send success message")
+		}
+	}
+
+	err := b.sendAttachments(ctx, b.getRecipient(telegramMsg), resp.Attachments, b.getAttachmentSenderOptions(resp, senderOpts))
 	if err != nil {
-		return errors.Wrapf(err, "failed to send success message:\n%s", resp.Message)
+		return err
 	}
 
 	if resp.Options.IsResponseToHiddenMessage() {
@@ -111,24 +207,149 @@ func (b *Bot) sendMessageSuccess(
 	return nil
 }
 
-func (b *Bot) processResponseMessage(
-	ctx context.Context,
-	telegramMsg telebot.Context,
-	resp *msg.Response,
-) error {
-	log := logging.WithContext(ctx)
+// sendText sends text in parts fitting into the Telegram message limit, reply markup is attached to the last part only,
+// the given editable messages are replaced with the parts in their order and the remaining ones are deleted
+func (b *Bot) sendText(
+	recipient telebot.Recipient,
+	editables []telebot.Editable,
+	text string,
+	format msg.OutputFormat,
+	senderOpts *telebot.SendOptions,
+) (sent []*telebot.Message, err error) {
+	if format == msg.OutputFormatMarkdown {
+		text = renderMarkdownToHTML(text)
+		format = msg.OutputFormatHTML
+	}
 
-	if resp == nil || resp.Message == "" {
-		log.Info("response message is empty, will send nothing to the sender")
+	parts := splitMessage(text, format)
+	for i, part := range parts {
+		partOpts := senderOpts
+		if i < len(parts)-1 {
+			partOpts = &telebot.SendOptions{ParseMode: senderOpts.ParseMode}
+		}
+
+		deliver := func(text string, opts *telebot.SendOptions) (*telebot.Message, error) {
+			return b.baseBot.Send(recipient, text, opts)
+		}
+		if i < len(editables) {
+			editable := editables[i]
+			deliver = func(text string, opts *telebot.SendOptions) (*telebot.Message, error) {
+				return b.baseBot.Edit(editable, text, b.getEditOptions(opts))
+			}
+		}
+
+		m, err := b.sendFormattedText(deliver, part, format, partOpts)
+		if err != nil {
+			return sent, errors.Wrapf(err, "failed to send part %d of %d", i+1, len(parts))
+		}
+
+		if m != nil {
+			sent = append(sent, m)
+		}
+	}
+
+	for i := len(parts); i < len(editables); i++ {
+		err := b.baseBot.Delete(editables[i])
+		if err != nil {
+			logging.Warnf("failed to delete outdated telegram message: %v", err)
+		}
+	}
+
+	return sent, nil
+}
+
+// sendFormattedText falls back to plain text if Telegram fails to parse the formatting entities
+func (b *Bot) sendFormattedText(
+	deliver func(text string, opts *telebot.SendOptions) (*telebot.Message, error),
+	text string,
+	format msg.OutputFormat,
+	senderOpts *telebot.SendOptions,
+) (*telebot.Message, error) {
+	m, err := deliver(text, senderOpts)
+	if err == nil || senderOpts.ParseMode == telebot.ModeDefault || !isParseEntitiesError(err) {
+		return m, err
+	}
+
+	logging.Warnf("telegram failed to parse formatted message, will send it as plain text: %v", err)
+
+	plainText := text
+	if format == msg.OutputFormatHTML {
+		plainText = htmlToPlainText(text)
+	}
+
+	plainOpts := *senderOpts
+	plainOpts.ParseMode = telebot.ModeDefault
+
+	return deliver(plainText, &plainOpts)
+}
+
+// getEditOptions drops the reply keyboard as Telegram allows only inline keyboards in edited messages
+func (b *Bot) getEditOptions(senderOpts *telebot.SendOptions) *telebot.SendOptions {
+	if senderOpts.ReplyMarkup == nil || len(senderOpts.ReplyMarkup.InlineKeyboard) > 0 {
+		return senderOpts
+	}
+
+	editOpts := *senderOpts
+	editOpts.ReplyMarkup = nil
+
+	return &editOpts
+}
+
+// getEditables gives the message with the pressed inline button or the previous reply to an edited message
+// if the response should replace it
+func (b *Bot) getEditables(ctx context.Context, telegramMsg telebot.Context, resp *msg.Response) []telebot.Editable {
+	if !resp.Options.IsEditOriginalMessage() {
 		return nil
 	}
 
-	senderOpts := &telebot.SendOptions{
-		ParseMode: b.guessParseMode(resp),
+	if callback := telegramMsg.Callback(); callback != nil {
+		return []telebot.Editable{callback}
 	}
 
-	log.Debugf("telegram sender options: %+v", senderOpts)
-	log.Debugf("telegram message:\n%q", resp.Message)
+	if isEditedMessage(telegramMsg) {
+		return b.replies.get(ctx, telegramMsg.Message())
+	}
+
+	return nil
+}
+
+func (b *Bot) answerCallback(ctx context.Context, telegramMsg telebot.Context, resp *msg.Response) {
+	if telegramMsg.Callback() == nil {
+		return
+	}
+
+	callbackResp := &telebot.CallbackResponse{}
+	if resp == nil {
+		resp = &msg.Response{}
+	}
+	if answer := resp.Options.GetCallbackAnswer(); answer != nil {
+		callbackResp.Text = answer.Text
+		callbackResp.ShowAlert = answer.ShowAlert
+	}
+
+	err := telegramMsg.Respond(callbackResp)
+	if err != nil {
+		logging.WithContext(ctx).Errorf("failed to answer telegram callback: %v", err)
+	}
+}
+
+func (b *Bot) buildReplyMarkup(resp *msg.Response) *telebot.ReplyMarkup {
+	inlineKeyboard := make([][]telebot.InlineButton, 0)
+	for _, row := range resp.Options.GetInlineButtons() {
+		inlineRow := make([]telebot.InlineButton, 0, len(row))
+		for _, button := range row {
+			inlineRow = append(inlineRow, telebot.InlineButton{
+				Text: button.Text,
+				Data: button.Data,
+				URL:  button.URL,
+			})
+		}
+		inlineKeyboard = append(inlineKeyboard, inlineRow)
+	}
+
+	if len(inlineKeyboard) > 0 {
+		return &telebot.ReplyMarkup{InlineKeyboard: inlineKeyboard}
+	}
 
 	replyButtons := make([]telebot.ReplyButton, 0)
 	for _, predefinedResp := range resp.Options.GetPredefinedResponses() {
@@ -140,28 +361,73 @@ func (b *Bot) processResponseMessage(
 		})
 	}
 
-	if len(replyButtons) > 0 {
-		rm := &telebot.ReplyMarkup{
-			OneTimeKeyboard: resp.Options.IsTempPredefinedResponse(),
-			ReplyKeyboard: [][]telebot.ReplyButton{
-				replyButtons,
-			},
-			ResizeKeyboard: true,
-		}
-		senderOpts.ReplyMarkup = rm
+	if len(replyButtons) == 0 {
+		return nil
 	}
 
+	return &telebot.ReplyMarkup{
+		OneTimeKeyboard: resp.Options.IsTempPredefinedResponse(),
+		ReplyKeyboard: [][]telebot.ReplyButton{
+			replyButtons,
+		},
+		ResizeKeyboard: true,
+	}
+}
+
+func isParseEntitiesError(err error) bool {
+	return strings.Contains(strings.ToLower(err.Error()), "can't parse entities")
+}
+
+// getAttachmentSenderOptions gives reply markup to attachments only if there is no text message to carry it
+func (b *Bot) getAttachmentSenderOptions(resp *msg.Response, senderOpts *telebot.SendOptions) *telebot.SendOptions {
+	if resp.Message == "" {
+		return senderOpts
+	}
+
+	return &telebot.SendOptions{ParseMode: senderOpts.ParseMode}
+}
+
+func (b *Bot) processResponseMessage(
+	ctx context.Context,
+	telegramMsg telebot.Context,
+	resp *msg.Response,
+) error {
+	log := logging.WithContext(ctx)
+
+	if resp == nil || (resp.Message == "" && len(resp.Attachments) == 0) {
+		log.Info("response message is empty, will send nothing to the sender")
+		return nil
+	}
+
+	senderOpts := &telebot.SendOptions{
+		ParseMode: b.guessParseMode(resp),
+		ReplyTo:   b.getReplyTo(telegramMsg),
+	}
+
+	log.Debugf("telegram sender options: %+v", senderOpts)
+	if !resp.Options.IsSensitive() {
+		log.Debugf("telegram message:\n%q", resp.Message)
+	}
+
+	senderOpts.ReplyMarkup = b.buildReplyMarkup(resp)
+
 	var err error
 	switch resp.Type {
 	case msg.Error:
-		_, err = b.baseBot.Send(
-			telegramMsg.Sender(),
+		var sent []*telebot.Message
+		sent, err = b.sendText(
+			b.getRecipient(telegramMsg),
+			b.getEditables(ctx, telegramMsg, resp),
 			`❗`+resp.Message+`❗`,
+			resp.Options.GetFormat(),
 			senderOpts,
 		)
+		if resp.Options.IsEditOriginalMessage() {
+			b.replies.track(ctx, telegramMsg.Message(), sent)
+		}
 
 		if err != nil {
-			return errors.Wrapf(err, "failed to send error message: %s", resp.Message)
+			return errors.Wrap(err, "failed to send error message")
 		}
 	case msg.Success:
 		return b.sendMessageSuccess(ctx, telegramMsg, resp, senderOpts)
@@ -181,9 +447,18 @@ func (b *Bot) handle(ctx context.Context, c telebot.Context) error {
 
 	req := b.botMsgToRequest(c)
 
-	resp, err := b.msgHandler.Route(ctx, req)
+	indicator := newProgressIndicator(b.baseBot, b.getRecipient(c))
+	defer indicator.Stop()
+
+	routeCtx := msg.WithNotifier(msg.WithProgressReporter(ctx, indicator.Report), b.buildNotifier(c))
+	resp, err := b.msgHandler.Route(routeCtx, req)
+	indicator.Stop()
+
+	b.menu.Sync(ctx, c, req)
+
+	b.answerCallback(ctx, c, resp)
 	if err != nil {
-		_, sendErr := b.baseBot.Send(c.Sender(), "Unexpected error", &telebot.SendOptions{})
+		_, sendErr := b.baseBot.Send(b.getRecipient(c), "Unexpected error", &telebot.SendOptions{ReplyTo: b.getReplyTo(c)})
 		if sendErr != nil {
 			log.Errorf("failed to send error message to the sender: %v", sendErr)
 		}
@@ -199,28 +474,107 @@ func (b *Bot) handle(ctx context.Context, c telebot.Context) error {
 	return nil
 }
 
-func (b *Bot) Start() {
+// buildNotifier sends notices to the chat of the update before the response is ready
+func (b *Bot) buildNotifier(c telebot.Context) msg.Notifier {
+	return func(ctx context.Context, text string) {
+		_, err := b.baseBot.Send(b.getRecipient(c), text, &telebot.SendOptions{ReplyTo: b.getReplyTo(c)})
+		if err != nil {
+			logging.WithContext(ctx).Errorf("failed to send notice to the sender: %v", err)
+		}
+	}
+}
+
+// Start blocks till the bot is stopped or receiving updates fails, e.g. if the webhook cannot be registered
+func (b *Bot) Start() error {
+	b.baseBot.Use(b.recoverPanics)
+
 	b.baseBot.Handle(telebot.OnText, func(c telebot.Context) error {
-		ctx, cancel := context.WithCancel(context.Background())
+		if !b.isAddressedToBot(c) {
+			return nil
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), b.conf.HandleTimeout)
+		defer cancel()
+
+		return b.handle(ctx, c)
+	})
+
+	b.baseBot.Handle(telebot.OnEdited, func(c telebot.Context) error {
+		if !b.isEditToHandle(c) {
+			return nil
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), b.conf.HandleTimeout)
 		defer cancel()
 
 		return b.handle(ctx, c)
 	})
 
-	b.baseBot.Handle(&telebot.InlineButton{
-		Unique: "",
-	}, func(c telebot.Context) error {
-		ctx, cancel := context.WithCancel(context.Background())
+	b.baseBot.Handle(telebot.OnCallback, func(c telebot.Context) error {
+		ctx, cancel := context.WithTimeout(context.Background(), b.conf.HandleTimeout)
 		defer cancel()
 
 		return b.handle(ctx, c)
 	})
 
-	b.baseBot.Start()
+	b.baseBot.Handle(telebot.OnQuery, func(c telebot.Context) error {
+		return b.handleInlineQuery(c)
+	})
+
+	err := b.menu.Init()
+	if err != nil {
+		errs.Handle(err, false)
+	}
+
+	// Telegram doesn't deliver updates to long polling while a webhook is registered
+	if b.conf.Mode == ModePolling {
+		err = b.baseBot.RemoveWebhook()
+		if err != nil {
+			logging.Errorf("failed to remove telegram webhook: %v", err)
+		}
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		b.baseBot.Start()
+		close(stopped)
+	}()
+
+	select {
+	case err = <-b.pollErrs:
+		b.stopPolling()
+		<-stopped
+		return err
+	case <-stopped:
+		return nil
+	}
+}
+
+// stopPolling stops the telebot loop once, it's called on stop and when receiving updates failed
+func (b *Bot) stopPolling() {
+	b.stopOnce.Do(b.baseBot.Stop)
 }
 
 func (b *Bot) Stop() {
 	logging.Info("will stop telegram bot")
-	b.baseBot.Stop()
+	b.stopPolling()
+
+	b.waitForInFlight()
+
 	logging.Info("stopped telegram bot")
 }
+
+func (b *Bot) waitForInFlight() {
+	done := make(chan struct{})
+	go func() {
+		b.inFlight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		logging.Info("all in-flight telegram updates are processed")
+	case <-time.After(b.conf.ShutdownTimeout):
+		logging.Warnf("stopped waiting for in-flight telegram updates after %v", b.conf.ShutdownTimeout)
+	}
+}
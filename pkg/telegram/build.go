@@ -1,14 +1,17 @@
 package telegram
 
-import "breathbathChatGPT/pkg/msg"
+import (
+	"breathbathChatGPT/pkg/msg"
+	"breathbathChatGPT/pkg/storage"
+)
 
-func BuildBot(r *msg.Router) (*Bot, error) {
+func BuildBot(r *msg.Router, db storage.Client, adminDetector func(req *msg.Request) bool) (*Bot, error) {
 	config, err := LoadConfig()
 	if err != nil {
 		return nil, err
 	}
 
-	bot, err := NewBot(config, r)
+	bot, err := NewBot(config, r, db, adminDetector)
 	if err != nil {
 		return nil, err
 	}
@@ -1,14 +1,40 @@
 package telegram
 
 import (
+	"regexp"
+	"time"
+
 	"github.com/kelseyhightower/envconfig"
 	"github.com/pkg/errors"
 
 	"breathbathChatGPT/pkg/errs"
 )
 
+const (
+	ModePolling = "polling"
+	ModeWebhook = "webhook"
+)
+
+var secretTokenRegex = regexp.MustCompile(`^[A-Za-z0-9_-]{1,256}$`)
+
 type Config struct {
-	APIToken string `envconfig:"TELEGRAM_ACCESS_TOKEN"`
+	APIToken        string        `envconfig:"TELEGRAM_ACCESS_TOKEN"`
+	Mode            string        `envconfig:"TELEGRAM_MODE" default:"polling"`
+	ShutdownTimeout time.Duration `envconfig:"TELEGRAM_SHUTDOWN_TIMEOUT" default:"30s"`
+	HandleTimeout   time.Duration `envconfig:"TELEGRAM_HANDLE_TIMEOUT" default:"10m"`
+
+	GroupConversationMode string `envconfig:"TELEGRAM_GROUP_CONVERSATION_MODE" default:"member"`
+
+	InlineDebounce time.Duration `envconfig:"TELEGRAM_INLINE_DEBOUNCE" default:"700ms"`
+	InlineTimeout  time.Duration `envconfig:"TELEGRAM_INLINE_TIMEOUT" default:"8s"`
+
+	WebhookListen       string `envconfig:"TELEGRAM_WEBHOOK_LISTEN" default:":8443"`
+	WebhookPublicURL    string `envconfig:"TELEGRAM_WEBHOOK_PUBLIC_URL"`
+	WebhookSecretToken  string `envconfig:"TELEGRAM_WEBHOOK_SECRET_TOKEN"`
+	WebhookTLSCert      string `envconfig:"TELEGRAM_WEBHOOK_TLS_CERT"`
+	WebhookTLSKey       string `envconfig:"TELEGRAM_WEBHOOK_TLS_KEY"`
+	WebhookUploadCert   bool   `envconfig:"TELEGRAM_WEBHOOK_UPLOAD_CERT"`
+	WebhookRemoveOnStop bool   `envconfig:"TELEGRAM_WEBHOOK_REMOVE_ON_STOP" default:"false"`
 }
 
 func (c *Config) Validate() *errs.Multi {
@@ -18,9 +44,54 @@ func (c *Config) Validate() *errs.Multi {
 		e.Errf("TELEGRAM_ACCESS_TOKEN cannot be empty")
 	}
 
+	switch c.Mode {
+	case ModePolling:
+	case ModeWebhook:
+		c.validateWebhook(e)
+	default:
+		e.Errf("TELEGRAM_MODE should be one of %q, %q, got %q", ModePolling, ModeWebhook, c.Mode)
+	}
+
+	if c.HandleTimeout <= 0 {
+		e.Errf("TELEGRAM_HANDLE_TIMEOUT should be positive, got %v", c.HandleTimeout)
+	}
+
+	switch c.GroupConversationMode {
+	case GroupConversationPerMember, GroupConversationShared:
+	default:
+		e.Errf(
+			"TELEGRAM_GROUP_CONVERSATION_MODE should be one of %q, %q, got %q",
+			GroupConversationPerMember,
+			GroupConversationShared,
+			c.GroupConversationMode,
+		)
+	}
+
 	return e
 }
 
+func (c *Config) validateWebhook(e *errs.Multi) {
+	if c.WebhookListen == "" {
+		e.Errf("TELEGRAM_WEBHOOK_LISTEN cannot be empty in webhook mode")
+	}
+
+	if c.WebhookPublicURL == "" {
+		e.Errf("TELEGRAM_WEBHOOK_PUBLIC_URL cannot be empty in webhook mode")
+	}
+
+	if !secretTokenRegex.MatchString(c.WebhookSecretToken) {
+		e.Errf("TELEGRAM_WEBHOOK_SECRET_TOKEN should contain 1-256 characters A-Z, a-z, 0-9, _ and - in webhook mode")
+	}
+
+	if (c.WebhookTLSCert == "") != (c.WebhookTLSKey == "") {
+		e.Errf("TELEGRAM_WEBHOOK_TLS_CERT and TELEGRAM_WEBHOOK_TLS_KEY should be provided together")
+	}
+
+	if c.WebhookUploadCert && c.WebhookTLSCert == "" {
+		e.Errf("TELEGRAM_WEBHOOK_TLS_CERT cannot be empty if TELEGRAM_WEBHOOK_UPLOAD_CERT is enabled")
+	}
+}
+
 func LoadConfig() (cfg *Config, err error) {
 	cfg = new(Config)
 	err = envconfig.Process("telegram", cfg)
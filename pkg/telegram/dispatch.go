@@ -0,0 +1,38 @@
+package telegram
+
+import (
+	"sync"
+
+	"gopkg.in/telebot.v3"
+)
+
+// dispatchingPoller handles each update of the wrapped poller in an own goroutine, it counts the update in inFlight
+// before the goroutine starts, so that waiting for inFlight after the poller returned cannot miss an update,
+// telebot has to be synchronous, so that the handler completes within ProcessUpdate
+type dispatchingPoller struct {
+	poller   telebot.Poller
+	inFlight *sync.WaitGroup
+}
+
+func (dp *dispatchingPoller) Poll(b *telebot.Bot, _ chan telebot.Update, stop chan struct{}) {
+	updates := make(chan telebot.Update)
+	pollDone := make(chan struct{})
+
+	go func() {
+		dp.poller.Poll(b, updates, stop)
+		close(pollDone)
+	}()
+
+	for {
+		select {
+		case upd := <-updates:
+			dp.inFlight.Add(1)
+			go func(upd telebot.Update) {
+				defer dp.inFlight.Done()
+				b.ProcessUpdate(upd)
+			}(upd)
+		case <-pollDone:
+			return
+		}
+	}
+}
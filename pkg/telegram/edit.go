@@ -0,0 +1,87 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"breathbathChatGPT/pkg/msg"
+	"breathbathChatGPT/pkg/storage"
+
+	logging "github.com/sirupsen/logrus"
+	"gopkg.in/telebot.v3"
+)
+
+const repliesVersion = "v1"
+
+// replyValidity is how long the bot remembers its replies to be able to edit them, older edits start no new answer anyway
+const replyValidity = time.Hour
+
+// replyTracker remembers which bot messages were sent as a reply to a user message, they are kept in the storage,
+// so that edits are found after a restart and by all instances behind a webhook
+type replyTracker struct {
+	db storage.Client
+}
+
+func newReplyTracker(db storage.Client) *replyTracker {
+	return &replyTracker{db: db}
+}
+
+func (rt *replyTracker) getKey(userMsg *telebot.Message) string {
+	return storage.GenerateCacheKey(repliesVersion, "telegram", "replies", fmt.Sprint(userMsg.Chat.ID), fmt.Sprint(userMsg.ID))
+}
+
+func (rt *replyTracker) track(ctx context.Context, userMsg *telebot.Message, sent []*telebot.Message) {
+	if userMsg == nil || userMsg.Chat == nil || len(sent) == 0 {
+		return
+	}
+
+	messages := make([]telebot.StoredMessage, 0, len(sent))
+	for _, m := range sent {
+		messages = append(messages, telebot.StoredMessage{MessageID: fmt.Sprint(m.ID), ChatID: m.Chat.ID})
+	}
+
+	err := rt.db.Save(ctx, rt.getKey(userMsg), messages, replyValidity)
+	if err != nil {
+		logging.WithContext(ctx).Warnf("failed to store the reply to telegram message %d, its edits will be answered anew: %v", userMsg.ID, err)
+	}
+}
+
+func (rt *replyTracker) get(ctx context.Context, userMsg *telebot.Message) []telebot.Editable {
+	if userMsg == nil || userMsg.Chat == nil {
+		return nil
+	}
+
+	messages := []telebot.StoredMessage{}
+	found, err := rt.db.Load(ctx, rt.getKey(userMsg), &messages)
+	if err != nil {
+		logging.WithContext(ctx).Warnf("failed to load the reply to telegram message %d: %v", userMsg.ID, err)
+		return nil
+	}
+
+	if !found {
+		return nil
+	}
+
+	editables := make([]telebot.Editable, 0, len(messages))
+	for _, m := range messages {
+		editables = append(editables, m)
+	}
+
+	return editables
+}
+
+func isEditedMessage(c telebot.Context) bool {
+	return c.Update().EditedMessage != nil
+}
+
+// isEditToHandle filters edits of commands out, they were executed already and repeating them is rather surprising
+func (b *Bot) isEditToHandle(c telebot.Context) bool {
+	m := c.Message()
+	if m == nil || m.Text == "" || strings.HasPrefix(m.Text, msg.CommandPrefix) {
+		return false
+	}
+
+	return b.isAddressedToBot(c)
+}
@@ -0,0 +1,103 @@
+package telegram
+
+import (
+	"regexp"
+	"strings"
+
+	"gopkg.in/telebot.v3"
+)
+
+const (
+	GroupConversationPerMember = "member"
+	GroupConversationShared    = "shared"
+)
+
+var commandBotNameRegex = regexp.MustCompile(`^(/\w+)@(\w+)`)
+
+func isGroupChat(chat *telebot.Chat) bool {
+	return chat != nil && (chat.Type == telebot.ChatGroup || chat.Type == telebot.ChatSuperGroup)
+}
+
+// isAddressedToBot tells if the bot should react on a group message, i.e. it's a command,
+// a reply to a bot's message or it mentions the bot
+func (b *Bot) isAddressedToBot(c telebot.Context) bool {
+	if !isGroupChat(c.Chat()) || c.Callback() != nil {
+		return true
+	}
+
+	m := c.Message()
+	if m == nil {
+		return false
+	}
+
+	me := b.baseBot.Me
+	if strings.HasPrefix(c.Text(), "/") {
+		return b.isOwnCommand(c.Text())
+	}
+
+	if m.ReplyTo != nil && m.ReplyTo.Sender != nil && m.ReplyTo.Sender.ID == me.ID {
+		return true
+	}
+
+	for _, entity := range m.Entities {
+		switch entity.Type {
+		case telebot.EntityMention:
+			if strings.EqualFold(m.EntityText(entity), "@"+me.Username) {
+				return true
+			}
+		case telebot.EntityTMention:
+			if entity.User != nil && entity.User.ID == me.ID {
+				return true
+			}
+		default:
+			continue
+		}
+	}
+
+	return false
+}
+
+// isOwnCommand tells if a command has no bot name suffix or the suffix is the name of this bot,
+// so that commands like /reset@other_bot are left to the other bots of the group
+func (b *Bot) isOwnCommand(text string) bool {
+	matches := commandBotNameRegex.FindStringSubmatch(text)
+	if matches == nil {
+		return true
+	}
+
+	return strings.EqualFold(matches[2], b.baseBot.Me.Username)
+}
+
+// stripBotName removes the bot mention and the bot name suffix of commands like /help@our_bot from the message text
+func (b *Bot) stripBotName(text string) string {
+	username := b.baseBot.Me.Username
+	if username == "" {
+		return text
+	}
+
+	if matches := commandBotNameRegex.FindStringSubmatch(text); matches != nil && strings.EqualFold(matches[2], username) {
+		text = matches[1] + text[len(matches[0]):]
+	}
+
+	mentionRegex := regexp.MustCompile(`(?i)@` + regexp.QuoteMeta(username) + `\b`)
+
+	return strings.TrimSpace(mentionRegex.ReplaceAllString(text, ""))
+}
+
+// getRecipient gives the chat of the message, so that replies in groups are visible to all members
+func (b *Bot) getRecipient(c telebot.Context) telebot.Recipient {
+	if chat := c.Chat(); chat != nil {
+		return chat
+	}
+
+	return c.Sender()
+}
+
+// getReplyTo threads the response to the triggering message in groups
+func (b *Bot) getReplyTo(c telebot.Context) *telebot.Message {
+	if !isGroupChat(c.Chat()) {
+		return nil
+	}
+
+	return c.Message()
+}
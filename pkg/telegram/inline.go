@@ -0,0 +1,161 @@
+package telegram
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"breathbathChatGPT/pkg/msg"
+
+	"github.com/pkg/errors"
+	logging "github.com/sirupsen/logrus"
+	"gopkg.in/telebot.v3"
+)
+
+const (
+	inlineTitleLength       = 64
+	inlineDescriptionLength = 128
+	inlineResultCacheTime   = 60
+)
+
+// inlineDebouncer remembers the latest query of each user, Telegram sends a query on every typed character,
+// so only the query which is not followed by another one within the debounce delay is answered
+type inlineDebouncer struct {
+	mu            sync.Mutex
+	latestQueries map[int64]string
+}
+
+func newInlineDebouncer() *inlineDebouncer {
+	return &inlineDebouncer{latestQueries: map[int64]string{}}
+}
+
+func (d *inlineDebouncer) track(userID int64, queryID string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.latestQueries[userID] = queryID
+}
+
+func (d *inlineDebouncer) isLatest(userID int64, queryID string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.latestQueries[userID] == queryID
+}
+
+func (d *inlineDebouncer) forget(userID int64, queryID string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.latestQueries[userID] == queryID {
+		delete(d.latestQueries, userID)
+	}
+}
+
+func (b *Bot) queryToRequest(query *telebot.Query) *msg.Request {
+	return &msg.Request{
+		Platform: "telegram",
+		ID:       query.ID,
+		Sender:   userToSender(query.Sender),
+		Message:  strings.TrimSpace(query.Text),
+		Meta: map[string]interface{}{
+			"conversation_id": "inline",
+			"is_inline_query": true,
+		},
+	}
+}
+
+func (b *Bot) handleInlineQuery(c telebot.Context) error {
+	query := c.Query()
+	if query == nil || query.Sender == nil || strings.TrimSpace(query.Text) == "" {
+		return nil
+	}
+
+	// inline queries are sent while typing, so a half typed command would be executed, commands are only accepted as messages
+	if strings.HasPrefix(strings.TrimSpace(query.Text), msg.CommandPrefix) {
+		return nil
+	}
+
+	b.inlineDebouncer.track(query.Sender.ID, query.ID)
+	defer b.inlineDebouncer.forget(query.Sender.ID, query.ID)
+
+	time.Sleep(b.conf.InlineDebounce)
+	if !b.inlineDebouncer.isLatest(query.Sender.ID, query.ID) {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), b.conf.InlineTimeout)
+	defer cancel()
+
+	log := logging.WithContext(ctx)
+	log.Debugf("got telegram inline query: %q", query.Text)
+
+	req := b.queryToRequest(query)
+
+	resp, err := b.msgHandler.Route(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	if resp == nil || resp.Message == "" {
+		log.Info("response to inline query is empty, will answer nothing")
+		return nil
+	}
+
+	err = c.Answer(&telebot.QueryResponse{
+		Results:    telebot.Results{b.buildInlineResult(req, resp)},
+		CacheTime:  inlineResultCacheTime,
+		IsPersonal: true,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to answer inline query %q", query.ID)
+	}
+
+	return nil
+}
+
+func (b *Bot) buildInlineResult(req *msg.Request, resp *msg.Response) telebot.Result {
+	text := resp.Message
+	format := resp.Options.GetFormat()
+	if format == msg.OutputFormatMarkdown {
+		text = renderMarkdownToHTML(text)
+		format = msg.OutputFormatHTML
+	}
+
+	// an inline result is a single message, so only the first part of a long answer fits
+	parts := splitMessage(text, format)
+	if len(parts) > 0 {
+		text = parts[0]
+	}
+
+	description := text
+	if format == msg.OutputFormatHTML {
+		description = htmlToPlainText(text)
+	}
+
+	if resp.Type == msg.Error {
+		text = `❗` + text + `❗`
+	}
+
+	result := &telebot.ArticleResult{
+		Title:       truncateText(req.Message, inlineTitleLength),
+		Description: truncateText(description, inlineDescriptionLength),
+	}
+	result.SetResultID(req.ID)
+	result.SetContent(&telebot.InputTextMessageContent{
+		Text:      text,
+		ParseMode: string(formatToParseMode(format)),
+	})
+
+	return result
+}
+
+func truncateText(text string, maxRunes int) string {
+	runes := []rune(strings.TrimSpace(text))
+	if len(runes) <= maxRunes {
+		return string(runes)
+	}
+
+	return string(runes[:maxRunes-1]) + "…"
+}
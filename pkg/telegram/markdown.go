@@ -0,0 +1,75 @@
+package telegram
+
+import (
+	"html"
+	"regexp"
+	"strings"
+
+	"breathbathChatGPT/pkg/markdown"
+)
+
+var (
+	htmlEscaper      = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+	attributeEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;")
+	htmlTagRegex     = regexp.MustCompile(`<[^>]*>`)
+)
+
+const horizontalRule = "──────────"
+
+// renderMarkdownToHTML converts Markdown produced by the model into the subset of HTML supported by Telegram
+func renderMarkdownToHTML(text string) string {
+	return markdown.Render(text, htmlRenderer{})
+}
+
+// htmlRenderer gives the tags of Telegram HTML, see https://core.telegram.org/bots/api#html-style
+type htmlRenderer struct{}
+
+func (htmlRenderer) Text(text string) string {
+	return htmlEscaper.Replace(text)
+}
+
+func (htmlRenderer) Bold(text string) string {
+	return "<b>" + text + "</b>"
+}
+
+func (htmlRenderer) Italic(text string) string {
+	return "<i>" + text + "</i>"
+}
+
+func (htmlRenderer) Strikethrough(text string) string {
+	return "<s>" + text + "</s>"
+}
+
+func (htmlRenderer) Code(code string) string {
+	return "<code>" + htmlEscaper.Replace(code) + "</code>"
+}
+
+func (htmlRenderer) Link(text, url string) string {
+	return `<a href="` + attributeEscaper.Replace(url) + `">` + text + "</a>"
+}
+
+func (htmlRenderer) CodeBlock(code, lang string) string {
+	if lang == "" {
+		return "<pre>" + htmlEscaper.Replace(code) + "</pre>"
+	}
+
+	return `<pre><code class="language-` + attributeEscaper.Replace(lang) + `">` + htmlEscaper.Replace(code) + "</code></pre>"
+}
+
+// Heading is shown in bold since Telegram has no headings
+func (htmlRenderer) Heading(text string, _ int) string {
+	return "<b>" + text + "</b>"
+}
+
+func (htmlRenderer) Blockquote(text string) string {
+	return "<blockquote>" + text + "</blockquote>"
+}
+
+func (htmlRenderer) ThematicBreak() string {
+	return horizontalRule
+}
+
+// htmlToPlainText removes the formatting from a Telegram HTML message
+func htmlToPlainText(text string) string {
+	return html.UnescapeString(htmlTagRegex.ReplaceAllString(text, ""))
+}
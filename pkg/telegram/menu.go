@@ -0,0 +1,207 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"breathbathChatGPT/pkg/help"
+	"breathbathChatGPT/pkg/msg"
+	"breathbathChatGPT/pkg/storage"
+
+	"github.com/pkg/errors"
+	logging "github.com/sirupsen/logrus"
+	"gopkg.in/telebot.v3"
+)
+
+const menuVersion = "v1"
+
+// commandMenu keeps the Telegram "/" menu in sync with the commands of the router handlers,
+// all users see the common commands, admins get the admin commands in their chats additionally,
+// the synced state is kept in the storage, so it's shared by all instances and survives a restart
+type commandMenu struct {
+	baseBot       *telebot.Bot
+	router        *msg.Router
+	db            storage.Client
+	adminDetector func(req *msg.Request) bool
+}
+
+// menuState is the menu which was set for a scope of a user
+type menuState struct {
+	Scope   telebot.CommandScope `json:"scope"`
+	IsAdmin bool                 `json:"is_admin"`
+}
+
+func newCommandMenu(baseBot *telebot.Bot, router *msg.Router, db storage.Client, adminDetector func(req *msg.Request) bool) *commandMenu {
+	return &commandMenu{
+		baseBot:       baseBot,
+		router:        router,
+		db:            db,
+		adminDetector: adminDetector,
+	}
+}
+
+func (cm *commandMenu) collectCommands(isAdmin bool) []telebot.Command {
+	commands := []telebot.Command{}
+	for _, h := range cm.router.Handlers {
+		provider, ok := h.(help.CommandsProvider)
+		if !ok {
+			continue
+		}
+
+		for _, c := range provider.GetCommands() {
+			if c.IsAdminOnly && !isAdmin {
+				continue
+			}
+
+			commands = append(commands, telebot.Command{
+				Text:        strings.TrimPrefix(c.Name, msg.CommandPrefix),
+				Description: c.Description,
+			})
+		}
+	}
+
+	return commands
+}
+
+// Init sets the commands of normal users as the default menu
+func (cm *commandMenu) Init() error {
+	err := cm.baseBot.SetCommands(cm.collectCommands(false), telebot.CommandScope{Type: telebot.CommandScopeDefault})
+	if err != nil {
+		return errors.Wrap(err, "failed to set telegram bot commands")
+	}
+
+	logging.Info("synced telegram bot commands menu")
+
+	return nil
+}
+
+// getScope gives the scope of the current user and the user id, in groups only the user should see the admin commands
+func (cm *commandMenu) getScope(c telebot.Context) (scope telebot.CommandScope, userID int64, ok bool) {
+	chat := c.Chat()
+	if chat == nil {
+		return telebot.CommandScope{}, 0, false
+	}
+
+	if !isGroupChat(chat) {
+		// the id of a private chat is the id of the user
+		return telebot.CommandScope{Type: telebot.CommandScopeChat, ChatID: chat.ID}, chat.ID, true
+	}
+
+	sender := c.Sender()
+	if sender == nil {
+		return telebot.CommandScope{}, 0, false
+	}
+
+	return telebot.CommandScope{Type: telebot.CommandScopeChatMember, ChatID: chat.ID, UserID: sender.ID}, sender.ID, true
+}
+
+func (cm *commandMenu) getKey(userID, chatID int64) string {
+	return storage.GenerateCacheKey(menuVersion, "telegram", "menu", fmt.Sprint(userID), fmt.Sprint(chatID))
+}
+
+// Sync updates the menu of the chat if the role of the user changed since the last sync
+func (cm *commandMenu) Sync(ctx context.Context, c telebot.Context, req *msg.Request) {
+	log := logging.WithContext(ctx)
+
+	scope, userID, ok := cm.getScope(c)
+	if !ok {
+		return
+	}
+
+	isAdmin := cm.adminDetector(req)
+
+	state := menuState{}
+	isSynced, err := cm.db.Load(ctx, cm.getKey(userID, scope.ChatID), &state)
+	if err != nil {
+		log.Errorf("failed to load telegram commands menu state for chat %d: %v", scope.ChatID, err)
+	}
+
+	if isSynced && state.IsAdmin == isAdmin {
+		return
+	}
+
+	cm.apply(ctx, userID, scope, isAdmin)
+}
+
+// SyncUser updates the menus of a user whose role was changed by somebody else, e.g. by an admin with /adduser,
+// all chats where the user got a menu are updated and admins get the admin commands in the private chat with the bot
+func (cm *commandMenu) SyncUser(ctx context.Context, change msg.UserChange) {
+	log := logging.WithContext(ctx)
+
+	if change.Platform != "telegram" {
+		return
+	}
+
+	// users which were added by the user name and didn't write yet get the menu with their first message
+	userID, err := strconv.ParseInt(change.Login, 10, 64)
+	if err != nil {
+		return
+	}
+
+	keys, err := cm.db.FindKeys(ctx, storage.GenerateCacheKey(menuVersion, "telegram", "menu", fmt.Sprint(userID), "*"))
+	if err != nil {
+		log.Errorf("failed to find telegram commands menus of user %d: %v", userID, err)
+		return
+	}
+
+	hasPrivateChat := false
+	for _, key := range keys {
+		state := menuState{}
+		found, err := cm.db.Load(ctx, key, &state)
+		if err != nil {
+			log.Errorf("failed to load telegram commands menu state %q: %v", key, err)
+			continue
+		}
+
+		if !found {
+			continue
+		}
+
+		if state.Scope.Type == telebot.CommandScopeChat {
+			hasPrivateChat = true
+		}
+
+		if state.IsAdmin != change.IsAdmin {
+			cm.apply(ctx, userID, state.Scope, change.IsAdmin)
+		}
+	}
+
+	if change.IsAdmin && !hasPrivateChat {
+		cm.apply(ctx, userID, telebot.CommandScope{Type: telebot.CommandScopeChat, ChatID: userID}, true)
+	}
+}
+
+// apply sets the menu of the scope and remembers it, the state is forgotten on failures to retry with the next message
+func (cm *commandMenu) apply(ctx context.Context, userID int64, scope telebot.CommandScope, isAdmin bool) {
+	log := logging.WithContext(ctx)
+
+	key := cm.getKey(userID, scope.ChatID)
+
+	var err error
+	if isAdmin {
+		err = cm.baseBot.SetCommands(cm.collectCommands(true), scope)
+	} else {
+		// without the chat specific commands the default menu is shown
+		err = cm.baseBot.DeleteCommands(scope)
+	}
+
+	if err != nil {
+		log.Errorf("failed to sync telegram commands menu for chat %d: %v", scope.ChatID, err)
+
+		err = cm.db.Delete(ctx, key)
+		if err != nil {
+			log.Errorf("failed to delete telegram commands menu state for chat %d: %v", scope.ChatID, err)
+		}
+
+		return
+	}
+
+	err = cm.db.Save(ctx, key, menuState{Scope: scope, IsAdmin: isAdmin}, 0)
+	if err != nil {
+		log.Errorf("failed to save telegram commands menu state for chat %d: %v", scope.ChatID, err)
+	}
+
+	log.Debugf("synced telegram commands menu for chat %d, is admin: %v", scope.ChatID, isAdmin)
+}
@@ -0,0 +1,103 @@
+package telegram
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"breathbathChatGPT/pkg/msg"
+
+	logging "github.com/sirupsen/logrus"
+	"gopkg.in/telebot.v3"
+)
+
+// chatActionRefreshInterval is below 5 seconds after which Telegram hides the chat action
+const chatActionRefreshInterval = time.Second * 4
+
+// progressIndicator sends the chat action for the reported activity and repeats it until stopped
+type progressIndicator struct {
+	baseBot   *telebot.Bot
+	recipient telebot.Recipient
+
+	mu        sync.Mutex
+	action    telebot.ChatAction
+	isStarted bool
+	stopCh    chan struct{}
+	stopOnce  sync.Once
+}
+
+func newProgressIndicator(baseBot *telebot.Bot, recipient telebot.Recipient) *progressIndicator {
+	return &progressIndicator{
+		baseBot:   baseBot,
+		recipient: recipient,
+		stopCh:    make(chan struct{}),
+	}
+}
+
+func activityToChatAction(activity msg.Activity) telebot.ChatAction {
+	switch activity {
+	case msg.ActivityUploadingPhoto:
+		return telebot.UploadingPhoto
+	case msg.ActivityUploadingDocument:
+		return telebot.UploadingDocument
+	case msg.ActivityUploadingAudio:
+		return telebot.UploadingAudio
+	case msg.ActivityTyping:
+		return telebot.Typing
+	default:
+		return telebot.Typing
+	}
+}
+
+func (pi *progressIndicator) Report(ctx context.Context, activity msg.Activity) {
+	pi.mu.Lock()
+	pi.action = activityToChatAction(activity)
+	isStarted := pi.isStarted
+	pi.isStarted = true
+	pi.mu.Unlock()
+
+	pi.notify(ctx)
+
+	if !isStarted {
+		go pi.refresh(ctx)
+	}
+}
+
+func (pi *progressIndicator) Stop() {
+	pi.stopOnce.Do(func() {
+		close(pi.stopCh)
+	})
+}
+
+func (pi *progressIndicator) refresh(ctx context.Context) {
+	ticker := time.NewTicker(chatActionRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-pi.stopCh:
+			return
+		case <-ticker.C:
+			pi.notify(ctx)
+		}
+	}
+}
+
+func (pi *progressIndicator) notify(ctx context.Context) {
+	select {
+	case <-pi.stopCh:
+		return
+	default:
+	}
+
+	pi.mu.Lock()
+	action := pi.action
+	pi.mu.Unlock()
+
+	err := pi.baseBot.Notify(pi.recipient, action)
+	if err != nil {
+		logging.WithContext(ctx).Warnf("failed to send telegram chat action %q: %v", action, err)
+	}
+}
@@ -0,0 +1,38 @@
+package telegram
+
+import (
+	"runtime/debug"
+
+	"github.com/pkg/errors"
+	logging "github.com/sirupsen/logrus"
+	"gopkg.in/telebot.v3"
+
+	"breathbathChatGPT/pkg/msg"
+)
+
+// recoverPanics keeps the bot running when handling of an update panics, the sender gets a polite reply
+func (b *Bot) recoverPanics(next telebot.HandlerFunc) telebot.HandlerFunc {
+	return func(c telebot.Context) (err error) {
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+
+			logging.Errorf("recovered from panic while handling telegram update %d: %v\n%s", c.Update().ID, rec, debug.Stack())
+			err = errors.Errorf("panic while handling telegram update %d: %v", c.Update().ID, rec)
+
+			// inline queries can only be answered with results, other updates without a chat or sender have nobody to reply to
+			if c.Query() != nil || (c.Chat() == nil && c.Sender() == nil) {
+				return
+			}
+
+			_, sendErr := b.baseBot.Send(b.getRecipient(c), msg.PanicMessage, &telebot.SendOptions{ReplyTo: b.getReplyTo(c)})
+			if sendErr != nil {
+				logging.Errorf("failed to send error message to the sender: %v", sendErr)
+			}
+		}()
+
+		return next(c)
+	}
+}
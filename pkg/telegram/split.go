@@ -0,0 +1,407 @@
+package telegram
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"breathbathChatGPT/pkg/msg"
+)
+
+const (
+	// maxMessageLength is the Telegram limit of characters in one text message
+	maxMessageLength = 4096
+	// reservedRepairLength is kept free in a part to close the markup interrupted by a forced split
+	reservedRepairLength = 128
+	codeFence            = "```"
+)
+
+type splitPriority int
+
+const (
+	splitPrioritySpace splitPriority = iota
+	splitPrioritySentence
+	splitPriorityLine
+	splitPriorityParagraph
+)
+
+// markupState describes the formatting entities which are open at some position of the text
+type markupState struct {
+	openTags []string
+	fence    string
+	// openMarkers are the inline Markdown entities in the order they were opened, e.g. "*" or "`"
+	openMarkers []string
+}
+
+func (ms *markupState) isSafe() bool {
+	return len(ms.openTags) == 0 && ms.fence == "" && len(ms.openMarkers) == 0
+}
+
+func (ms *markupState) copy() markupState {
+	res := *ms
+	res.openTags = append([]string{}, ms.openTags...)
+	res.openMarkers = append([]string{}, ms.openMarkers...)
+
+	return res
+}
+
+type splitCandidate struct {
+	pos      int
+	length   int
+	priority splitPriority
+	state    markupState
+}
+
+// markdownState tracks inline Markdown entities, Telegram rejects messages where they are not closed
+type markdownState struct {
+	openMarkers                            []string
+	isLinkText, isAfterLinkText, isLinkURL bool
+	isEscaped                              bool
+	skipRunes                              int
+}
+
+func (ms *markdownState) isCode() bool {
+	return len(ms.openMarkers) > 0 && ms.openMarkers[len(ms.openMarkers)-1] == "`"
+}
+
+// toggle closes the entity of the marker if it's open or opens it otherwise
+func (ms *markdownState) toggle(marker string) {
+	for i := len(ms.openMarkers) - 1; i >= 0; i-- {
+		if ms.openMarkers[i] == marker {
+			ms.openMarkers = append(ms.openMarkers[:i], ms.openMarkers[i+1:]...)
+			return
+		}
+	}
+
+	ms.openMarkers = append(ms.openMarkers, marker)
+}
+
+// isAtomic tells if the text cannot be split at the current position, since the markup cannot be closed there,
+// i.e. between an escape character and the escaped one, inside of a multi character marker or inside of a link
+func (ms *markdownState) isAtomic() bool {
+	return ms.isEscaped || ms.skipRunes > 0 || ms.isLinkText || ms.isAfterLinkText || ms.isLinkURL
+}
+
+type messageSplitter struct {
+	format msg.OutputFormat
+	limit  int
+	// repairLength is kept free in a part for the markup closing the entities interrupted by a forced split
+	repairLength int
+}
+
+// splitMessage splits text into parts fitting into one Telegram message, it prefers paragraph, line and
+// sentence boundaries and never splits inside code blocks or formatting entities if there is another option
+func splitMessage(text string, format msg.OutputFormat) []string {
+	s := &messageSplitter{format: format, limit: maxMessageLength, repairLength: reservedRepairLength}
+
+	return s.split(text)
+}
+
+// textLength counts characters the way Telegram does, i.e. in UTF-16 code units
+func textLength(text string) int {
+	length := 0
+	for _, r := range text {
+		length += runeLength(r)
+	}
+
+	return length
+}
+
+func runeLength(r rune) int {
+	const maxSingleUnitRune = 0xFFFF
+	if r > maxSingleUnitRune {
+		return 2
+	}
+
+	return 1
+}
+
+func (s *messageSplitter) split(text string) []string {
+	parts := []string{}
+	rest := text
+
+	for textLength(rest) > s.limit {
+		var part string
+		part, rest = s.splitOnce(rest)
+		if strings.TrimSpace(part) != "" {
+			parts = append(parts, part)
+		}
+	}
+
+	if strings.TrimSpace(rest) != "" {
+		parts = append(parts, rest)
+	}
+
+	return parts
+}
+
+func (s *messageSplitter) splitOnce(text string) (part, rest string) {
+	candidates, safeHardPos, safeHardState := s.scan(text, s.limit)
+	if c := s.chooseCandidate(candidates, s.limit, true); c != nil {
+		return strings.TrimRightFunc(text[:c.pos], unicode.IsSpace), strings.TrimLeftFunc(text[c.pos:], unicode.IsSpace)
+	}
+
+	// no safe split point found, so the markup will be closed at the end of the part and reopened in the next one
+	repairLimit := s.limit - s.repairLength
+	candidates, hardPos, hardState := s.scan(text, repairLimit)
+	if c := s.chooseCandidate(candidates, repairLimit, false); c != nil {
+		closing, reopening := s.repairMarkup(&c.state)
+		if c.state.fence != "" {
+			return text[:c.pos] + closing, reopening + strings.TrimPrefix(text[c.pos:], "\n")
+		}
+
+		return strings.TrimRightFunc(text[:c.pos], unicode.IsSpace) + closing,
+			reopening + strings.TrimLeftFunc(text[c.pos:], unicode.IsSpace)
+	}
+
+	// a long word without markup doesn't need the space reserved for the repair
+	if safeHardPos > 0 && safeHardState.isSafe() {
+		return text[:safeHardPos], text[safeHardPos:]
+	}
+
+	if hardPos == 0 {
+		hardPos = s.lastRuneBoundary(text, repairLimit)
+	}
+
+	if hardPos == 0 {
+		return text, ""
+	}
+
+	closing, reopening := s.repairMarkup(&hardState)
+
+	return text[:hardPos] + closing, reopening + text[hardPos:]
+}
+
+// chooseCandidate prefers the strongest boundary in the second half of the allowed length and the latest one on a tie
+func (s *messageSplitter) chooseCandidate(candidates []splitCandidate, maxLength int, safeOnly bool) *splitCandidate {
+	var best, bestInSecondHalf *splitCandidate
+
+	isBetter := func(c, than *splitCandidate) bool {
+		return than == nil || c.priority > than.priority || (c.priority == than.priority && c.pos > than.pos)
+	}
+
+	for i := range candidates {
+		c := &candidates[i]
+		if c.length > maxLength || (safeOnly && !c.state.isSafe()) {
+			continue
+		}
+
+		if isBetter(c, best) {
+			best = c
+		}
+
+		if c.length >= maxLength/2 && isBetter(c, bestInSecondHalf) {
+			bestInSecondHalf = c
+		}
+	}
+
+	if bestInSecondHalf != nil {
+		return bestInSecondHalf
+	}
+
+	return best
+}
+
+// repairMarkup gives the markup closing the entities open at a split point and reopening them in the next part
+func (s *messageSplitter) repairMarkup(state *markupState) (closing, reopening string) {
+	if state.fence != "" {
+		return "\n" + codeFence, state.fence + "\n"
+	}
+
+	for i := len(state.openTags) - 1; i >= 0; i-- {
+		closing += "</" + getTagName(state.openTags[i]) + ">"
+	}
+	reopening = strings.Join(state.openTags, "")
+
+	for i := len(state.openMarkers) - 1; i >= 0; i-- {
+		closing += state.openMarkers[i]
+	}
+	reopening += strings.Join(state.openMarkers, "")
+
+	return closing, reopening
+}
+
+// lastRuneBoundary gives the last position fitting into maxLength, it's used when the text has no position
+// where the markup can be repaired, e.g. a link which is longer than a message, the markup stays broken then
+func (s *messageSplitter) lastRuneBoundary(text string, maxLength int) int {
+	length := 0
+	for i, r := range text {
+		length += runeLength(r)
+		if length > maxLength {
+			return i
+		}
+	}
+
+	return 0
+}
+
+// scan collects whitespace positions where the text can be split together with the markup state at them,
+// it stops at maxLength and gives the last position where the markup can be repaired for a forced split,
+// i.e. not inside of an HTML tag, an HTML entity, a Markdown link or escape
+func (s *messageSplitter) scan(text string, maxLength int) (candidates []splitCandidate, hardPos int, hardState markupState) {
+	state := markupState{}
+	md := markdownState{}
+	length := 0
+	isInTag, isInEntity, isLineStart := false, false, true
+	tagStart := 0
+	prevRune := rune(0)
+
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+
+		if i > 0 && !isInTag && !isInEntity && !md.isAtomic() {
+			hardPos, hardState = i, state.copy()
+
+			if unicode.IsSpace(r) {
+				candidates = append(candidates, splitCandidate{
+					pos:      i,
+					length:   length,
+					priority: getSplitPriority(text[i:], prevRune),
+					state:    state.copy(),
+				})
+			}
+		}
+
+		length += runeLength(r)
+		if length > maxLength {
+			break
+		}
+
+		switch s.format {
+		case msg.OutputFormatHTML:
+			switch {
+			case isInTag:
+				if r == '>' {
+					isInTag = false
+					state.openTags = applyTag(state.openTags, text[tagStart:i+size])
+				}
+			case isInEntity:
+				isInEntity = r != ';' && !unicode.IsSpace(r)
+			case r == '<':
+				isInTag, tagStart = true, i
+			case r == '&':
+				isInEntity = true
+			}
+		case msg.OutputFormatMarkdown1, msg.OutputFormatMarkdown2:
+			s.scanMarkdownRune(text, i, r, isLineStart, &state, &md)
+		case msg.OutputFormatUndefined:
+		}
+
+		isLineStart = r == '\n'
+		prevRune = r
+		i += size
+	}
+
+	return candidates, hardPos, hardState
+}
+
+func (s *messageSplitter) scanMarkdownRune(text string, pos int, r rune, isLineStart bool, state *markupState, md *markdownState) {
+	if md.skipRunes > 0 {
+		md.skipRunes--
+		return
+	}
+
+	if isLineStart && strings.HasPrefix(text[pos:], codeFence) {
+		if state.fence == "" {
+			fenceLine := text[pos:]
+			if lineEnd := strings.IndexByte(fenceLine, '\n'); lineEnd >= 0 {
+				fenceLine = fenceLine[:lineEnd]
+			}
+			state.fence = fenceLine
+		} else {
+			state.fence = ""
+		}
+		md.skipRunes = len(codeFence) - 1
+
+		return
+	}
+
+	if state.fence != "" {
+		return
+	}
+
+	if md.isEscaped {
+		md.isEscaped = false
+		return
+	}
+
+	isAfterLinkText := md.isAfterLinkText
+	md.isAfterLinkText = false
+	isMarkdown2 := s.format == msg.OutputFormatMarkdown2
+
+	switch {
+	// the legacy Markdown allows escaping only outside of entities
+	case r == '\\' && (isMarkdown2 || (len(md.openMarkers) == 0 && !md.isLinkText)):
+		md.isEscaped = true
+	case md.isCode():
+		if r == '`' {
+			md.toggle("`")
+		}
+	case r == '`':
+		md.toggle("`")
+	case md.isLinkURL:
+		md.isLinkURL = r != ')'
+	case r == '*':
+		md.toggle("*")
+	case r == '_' && isMarkdown2 && strings.HasPrefix(text[pos:], "__"):
+		md.toggle("__")
+		md.skipRunes = 1
+	case r == '_':
+		md.toggle("_")
+	case r == '~' && isMarkdown2:
+		md.toggle("~")
+	case r == '|' && isMarkdown2 && strings.HasPrefix(text[pos:], "||"):
+		md.toggle("||")
+		md.skipRunes = 1
+	case r == '[':
+		md.isLinkText = true
+	case r == ']' && md.isLinkText:
+		md.isLinkText = false
+		md.isAfterLinkText = true
+	case r == '(' && isAfterLinkText:
+		md.isLinkURL = true
+	}
+
+	state.openMarkers = append(state.openMarkers[:0], md.openMarkers...)
+}
+
+func getSplitPriority(textFromPos string, prevRune rune) splitPriority {
+	switch {
+	case strings.HasPrefix(textFromPos, "\n\n"):
+		return splitPriorityParagraph
+	case textFromPos[0] == '\n':
+		return splitPriorityLine
+	case prevRune == '.' || prevRune == '!' || prevRune == '?':
+		return splitPrioritySentence
+	default:
+		return splitPrioritySpace
+	}
+}
+
+func getTagName(tag string) string {
+	name := strings.TrimLeft(tag, "</")
+	if end := strings.IndexAny(name, " \t\n/>"); end >= 0 {
+		name = name[:end]
+	}
+
+	return strings.ToLower(name)
+}
+
+func applyTag(openTags []string, tag string) []string {
+	if strings.HasSuffix(tag, "/>") {
+		return openTags
+	}
+
+	if !strings.HasPrefix(tag, "</") {
+		return append(openTags, tag)
+	}
+
+	name := getTagName(tag)
+	for i := len(openTags) - 1; i >= 0; i-- {
+		if getTagName(openTags[i]) == name {
+			return openTags[:i]
+		}
+	}
+
+	return openTags
+}
@@ -0,0 +1,142 @@
+package telegram
+
+import (
+	"reflect"
+	"testing"
+
+	"breathbathChatGPT/pkg/msg"
+)
+
+func TestSplitMessage(t *testing.T) {
+	testCases := []struct {
+		name   string
+		format msg.OutputFormat
+		limit  int
+		text   string
+		parts  []string
+	}{
+		{
+			name:   "short text",
+			format: msg.OutputFormatMarkdown2,
+			limit:  20,
+			text:   "*short* text",
+			parts:  []string{"*short* text"},
+		},
+		{
+			name:   "sentence boundary",
+			format: msg.OutputFormatUndefined,
+			limit:  20,
+			text:   "First sentence here. Second one is here.",
+			parts:  []string{"First sentence here.", "Second one is here."},
+		},
+		{
+			name:   "split before markdown entity",
+			format: msg.OutputFormatMarkdown2,
+			limit:  20,
+			text:   "plain words *bold words that go on* tail",
+			parts:  []string{"plain words", "*bold words that*", "*go on* tail"},
+		},
+		{
+			name:   "forced split inside bold word",
+			format: msg.OutputFormatMarkdown2,
+			limit:  16,
+			text:   "*aaaaaaaaaaaaaaaaaaaaaaaa*",
+			parts:  []string{"*aaaaaaaaaaa*", "*aaaaaaaaaaaaa*"},
+		},
+		{
+			name:   "nested entities",
+			format: msg.OutputFormatMarkdown2,
+			limit:  16,
+			text:   "*bold _italic words here_ more*",
+			parts:  []string{"*bold*", "*_italic_*", "*_words_*", "*_here_ more*"},
+		},
+		{
+			name:   "inline code",
+			format: msg.OutputFormatMarkdown1,
+			limit:  16,
+			text:   "aa `code words are here` bb",
+			parts:  []string{"aa", "`code words`", "`are here` bb"},
+		},
+		{
+			name:   "spoiler",
+			format: msg.OutputFormatMarkdown2,
+			limit:  16,
+			text:   "||spoiler words here||",
+			parts:  []string{"||spoiler||", "||words here||"},
+		},
+		{
+			name:   "link is moved to the next part",
+			format: msg.OutputFormatMarkdown2,
+			limit:  30,
+			text:   "some words [link text](http://x.io) end",
+			parts:  []string{"some words", "[link text](http://x.io) end"},
+		},
+		{
+			name:   "no split between escape and escaped character",
+			format: msg.OutputFormatMarkdown2,
+			limit:  12,
+			text:   "aaaaaaaaaaa\\*bb",
+			parts:  []string{"aaaaaaaaaaa", "\\*bb"},
+		},
+		{
+			name:   "escaped marker doesn't open entity",
+			format: msg.OutputFormatMarkdown2,
+			limit:  12,
+			text:   "aaaaaaaaa\\*bbbbbbbbbbb",
+			parts:  []string{"aaaaaaaaa\\*b", "bbbbbbbbbb"},
+		},
+		{
+			name:   "code fence",
+			format: msg.OutputFormatMarkdown2,
+			limit:  24,
+			text:   "text\n```go\nline one\nline two\nline three\n```",
+			parts:  []string{"text", "```go\nline one\n```", "```go\nline two\n```", "```go\nline three\n```"},
+		},
+		{
+			name:   "html tags and entities",
+			format: msg.OutputFormatHTML,
+			limit:  24,
+			text:   "<b>bold words &amp; more bold words</b>",
+			parts:  []string{"<b>bold words &amp;</b>", "<b>more bold words</b>"},
+		},
+		{
+			name:   "multi-byte runes",
+			format: msg.OutputFormatUndefined,
+			limit:  5,
+			text:   "ääääääää",
+			parts:  []string{"äääää", "äää"},
+		},
+		{
+			name:   "runes with two utf-16 code units",
+			format: msg.OutputFormatUndefined,
+			limit:  7,
+			text:   "😀😀😀😀😀",
+			parts:  []string{"😀😀😀", "😀😀"},
+		},
+		{
+			name:   "runes with two utf-16 code units inside entity",
+			format: msg.OutputFormatMarkdown2,
+			limit:  9,
+			text:   "😀 *😀😀😀😀*",
+			parts:  []string{"😀", "*😀😀*", "*😀😀*"},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			s := &messageSplitter{format: tc.format, limit: tc.limit, repairLength: 4}
+
+			parts := s.split(tc.text)
+			if !reflect.DeepEqual(parts, tc.parts) {
+				t.Fatalf("expected parts %q, got %q", tc.parts, parts)
+			}
+
+			for _, part := range parts {
+				if textLength(part) > tc.limit {
+					t.Errorf("part %q is longer than %d", part, tc.limit)
+				}
+			}
+		})
+	}
+}
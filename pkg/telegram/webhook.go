@@ -0,0 +1,132 @@
+package telegram
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	logging "github.com/sirupsen/logrus"
+	"gopkg.in/telebot.v3"
+)
+
+const (
+	secretTokenHeader        = "X-Telegram-Bot-Api-Secret-Token"
+	webhookReadHeaderTimeout = time.Second * 10
+)
+
+// webhookPoller receives updates over an HTTP listener, registers the webhook on start and removes it on stop,
+// failures of the registration or the listener are reported to errs, since telebot pollers cannot return errors
+type webhookPoller struct {
+	cfg  *Config
+	errs chan error
+}
+
+func newWebhookPoller(cfg *Config) *webhookPoller {
+	return &webhookPoller{cfg: cfg, errs: make(chan error, 1)}
+}
+
+func (wp *webhookPoller) buildWebhook() *telebot.Webhook {
+	webhook := &telebot.Webhook{
+		Listen:      wp.cfg.WebhookListen,
+		SecretToken: wp.cfg.WebhookSecretToken,
+		Endpoint: &telebot.WebhookEndpoint{
+			PublicURL: wp.cfg.WebhookPublicURL,
+		},
+	}
+
+	if wp.cfg.WebhookUploadCert {
+		webhook.Endpoint.Cert = wp.cfg.WebhookTLSCert
+	}
+
+	return webhook
+}
+
+func (wp *webhookPoller) Poll(b *telebot.Bot, updates chan telebot.Update, stop chan struct{}) {
+	err := b.SetWebhook(wp.buildWebhook())
+	if err != nil {
+		wp.errs <- errors.Wrap(err, "failed to register telegram webhook")
+		return
+	}
+	logging.Infof("registered telegram webhook %q", wp.cfg.WebhookPublicURL)
+
+	server := &http.Server{
+		Addr:              wp.cfg.WebhookListen,
+		Handler:           wp.buildHandler(updates, stop),
+		ReadHeaderTimeout: webhookReadHeaderTimeout,
+	}
+
+	serverErrs := make(chan error, 1)
+	go func() {
+		logging.Infof("will listen for telegram webhook requests on %q", wp.cfg.WebhookListen)
+		if wp.cfg.WebhookTLSCert != "" {
+			serverErrs <- server.ListenAndServeTLS(wp.cfg.WebhookTLSCert, wp.cfg.WebhookTLSKey)
+		} else {
+			serverErrs <- server.ListenAndServe()
+		}
+	}()
+
+	select {
+	case <-stop:
+	case err = <-serverErrs:
+		wp.errs <- errors.Wrap(err, "telegram webhook listener failed")
+	}
+
+	if wp.cfg.WebhookRemoveOnStop {
+		err = b.RemoveWebhook()
+		if err != nil {
+			logging.Errorf("failed to remove telegram webhook: %v", err)
+		} else {
+			logging.Info("removed telegram webhook")
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), wp.cfg.ShutdownTimeout)
+	defer cancel()
+
+	err = server.Shutdown(ctx)
+	if err != nil {
+		logging.Errorf("failed to shutdown telegram webhook listener gracefully: %v", err)
+	}
+}
+
+// buildHandler accepts updates from Telegram, on stopping it answers with an error so Telegram delivers them later
+func (wp *webhookPoller) buildHandler(updates chan telebot.Update, stop chan struct{}) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		secretToken := r.Header.Get(secretTokenHeader)
+		if subtle.ConstantTimeCompare([]byte(secretToken), []byte(wp.cfg.WebhookSecretToken)) != 1 {
+			logging.Warnf("got telegram webhook request with invalid secret token from %q", r.RemoteAddr)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var update telebot.Update
+		err := json.NewDecoder(r.Body).Decode(&update)
+		if err != nil {
+			logging.Errorf("failed to decode telegram update: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		select {
+		case <-stop:
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		default:
+		}
+
+		select {
+		case <-stop:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case updates <- update:
+			w.WriteHeader(http.StatusOK)
+		}
+	})
+}
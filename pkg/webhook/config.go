@@ -0,0 +1,86 @@
+package webhook
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+	"github.com/pkg/errors"
+
+	"breathbathChatGPT/pkg/errs"
+)
+
+type Config struct {
+	Listen          string        `envconfig:"WEBHOOK_LISTEN" default:":8083"`
+	TLSCert         string        `envconfig:"WEBHOOK_TLS_CERT"`
+	TLSKey          string        `envconfig:"WEBHOOK_TLS_KEY"`
+	ShutdownTimeout time.Duration `envconfig:"WEBHOOK_SHUTDOWN_TIMEOUT" default:"30s"`
+	MaxBodySize     int64         `envconfig:"WEBHOOK_MAX_BODY_SIZE" default:"1048576"`
+	HandleTimeout   time.Duration `envconfig:"WEBHOOK_HANDLE_TIMEOUT" default:"10m"`
+	// SourcesFile is a JSON file with the list of sources, see Source
+	SourcesFile string `envconfig:"WEBHOOK_SOURCES_FILE"`
+
+	Sources []*Source `ignored:"true"`
+}
+
+func (c *Config) Validate() *errs.Multi {
+	e := errs.NewMulti()
+
+	if c.Listen == "" {
+		e.Errf("WEBHOOK_LISTEN cannot be empty")
+	}
+
+	if (c.TLSCert == "") != (c.TLSKey == "") {
+		e.Errf("WEBHOOK_TLS_CERT and WEBHOOK_TLS_KEY should be set together")
+	}
+
+	if c.MaxBodySize <= 0 {
+		e.Errf("WEBHOOK_MAX_BODY_SIZE should be positive, got %d", c.MaxBodySize)
+	}
+
+	if c.HandleTimeout <= 0 {
+		e.Errf("WEBHOOK_HANDLE_TIMEOUT should be positive, got %v", c.HandleTimeout)
+	}
+
+	if len(c.Sources) == 0 {
+		e.Errf("WEBHOOK_SOURCES_FILE should contain at least one source")
+	}
+
+	names := map[string]bool{}
+	for i, s := range c.Sources {
+		s.validate(e, i)
+
+		if names[s.Name] {
+			e.Errf("source name %q is used more than once", s.Name)
+		}
+		names[s.Name] = true
+	}
+
+	return e
+}
+
+func LoadConfig() (cfg *Config, err error) {
+	cfg = new(Config)
+
+	err = envconfig.Process("webhook", cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load webhook config")
+	}
+
+	if cfg.SourcesFile == "" {
+		return cfg, nil
+	}
+
+	rawSources, err := os.ReadFile(cfg.SourcesFile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read webhook sources file %q", cfg.SourcesFile)
+	}
+
+	err = json.Unmarshal(rawSources, &cfg.Sources)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to decode webhook sources file %q", cfg.SourcesFile)
+	}
+
+	return cfg, nil
+}
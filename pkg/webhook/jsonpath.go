@@ -0,0 +1,122 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// pathStep is either a key of an object or an index of an array
+type pathStep struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+// parsePath supports the subset of JSONPath needed to pick one value, e.g. "$.user.name", "$.items[0].id"
+// or "$['user-name']"
+func parsePath(path string) ([]pathStep, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, errors.Errorf("json path %q should start with $", path)
+	}
+
+	steps := []pathStep{}
+	rest := path[1:]
+	for rest != "" {
+		switch {
+		case strings.HasPrefix(rest, "['"):
+			end := strings.Index(rest, "']")
+			if end < 0 {
+				return nil, errors.Errorf("unclosed key in json path %q", path)
+			}
+			steps = append(steps, pathStep{key: rest[2:end]})
+			rest = rest[end+2:]
+		case strings.HasPrefix(rest, "["):
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, errors.Errorf("unclosed index in json path %q", path)
+			}
+			index, err := strconv.Atoi(rest[1:end])
+			if err != nil || index < 0 {
+				return nil, errors.Errorf("invalid index %q in json path %q", rest[1:end], path)
+			}
+			steps = append(steps, pathStep{index: index, isIndex: true})
+			rest = rest[end+1:]
+		case strings.HasPrefix(rest, "."):
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, errors.Errorf("empty key in json path %q", path)
+			}
+			steps = append(steps, pathStep{key: rest[:end]})
+			rest = rest[end:]
+		default:
+			return nil, errors.Errorf("unexpected %q in json path %q", rest, path)
+		}
+	}
+
+	return steps, nil
+}
+
+// lookupPath gives the value at the path, the path is validated with the config
+func lookupPath(data interface{}, path string) (interface{}, bool) {
+	steps, err := parsePath(path)
+	if err != nil {
+		return nil, false
+	}
+
+	cur := data
+	for _, step := range steps {
+		if step.isIndex {
+			items, ok := cur.([]interface{})
+			if !ok || step.index >= len(items) {
+				return nil, false
+			}
+			cur = items[step.index]
+			continue
+		}
+
+		obj, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+
+		cur, ok = obj[step.key]
+		if !ok {
+			return nil, false
+		}
+	}
+
+	return cur, true
+}
+
+// lookupString gives the value at the path as string, objects and arrays are given as JSON
+func lookupString(data interface{}, path string) string {
+	if path == "" {
+		return ""
+	}
+
+	val, ok := lookupPath(data, path)
+	if !ok || val == nil {
+		return ""
+	}
+
+	switch v := val.(type) {
+	case string:
+		return v
+	case json.Number, bool:
+		return fmt.Sprint(v)
+	default:
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return ""
+		}
+		return string(raw)
+	}
+}
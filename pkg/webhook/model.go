@@ -0,0 +1,99 @@
+package webhook
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+
+	"breathbathChatGPT/pkg/msg"
+)
+
+var (
+	htmlTagRegex   = regexp.MustCompile(`<[^>]*>`)
+	htmlBreakRegex = regexp.MustCompile(`(?i)<br\s*/?>`)
+)
+
+func formatToString(f msg.OutputFormat) string {
+	switch f {
+	case msg.OutputFormatMarkdown, msg.OutputFormatMarkdown1, msg.OutputFormatMarkdown2:
+		return "markdown"
+	case msg.OutputFormatHTML:
+		return "html"
+	case msg.OutputFormatUndefined:
+		return "plain"
+	default:
+		return "plain"
+	}
+}
+
+func collectOptions(opts *msg.Options) []string {
+	options := []string{}
+	for _, row := range opts.GetInlineButtons() {
+		for _, b := range row {
+			if b.URL == "" && b.Data != "" {
+				options = append(options, b.Data)
+			}
+		}
+	}
+
+	for _, predefinedResp := range opts.GetPredefinedResponses() {
+		if predefinedResp != "" {
+			options = append(options, string(predefinedResp))
+		}
+	}
+
+	return options
+}
+
+// buildText gives the answer as one text for tools which show only plain text or Markdown,
+// buttons are listed as commands to send and attachments are given as links
+func buildText(resp *msg.Response, options []string) string {
+	text := resp.Message
+	if resp.Options.GetFormat() == msg.OutputFormatHTML {
+		text = html.UnescapeString(htmlTagRegex.ReplaceAllString(htmlBreakRegex.ReplaceAllString(text, "\n"), ""))
+	}
+
+	if resp.Type == msg.Error {
+		text = "❗" + text
+	}
+
+	lines := []string{}
+	if text != "" {
+		lines = append(lines, text)
+	}
+
+	for _, row := range resp.Options.GetInlineButtons() {
+		for _, b := range row {
+			if b.URL != "" {
+				lines = append(lines, fmt.Sprintf("- %s: %s", b.Text, b.URL))
+			}
+		}
+	}
+
+	for _, option := range options {
+		lines = append(lines, "- `"+option+"`")
+	}
+
+	for _, a := range resp.Attachments {
+		if a.URL != "" {
+			lines = append(lines, fmt.Sprintf("- %s: %s", a.FileName, a.URL))
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func buildTemplateData(resp *msg.Response, fields map[string]string, payload interface{}) *TemplateData {
+	options := collectOptions(resp.Options)
+
+	return &TemplateData{
+		Text:    buildText(resp, options),
+		Message: resp.Message,
+		Format:  formatToString(resp.Options.GetFormat()),
+		IsError: resp.Type == msg.Error,
+		Options: options,
+		Fields:  fields,
+		Payload: payload,
+	}
+}
@@ -0,0 +1,389 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"breathbathChatGPT/pkg/msg"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	logging "github.com/sirupsen/logrus"
+)
+
+const (
+	WebhooksPath = "/webhooks/"
+
+	readHeaderTimeout     = time.Second * 10
+	defaultConversationID = "default"
+)
+
+// Server accepts outgoing webhooks of the configured sources and answers them with the rendered reply template,
+// either in the response or with a separate request to the reply url
+type Server struct {
+	cfg        *Config
+	msgHandler *msg.Router
+	sources    map[string]*Source
+	httpClient *http.Client
+	server     *http.Server
+	inFlight   sync.WaitGroup
+}
+
+func NewServer(cfg *Config, r *msg.Router) (*Server, error) {
+	e := cfg.Validate()
+	if e.HasErrors() {
+		return nil, e
+	}
+
+	s := &Server{
+		cfg:        cfg,
+		msgHandler: r,
+		sources:    map[string]*Source{},
+		httpClient: &http.Client{
+			Timeout: time.Second * 30,
+			// a redirect could send the reply with the configured headers to a host out of the allowed ones
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+
+	for _, source := range cfg.Sources {
+		s.sources[source.Name] = source
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(WebhooksPath, s.handleWebhook)
+
+	s.server = &http.Server{
+		Addr:              cfg.Listen,
+		Handler:           mux,
+		ReadHeaderTimeout: readHeaderTimeout,
+	}
+
+	return s, nil
+}
+
+func (s *Server) Start() error {
+	logging.Infof("will listen for webhooks of %d sources on %q", len(s.sources), s.cfg.Listen)
+
+	var err error
+	if s.cfg.TLSCert != "" {
+		err = s.server.ListenAndServeTLS(s.cfg.TLSCert, s.cfg.TLSKey)
+	} else {
+		err = s.server.ListenAndServe()
+	}
+
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+
+	return errors.Wrap(err, "webhook listener failed")
+}
+
+// Stop stops accepting webhooks and waits for the replies in progress till the shutdown timeout
+func (s *Server) Stop() {
+	logging.Info("will stop webhook server")
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.ShutdownTimeout)
+	defer cancel()
+
+	err := s.server.Shutdown(ctx)
+	if err != nil {
+		logging.Errorf("failed to shutdown webhook server gracefully: %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.inFlight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		logging.Info("stopped webhook server")
+	case <-ctx.Done():
+		logging.Warnf("stopped waiting for in-flight webhook replies after %v", s.cfg.ShutdownTimeout)
+	}
+}
+
+// decodePayload reads JSON bodies and form encoded bodies, the latter as a flat object of the first values
+func decodePayload(contentType string, body []byte) (interface{}, error) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType == "application/x-www-form-urlencoded" {
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid form body")
+		}
+
+		payload := map[string]interface{}{}
+		for key := range form {
+			payload[key] = form.Get(key)
+		}
+
+		return payload, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	var payload interface{}
+	err := decoder.Decode(&payload)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid JSON body")
+	}
+
+	return payload, nil
+}
+
+func (s *Server) isAuthorized(source *Source, r *http.Request, payload interface{}) bool {
+	secret := ""
+	if source.SecretHeader != "" {
+		secret = r.Header.Get(source.SecretHeader)
+	} else {
+		secret = lookupString(payload, source.SecretPath)
+	}
+
+	return subtle.ConstantTimeCompare([]byte(secret), []byte(source.Secret)) == 1
+}
+
+func extractFields(source *Source, payload interface{}) map[string]string {
+	return map[string]string{
+		"message":         lookupString(payload, source.Fields.Message),
+		"sender_id":       lookupString(payload, source.Fields.SenderID),
+		"sender_alias":    lookupString(payload, source.Fields.SenderAlias),
+		"conversation_id": lookupString(payload, source.Fields.ConversationID),
+		"message_id":      lookupString(payload, source.Fields.MessageID),
+		"timestamp":       lookupString(payload, source.Fields.Timestamp),
+		"reply_url":       lookupString(payload, source.Fields.ReplyURL),
+	}
+}
+
+func (s *Server) buildRequest(source *Source, fields map[string]string) *msg.Request {
+	conversationID := fields["conversation_id"]
+	if conversationID == "" {
+		conversationID = defaultConversationID
+	}
+
+	messageID := fields["message_id"]
+	if messageID == "" {
+		messageID = uuid.NewString()
+	}
+
+	return &msg.Request{
+		Platform: source.Platform,
+		ID:       messageID,
+		Sender: &msg.Sender{
+			ID:    fields["sender_id"],
+			Alias: fields["sender_alias"],
+		},
+		Message: source.stripPrefixes(fields["message"]),
+		Meta: map[string]interface{}{
+			"conversation_id": conversationID,
+			"timestamp":       parseTimestamp(fields["timestamp"]).Unix(),
+		},
+	}
+}
+
+// parseTimestamp reads unix seconds with an optional fraction, unix milliseconds or RFC 3339,
+// the time of arrival is used if the tool sends no valid time
+func parseTimestamp(value string) time.Time {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t
+	}
+
+	seconds, _, _ := strings.Cut(value, ".")
+
+	unix, err := strconv.ParseInt(seconds, 10, 64)
+	if err != nil || unix <= 0 {
+		return time.Now()
+	}
+
+	// seconds get 13 digits only in the year 33658
+	if unix >= 1e12 {
+		return time.UnixMilli(unix)
+	}
+
+	return time.Unix(unix, 0)
+}
+
+func (s *Server) handleWebhook(w http.ResponseWriter, r *http.Request) {
+	log := logging.WithContext(r.Context())
+
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	source, ok := s.sources[strings.TrimPrefix(r.URL.Path, WebhooksPath)]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, s.cfg.MaxBodySize))
+	if err != nil {
+		log.Errorf("failed to read webhook of %q: %v", source.Name, err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	payload, err := decodePayload(r.Header.Get("Content-Type"), body)
+	if err != nil {
+		log.Warnf("failed to decode webhook of %q: %v", source.Name, err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if !s.isAuthorized(source, r, payload) {
+		log.Warnf("rejected webhook of %q with invalid secret from %q", source.Name, r.RemoteAddr)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	fields := extractFields(source, payload)
+	if fields["sender_id"] == "" {
+		log.Warnf("webhook of %q has no sender id at %q", source.Name, source.Fields.SenderID)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	req := s.buildRequest(source, fields)
+	if req.Message == "" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	replyURL := source.Reply.URL
+	if replyURL == "" && fields["reply_url"] != "" {
+		if !source.isAllowedReplyURL(fields["reply_url"]) {
+			log.Warnf("rejected webhook of %q with reply url %q of a not allowed host", source.Name, fields["reply_url"])
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		replyURL = fields["reply_url"]
+	}
+
+	if replyURL == "" {
+		s.replyInResponse(w, r, source, req, fields, payload)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	s.inFlight.Add(1)
+	go func() {
+		defer s.inFlight.Done()
+		s.replyWithRequest(replyURL, source, req, fields, payload)
+	}()
+}
+
+func (s *Server) route(ctx context.Context, source *Source, req *msg.Request) *msg.Response {
+	resp, err := s.msgHandler.Route(ctx, req)
+	if err != nil {
+		logging.WithContext(ctx).Errorf("failed to handle webhook of %q: %v", source.Name, err)
+		return &msg.Response{Message: "Unexpected error", Type: msg.Error}
+	}
+
+	return resp
+}
+
+func (s *Server) render(source *Source, resp *msg.Response, fields map[string]string, payload interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	err := source.template.Execute(&buf, buildTemplateData(resp, fields, payload))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to render reply template of %q", source.Name)
+	}
+
+	if source.getContentType() == defaultReplyContentType && !json.Valid(buf.Bytes()) {
+		return nil, errors.Errorf("reply template of %q gave invalid JSON: %s", source.Name, buf.String())
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (s *Server) replyInResponse(
+	w http.ResponseWriter,
+	r *http.Request,
+	source *Source,
+	req *msg.Request,
+	fields map[string]string,
+	payload interface{},
+) {
+	ctx, cancel := context.WithTimeout(r.Context(), s.cfg.HandleTimeout)
+	defer cancel()
+
+	log := logging.WithContext(ctx)
+
+	resp := s.route(ctx, source, req)
+	if resp == nil || (resp.Message == "" && len(resp.Attachments) == 0) {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	reply, err := s.render(source, resp, fields, payload)
+	if err != nil {
+		log.Error(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", source.getContentType())
+	w.WriteHeader(http.StatusOK)
+
+	_, err = w.Write(reply)
+	if err != nil {
+		log.Errorf("failed to write webhook reply of %q: %v", source.Name, err)
+	}
+}
+
+func (s *Server) replyWithRequest(replyURL string, source *Source, req *msg.Request, fields map[string]string, payload interface{}) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.HandleTimeout)
+	defer cancel()
+
+	log := logging.WithContext(ctx)
+
+	resp := s.route(ctx, source, req)
+	if resp == nil || (resp.Message == "" && len(resp.Attachments) == 0) {
+		log.Info("response message is empty, will send nothing to the sender")
+		return
+	}
+
+	reply, err := s.render(source, resp, fields, payload)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, replyURL, bytes.NewReader(reply))
+	if err != nil {
+		log.Errorf("failed to create webhook reply of %q: %v", source.Name, err)
+		return
+	}
+
+	httpReq.Header.Set("Content-Type", source.getContentType())
+	for name, value := range source.Reply.Headers {
+		httpReq.Header.Set(name, value)
+	}
+
+	httpResp, err := s.httpClient.Do(httpReq)
+	if err != nil {
+		log.Errorf("failed to post webhook reply of %q: %v", source.Name, err)
+		return
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode < http.StatusOK || httpResp.StatusCode >= http.StatusMultipleChoices {
+		log.Errorf("reply url of %q responded with status %d", source.Name, httpResp.StatusCode)
+	}
+}
@@ -0,0 +1,185 @@
+package webhook
+
+import (
+	"encoding/json"
+	"net/url"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"breathbathChatGPT/pkg/errs"
+)
+
+const defaultReplyContentType = "application/json"
+
+var sourceNameRegex = regexp.MustCompile(`^[a-z0-9][-_a-z0-9]*$`)
+
+// builtInPlatforms are taken by the frontends of the bot, a source with one of them would act as the users of
+// that platform, e.g. a leaked secret of a source with the telegram platform would give the accounts of Telegram users
+var builtInPlatforms = []string{"telegram", "slack", "discord", "matrix", "email", "cli", "http"}
+
+// Source is one tool sending outgoing webhooks, requests are accepted on /webhooks/{name}, users of the source
+// are added with its platform name, e.g. "/adduser joe mattermost {password}"
+type Source struct {
+	Name     string `json:"name"`
+	Platform string `json:"platform"`
+	Secret   string `json:"secret"`
+	// SecretHeader or SecretPath tell where the tool sends the secret, in a header or in a request field
+	SecretHeader string     `json:"secret_header"`
+	SecretPath   string     `json:"secret_path"`
+	Fields       FieldPaths `json:"fields"`
+	// StripPrefixes are removed from the start of the message, e.g. the trigger word of the webhook
+	StripPrefixes []string `json:"strip_prefixes"`
+	Reply         Reply    `json:"reply"`
+
+	template *template.Template
+}
+
+// FieldPaths are JSON paths of the request fields, form encoded requests are read as flat objects
+type FieldPaths struct {
+	Message        string `json:"message"`
+	SenderID       string `json:"sender_id"`
+	SenderAlias    string `json:"sender_alias"`
+	ConversationID string `json:"conversation_id"`
+	MessageID      string `json:"message_id"`
+	// Timestamp is the send time of the message as unix seconds, milliseconds or RFC 3339, it orders queued messages
+	Timestamp string `json:"timestamp"`
+	// ReplyURL is used if the tool gives a url for the reply in the request, its host should be in Reply.AllowedHosts
+	ReplyURL string `json:"reply_url"`
+}
+
+// Reply is rendered with the template and posted to URL or to the reply url of the request,
+// if none of them is set, the rendered reply is the response to the webhook request
+type Reply struct {
+	URL         string            `json:"url"`
+	Headers     map[string]string `json:"headers"`
+	ContentType string            `json:"content_type"`
+	Template    string            `json:"template"`
+	// AllowedHosts are the hosts the reply url of a request can point to, the url is sent by the caller,
+	// so without the check the bot would post answers to any server
+	AllowedHosts []string `json:"allowed_hosts"`
+}
+
+// TemplateData is given to the reply template
+type TemplateData struct {
+	// Text is the answer with buttons listed as commands to send, HTML answers are converted to plain text
+	Text    string
+	Message string
+	// Format is one of plain, markdown or html
+	Format  string
+	IsError bool
+	Options []string
+	Fields  map[string]string
+	// Payload is the decoded webhook request
+	Payload interface{}
+}
+
+var templateFuncs = template.FuncMap{
+	// json gives the value as JSON literal, e.g. {"text": {{json .Text}}}
+	"json": func(v interface{}) (string, error) {
+		raw, err := json.Marshal(v)
+		return string(raw), err
+	},
+}
+
+func (s *Source) getContentType() string {
+	if s.Reply.ContentType == "" {
+		return defaultReplyContentType
+	}
+
+	return s.Reply.ContentType
+}
+
+func (s *Source) validate(e *errs.Multi, i int) {
+	if !sourceNameRegex.MatchString(s.Name) {
+		e.Errf("source %d should have a name of lower case letters, digits, - and _, got %q", i, s.Name)
+	}
+
+	if s.Platform == "" {
+		e.Errf("source %q should have a platform", s.Name)
+	}
+
+	for _, platform := range builtInPlatforms {
+		if strings.EqualFold(s.Platform, platform) {
+			e.Errf("source %q cannot use the platform %q of a built-in frontend", s.Name, s.Platform)
+		}
+	}
+
+	if s.Secret == "" {
+		e.Errf("source %q should have a secret", s.Name)
+	}
+
+	if (s.SecretHeader == "") == (s.SecretPath == "") {
+		e.Errf("source %q should have either secret_header or secret_path", s.Name)
+	}
+
+	if s.Fields.Message == "" {
+		e.Errf("source %q should have a path of the message field", s.Name)
+	}
+
+	if s.Fields.SenderID == "" {
+		e.Errf("source %q should have a path of the sender_id field", s.Name)
+	}
+
+	for _, p := range []struct{ name, path string }{
+		{"secret_path", s.SecretPath},
+		{"fields.message", s.Fields.Message},
+		{"fields.sender_id", s.Fields.SenderID},
+		{"fields.sender_alias", s.Fields.SenderAlias},
+		{"fields.conversation_id", s.Fields.ConversationID},
+		{"fields.message_id", s.Fields.MessageID},
+		{"fields.timestamp", s.Fields.Timestamp},
+		{"fields.reply_url", s.Fields.ReplyURL},
+	} {
+		if p.path == "" {
+			continue
+		}
+
+		if _, err := parsePath(p.path); err != nil {
+			e.Errf("source %q has an invalid %s: %v", s.Name, p.name, err)
+		}
+	}
+
+	if s.Fields.ReplyURL != "" && len(s.Reply.AllowedHosts) == 0 {
+		e.Errf("source %q should have reply.allowed_hosts for the url at fields.reply_url", s.Name)
+	}
+
+	if s.Reply.Template == "" {
+		e.Errf("source %q should have a reply template", s.Name)
+		return
+	}
+
+	tpl, err := template.New(s.Name).Funcs(templateFuncs).Option("missingkey=zero").Parse(s.Reply.Template)
+	if err != nil {
+		e.Errf("source %q has an invalid reply template: %v", s.Name, err)
+		return
+	}
+	s.template = tpl
+}
+
+// isAllowedReplyURL checks the reply url given in a request against the allowed hosts
+func (s *Source) isAllowedReplyURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") {
+		return false
+	}
+
+	for _, host := range s.Reply.AllowedHosts {
+		if strings.EqualFold(u.Hostname(), host) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *Source) stripPrefixes(message string) string {
+	message = strings.TrimSpace(message)
+	for _, prefix := range s.StripPrefixes {
+		if prefix != "" && strings.HasPrefix(strings.ToLower(message), strings.ToLower(prefix)) {
+			return strings.TrimLeft(message[len(prefix):], " :,")
+		}
+	}
+
+	return message
+}